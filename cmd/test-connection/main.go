@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -25,6 +26,8 @@ func main() {
 
 	fmt.Printf("Testing connection to %s@%s...\n", username, host)
 
+	ctx := context.Background()
+
 	client, err := synology.NewClient()
 	if err != nil {
 		fmt.Printf("Failed to create client: %v\n", err)
@@ -32,7 +35,7 @@ func main() {
 	}
 
 	// Test basic SSH connection
-	output, err := client.ExecuteCommand("echo 'SSH connection successful'")
+	output, err := client.ExecuteCommand(ctx, "echo 'SSH connection successful'")
 	if err != nil {
 		fmt.Printf("SSH connection failed: %v\n", err)
 		os.Exit(1)
@@ -40,7 +43,7 @@ func main() {
 	fmt.Printf("SSH test result: %s", output)
 
 	// Check if synowebapi is available
-	output, err = client.ExecuteCommand("which synowebapi 2>/dev/null || echo 'synowebapi not found'")
+	output, err = client.ExecuteCommand(ctx, "which synowebapi 2>/dev/null || echo 'synowebapi not found'")
 	if err != nil {
 		fmt.Printf("Failed to check synowebapi: %v\n", err)
 	} else {
@@ -48,7 +51,7 @@ func main() {
 	}
 
 	// Check for VMM-related processes
-	output, err = client.ExecuteCommand("ps aux | grep -i vmm | head -3 || echo 'No VMM processes found'")
+	output, err = client.ExecuteCommand(ctx, "ps aux | grep -i vmm | head -3 || echo 'No VMM processes found'")
 	if err != nil {
 		fmt.Printf("Failed to check VMM processes: %v\n", err)
 	} else {
@@ -56,7 +59,7 @@ func main() {
 	}
 
 	// Check installed packages
-	output, err = client.ExecuteCommand("ls /var/packages/ | grep -i virtual || echo 'No virtual packages found'")
+	output, err = client.ExecuteCommand(ctx, "ls /var/packages/ | grep -i virtual || echo 'No virtual packages found'")
 	if err != nil {
 		fmt.Printf("Failed to check packages: %v\n", err)
 	} else {
@@ -64,7 +67,7 @@ func main() {
 	}
 
 	// Check system info
-	output, err = client.ExecuteCommand("uname -a")
+	output, err = client.ExecuteCommand(ctx, "uname -a")
 	if err != nil {
 		fmt.Printf("Failed to get system info: %v\n", err)
 	} else {
@@ -72,4 +75,4 @@ func main() {
 	}
 
 	fmt.Println("Connection test completed successfully!")
-}
\ No newline at end of file
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -19,11 +20,13 @@ func main() {
 
 	fmt.Printf("Testing Web API connection to %s@%s...\n", username, host)
 
+	ctx := context.Background()
+
 	// Create Web API client directly
 	client := synology.NewWebAPIClient(host, username, password)
 
 	// Test login
-	err := client.Login()
+	err := client.Login(ctx)
 	if err != nil {
 		fmt.Printf("Login failed: %v\n", err)
 		os.Exit(1)
@@ -32,7 +35,7 @@ func main() {
 	fmt.Println("✅ Login successful!")
 
 	// Test API call to list VMs
-	resp, err := client.CallAPI("SYNO.Virtualization.API.Guest", "list", "1", map[string]interface{}{})
+	resp, err := client.CallAPI(ctx, "SYNO.Virtualization.API.Guest", "list", "1", map[string]interface{}{})
 	if err != nil {
 		fmt.Printf("API call failed: %v\n", err)
 		// Don't exit, just show the error
@@ -41,10 +44,10 @@ func main() {
 	}
 
 	// Logout
-	err = client.Logout()
+	err = client.Logout(ctx)
 	if err != nil {
 		fmt.Printf("Logout failed: %v\n", err)
 	} else {
 		fmt.Println("✅ Logout successful!")
 	}
-}
\ No newline at end of file
+}
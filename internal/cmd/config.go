@@ -1,10 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/scttfrdmn/syno-vm/internal/config"
+	"github.com/scttfrdmn/syno-vm/internal/printer"
+	"github.com/scttfrdmn/syno-vm/internal/secrets"
+	"github.com/scttfrdmn/syno-vm/internal/synology"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -13,13 +21,18 @@ import (
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Manage syno-vm configuration",
-	Long:  `Configure connection settings for your Synology NAS.`,
+	Long: `Configure connection settings for your Synology NAS.
+
+Settings are grouped in named contexts, one per NAS. Commands use the
+current context, chosen with 'config use-context', unless --context or
+SYNO_VM_CONTEXT selects another. 'config set', 'get' and 'list' work on the
+selected context.`,
 }
 
 var configSetCmd = &cobra.Command{
 	Use:   "set",
 	Short: "Set configuration values",
-	Long:  `Set configuration values for syno-vm.`,
+	Long:  `Set configuration values in the selected context, creating it if this is the first one.`,
 	RunE:  runConfigSet,
 }
 
@@ -45,6 +58,14 @@ var (
 	port     int
 	keyfile  string
 	timeout  int
+	backend  string
+
+	keepaliveInterval int
+	passwordCommand   string
+	passwordStore     string
+	otpSecret         string
+
+	addContextUse bool
 )
 
 func init() {
@@ -53,68 +74,424 @@ func init() {
 	configCmd.AddCommand(configGetCmd)
 	configCmd.AddCommand(configListCmd)
 
-	// Set command flags
-	configSetCmd.Flags().StringVar(&host, "host", "", "Synology NAS hostname or IP address")
-	configSetCmd.Flags().StringVar(&username, "username", "", "Username for authentication")
-	configSetCmd.Flags().StringVar(&password, "password", "", "Password for Web API authentication")
-	configSetCmd.Flags().IntVar(&port, "port", 22, "SSH port")
-	configSetCmd.Flags().StringVar(&keyfile, "keyfile", "", "SSH private key file path")
-	configSetCmd.Flags().IntVar(&timeout, "timeout", 30, "Connection timeout in seconds")
+	configCmd.AddCommand(configAddContextCmd)
+	configCmd.AddCommand(configUseContextCmd)
+	configCmd.AddCommand(configGetContextsCmd)
+	configCmd.AddCommand(configCurrentContextCmd)
+	configCmd.AddCommand(configDeleteContextCmd)
+
+	addSettingFlags(configSetCmd)
+	addSettingFlags(configAddContextCmd)
+	configAddContextCmd.Flags().BoolVar(&addContextUse, "use", false, "Make the new context the current one")
+}
+
+// settingFlags lists the flags of config set and config add-context in the
+// order changes are reported, with the setting each one stores
+var settingFlags = []struct{ flag, key string }{
+	{"host", "host"},
+	{"username", "username"},
+	{"password", "password"},
+	{"password-command", "password_command"},
+	{"password-store", "password_store"},
+	{"otp-secret", "otp_secret"},
+	{"port", "port"},
+	{"keyfile", "keyfile"},
+	{"timeout", "timeout"},
+	{"keepalive-interval", "keepalive_interval"},
+	{"backend", "backend"},
+}
+
+// addSettingFlags adds the flags for the settings of a context to c
+func addSettingFlags(c *cobra.Command) {
+	c.Flags().StringVar(&host, "host", "", "Synology NAS hostname or IP address")
+	c.Flags().StringVar(&username, "username", "", "Username for authentication")
+	c.Flags().StringVar(&password, "password", "", "Password for Web API authentication, kept in the password store")
+	c.Flags().StringVar(&passwordCommand, "password-command", "", "Command printing the Web API password, e.g. 'pass show nas'")
+	c.Flags().StringVar(&passwordStore, "password-store", "", "Where to keep the password: keyring, vault or config (default keyring if available, else vault)")
+	c.Flags().StringVar(&otpSecret, "otp-secret", "", "Base32 TOTP secret to answer 2-step verification, kept in the password store")
+	c.Flags().IntVar(&port, "port", 22, "SSH port")
+	c.Flags().StringVar(&keyfile, "keyfile", "", "SSH private key file path")
+	c.Flags().IntVar(&timeout, "timeout", 30, "Connection timeout in seconds")
+	c.Flags().IntVar(&keepaliveInterval, "keepalive-interval", 30, "SSH keepalive interval in seconds (0 disables keepalives)")
+	c.Flags().StringVar(&backend, "backend", "", "VM backend: virsh, synowebapi, webapi or auto")
+}
+
+// changedSettings validates the setting flags given to cmd and returns
+// their values by setting key, in the order of settingFlags
+func changedSettings(cmd *cobra.Command) ([]string, map[string]interface{}, error) {
+	values := map[string]interface{}{
+		"host":               host,
+		"username":           username,
+		"password":           password,
+		"password_command":   passwordCommand,
+		"password_store":     passwordStore,
+		"otp_secret":         otpSecret,
+		"port":               port,
+		"keyfile":            keyfile,
+		"timeout":            timeout,
+		"keepalive_interval": keepaliveInterval,
+		"backend":            backend,
+	}
+
+	var keys []string
+	changed := make(map[string]interface{})
+	for _, s := range settingFlags {
+		if cmd.Flags().Changed(s.flag) {
+			keys = append(keys, s.key)
+			changed[s.key] = values[s.key]
+		}
+	}
+
+	if v, ok := changed["keyfile"]; ok {
+		// Expand tilde to home directory
+		if path := v.(string); strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get home directory: %w", err)
+			}
+			changed["keyfile"] = filepath.Join(home, path[2:])
+		}
+	}
+	if v, ok := changed["keepalive_interval"]; ok && v.(int) < 0 {
+		return nil, nil, fmt.Errorf("keepalive interval must not be negative")
+	}
+	if v, ok := changed["password_store"]; ok {
+		if store := v.(string); store != plainPasswordStore {
+			if _, err := secrets.Open(store); err != nil {
+				return nil, nil, fmt.Errorf("unknown password store %q (valid stores: %s, %s)", store, strings.Join(secrets.Stores, ", "), plainPasswordStore)
+			}
+		}
+	}
+	if v, ok := changed["otp_secret"]; ok {
+		if err := synology.ValidateTOTPSecret(v.(string)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if v, ok := changed["backend"]; ok {
+		if _, err := synology.ParseBackend(v.(string)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return keys, changed, nil
 }
 
 func runConfigSet(cmd *cobra.Command, args []string) error {
-	configChanged := false
+	keys, values, err := changedSettings(cmd)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no configuration values provided")
+	}
 
-	if cmd.Flags().Changed("host") {
-		viper.Set("host", host)
-		configChanged = true
-		fmt.Printf("Set host: %s\n", host)
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+	if err := storeSettings(ctx, activeContext, keys, values); err != nil {
+		return err
 	}
 
-	if cmd.Flags().Changed("username") {
-		viper.Set("username", username)
-		configChanged = true
-		fmt.Printf("Set username: %s\n", username)
+	// The first context created becomes the current one
+	if configFile.CurrentContext == "" {
+		configFile.CurrentContext = activeContext
 	}
+	return configFile.Save()
+}
 
-	if cmd.Flags().Changed("password") {
-		viper.Set("password", password)
-		configChanged = true
-		fmt.Printf("Set password: [hidden]\n")
+// plainPasswordStore is the password_store value that keeps the password in
+// clear text in the config file
+const plainPasswordStore = string(secrets.SourceConfig)
+
+// storeSettings writes changed settings into the named context and reports
+// them. The password goes to the password store rather than the file.
+func storeSettings(ctx context.Context, name string, keys []string, values map[string]interface{}) error {
+	_, existed := configFile.Contexts[name]
+	previous := configFile.Settings(name)
+	for _, key := range keys {
+		if key == "password" || key == "password_store" || key == "otp_secret" {
+			continue
+		}
+		configFile.Set(name, key, values[key])
+		fmt.Printf("Set %s: %v\n", strings.ReplaceAll(key, "_", " "), values[key])
+	}
+	if err := storePassword(ctx, name, values); err != nil {
+		return err
+	}
+	if secret, ok := values["otp_secret"].(string); ok {
+		if err := storeOTPSecret(ctx, name, secret); err != nil {
+			return err
+		}
 	}
 
-	if cmd.Flags().Changed("port") {
-		viper.Set("port", port)
-		configChanged = true
-		fmt.Printf("Set port: %d\n", port)
+	// Secrets stored for the account the context used before follow it to
+	// the new one
+	current := configFile.Settings(name)
+	if existed && (current["host"] != previous["host"] || current["username"] != previous["username"]) {
+		moveStoredSecrets(ctx, name, previous, current, values)
 	}
+	return nil
+}
 
-	if cmd.Flags().Changed("keyfile") {
-		// Expand tilde to home directory
-		if keyfile[:2] == "~/" {
-			home, err := os.UserHomeDir()
-			if err != nil {
-				return fmt.Errorf("failed to get home directory: %w", err)
+// storedAccount returns the password store account of a context's settings,
+// or "" if it keeps no secrets in a store
+func storedAccount(settings map[string]interface{}) string {
+	store, _ := settings["password_store"].(string)
+	username, _ := settings["username"].(string)
+	host, _ := settings["host"].(string)
+	if store == "" || username == "" || host == "" {
+		return ""
+	}
+	return store + ":" + secrets.Account(username, host)
+}
+
+// accountShared reports whether a context other than name keeps its secrets
+// in the same store account as settings
+func accountShared(name string, settings map[string]interface{}) bool {
+	stored := storedAccount(settings)
+	for other := range configFile.Contexts {
+		if other != name && storedAccount(configFile.Settings(other)) == stored {
+			return true
+		}
+	}
+	return false
+}
+
+// storedSecret is a secret a context may keep in its password store
+type storedSecret struct {
+	what    string // as printed
+	setting string // the setting that sets it
+	account func(username, host string) string
+}
+
+var storedSecrets = []storedSecret{
+	{"password", "password", secrets.Account},
+	{"OTP secret", "otp_secret", synology.OTPSecretAccount},
+}
+
+// moveStoredSecrets moves the secrets the named context kept in its password
+// store under the account of previous to the account of current. Secrets
+// set in values were stored under the new account already. Secrets another
+// context still uses are copied rather than moved. Failures are reported
+// with how to set the secret again.
+func moveStoredSecrets(ctx context.Context, name string, previous, current, values map[string]interface{}) {
+	if storedAccount(previous) == "" {
+		return
+	}
+	fromStore := previous["password_store"].(string)
+	fromUser, fromHost := previous["username"].(string), previous["host"].(string)
+	shared := accountShared(name, previous)
+
+	// Without a store account, such as after --password-store config, the
+	// secrets have nowhere to go
+	var toStore, toUser, toHost string
+	if storedAccount(current) != "" {
+		toStore = current["password_store"].(string)
+		toUser, toHost = current["username"].(string), current["host"].(string)
+	}
+
+	for _, secret := range storedSecrets {
+		if _, set := values[secret.setting]; set {
+			if !shared {
+				deleteSecret(ctx, fromStore, secret.account(fromUser, fromHost))
 			}
-			keyfile = filepath.Join(home, keyfile[2:])
+			continue
+		}
+		from := secret.account(fromUser, fromHost)
+		flag := "--" + strings.ReplaceAll(secret.setting, "_", "-")
+
+		if toStore == "" {
+			if !shared && deleteSecret(ctx, fromStore, from) {
+				fmt.Printf("Removed the %s of %s from %s; set it again with 'syno-vm config set %s'\n", secret.what, from, fromStore, flag)
+			}
+			continue
+		}
+
+		to := secret.account(toUser, toHost)
+		moved, err := copySecret(ctx, fromStore, from, toStore, to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to move the %s of %s to %s: %v; set it again with 'syno-vm config set %s'\n", secret.what, from, to, err, flag)
+			continue
+		}
+		if !moved {
+			continue
+		}
+		if !shared {
+			deleteSecret(ctx, fromStore, from)
 		}
-		viper.Set("keyfile", keyfile)
-		configChanged = true
-		fmt.Printf("Set keyfile: %s\n", keyfile)
+		fmt.Printf("Moved the %s of %s to %s in %s\n", secret.what, from, to, toStore)
 	}
+}
 
-	if cmd.Flags().Changed("timeout") {
-		viper.Set("timeout", timeout)
-		configChanged = true
-		fmt.Printf("Set timeout: %d\n", timeout)
+// copySecret copies the secret of account from in fromStore to account to
+// in toStore. It reports false if there is no secret to copy.
+func copySecret(ctx context.Context, fromStore, from, toStore, to string) (bool, error) {
+	src, err := secrets.Open(fromStore)
+	if err != nil {
+		return false, err
+	}
+	secret, err := src.Get(ctx, from)
+	if errors.Is(err, secrets.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
 	}
+	dst, err := secrets.Open(toStore)
+	if err != nil {
+		return false, err
+	}
+	return true, dst.Set(ctx, to, secret)
+}
 
-	if !configChanged {
-		return fmt.Errorf("no configuration values provided")
+// deleteSecret removes the secret of account from store, warning if that
+// fails, and reports whether it succeeded
+func deleteSecret(ctx context.Context, store, account string) bool {
+	s, err := secrets.Open(store)
+	if err == nil {
+		err = s.Delete(ctx, account)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to delete the secret of %s from %s: %v\n", account, store, err)
+		return false
+	}
+	return true
+}
+
+// deleteStoredSecrets removes the secrets kept in a password store for the
+// account of settings, those of the deleted context name, unless another
+// context still uses them
+func deleteStoredSecrets(ctx context.Context, name string, settings map[string]interface{}) {
+	if storedAccount(settings) == "" || accountShared(name, settings) {
+		return
+	}
+	store := settings["password_store"].(string)
+	username, host := settings["username"].(string), settings["host"].(string)
+	deleted := true
+	for _, secret := range storedSecrets {
+		deleted = deleteSecret(ctx, store, secret.account(username, host)) && deleted
+	}
+	if deleted {
+		fmt.Printf("Deleted the secrets of %s from %s\n", secrets.Account(username, host), store)
+	}
+}
+
+// storeOTPSecret saves the TOTP secret in the password store of the context,
+// or in the config file if the password is kept there
+func storeOTPSecret(ctx context.Context, name, secret string) error {
+	current := configFile.Settings(name)
+	if _, plain := current["password"]; plain {
+		if _, stored := current["password_store"]; !stored {
+			configFile.Set(name, "otp_secret", secret)
+			fmt.Println("Set OTP secret: [hidden, in config file]")
+			return nil
+		}
+	}
+
+	store := fmt.Sprint(current["password_store"])
+	if _, ok := current["password_store"]; !ok {
+		store = secrets.DefaultStore()
+		configFile.Set(name, "password_store", store)
+	}
+	host, username := fmt.Sprint(current["host"]), fmt.Sprint(current["username"])
+	if current["host"] == nil || current["username"] == nil {
+		return fmt.Errorf("set --host and --username before storing an OTP secret in %s", store)
+	}
+
+	s, err := secrets.Open(store)
+	if err != nil {
+		return err
+	}
+	account := synology.OTPSecretAccount(username, host)
+	if err := s.Set(ctx, account, secret); err != nil {
+		return fmt.Errorf("failed to store OTP secret: %w", err)
+	}
+	configFile.Unset(name, "otp_secret")
+	fmt.Printf("Set OTP secret: [hidden, in %s as %s]\n", store, account)
+	return nil
+}
+
+// storePassword saves a new password, or moves the password to a new store.
+// A password left in clear text by older versions moves to the store too.
+func storePassword(ctx context.Context, name string, values map[string]interface{}) error {
+	password, hasPassword := values["password"].(string)
+	store, hasStore := values["password_store"].(string)
+	if !hasPassword && !hasStore {
+		return nil
+	}
+
+	current := configFile.Settings(name)
+	setting := func(key string) string {
+		if v, ok := current[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	if !hasStore {
+		if store = setting("password_store"); store == "" {
+			store = secrets.DefaultStore()
+		}
+	}
+	if !hasPassword {
+		password = setting("password")
+	}
+	if hasPassword {
+		// An explicit password replaces the password command
+		configFile.Unset(name, "password_command")
 	}
 
-	// Write config to file
-	return viper.WriteConfig()
+	if store == plainPasswordStore {
+		configFile.Unset(name, "password_store")
+		if hasPassword {
+			configFile.Set(name, "password", password)
+			fmt.Println("Set password: [hidden, in config file]")
+		}
+		return nil
+	}
+
+	configFile.Set(name, "password_store", store)
+	if password == "" {
+		fmt.Printf("Set password store: %s\n", store)
+		return nil
+	}
+
+	host, username := setting("host"), setting("username")
+	if host == "" || username == "" {
+		return fmt.Errorf("set --host and --username before storing a password in %s", store)
+	}
+	s, err := secrets.Open(store)
+	if err != nil {
+		return err
+	}
+	account := secrets.Account(username, host)
+	if err := s.Set(ctx, account, password); err != nil {
+		return fmt.Errorf("failed to store password: %w", err)
+	}
+	configFile.Unset(name, "password")
+	fmt.Printf("Set password: [hidden, in %s as %s]\n", store, account)
+	return nil
+}
+
+// settingValue returns a setting of the selected context for display,
+// with secrets replaced by where they are kept
+func settingValue(key string) interface{} {
+	value := viper.Get(key)
+	switch {
+	case key == "password" && synology.PasswordRef().Source() != secrets.SourceNone:
+		return passwordDescription()
+	case key == "otp_secret" && value != nil:
+		return "[hidden, in config file]"
+	}
+	return value
+}
+
+// passwordDescription says where the password of the selected context is
+// kept, without looking it up
+func passwordDescription() string {
+	ref := synology.PasswordRef()
+	if ref.Source() == secrets.SourceCommand {
+		return fmt.Sprintf("[%s]", ref.Describe())
+	}
+	return fmt.Sprintf("[hidden, %s]", ref.Describe())
 }
 
 func runConfigGet(cmd *cobra.Command, args []string) error {
@@ -122,30 +499,224 @@ func runConfigGet(cmd *cobra.Command, args []string) error {
 		return runConfigList(cmd, args)
 	}
 
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
 	key := args[0]
-	value := viper.Get(key)
+	value := settingValue(key)
 	if value == nil {
 		return fmt.Errorf("configuration key '%s' not found", key)
 	}
 
-	fmt.Printf("%s: %v\n", key, value)
-	return nil
+	return printer.PrintObject(os.Stdout, format, value, key, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%s: %v\n", key, value)
+		return err
+	})
 }
 
 func runConfigList(cmd *cobra.Command, args []string) error {
-	fmt.Println("Current configuration:")
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
 
-	keys := []string{"host", "username", "password", "port", "keyfile", "timeout"}
-	for _, key := range keys {
-		value := viper.Get(key)
-		if value != nil {
-			if key == "password" {
-				fmt.Printf("  %s: [hidden]\n", key)
-			} else {
-				fmt.Printf("  %s: %v\n", key, value)
-			}
+	values := make(map[string]interface{})
+	var set []string
+	for _, key := range config.ContextKeys {
+		if value := settingValue(key); value != nil {
+			values[key] = value
+			set = append(set, key)
 		}
 	}
 
+	return printer.PrintObject(os.Stdout, format, values, strings.Join(set, "\n"), func(w io.Writer) error {
+		fmt.Fprintf(w, "Current configuration (context %s):\n", activeContext)
+		for _, key := range set {
+			fmt.Fprintf(w, "  %s: %v\n", key, values[key])
+		}
+		return nil
+	})
+}
+
+var configAddContextCmd = &cobra.Command{
+	Use:   "add-context <name>",
+	Short: "Add a context for another NAS",
+	Long: `Add a named context with its own host, credentials, backend and
+defaults. Settings not given here use the built-in defaults; change them
+later with 'syno-vm --context <name> config set'.`,
+	Annotations: map[string]string{anyContext: "true"},
+	Args:        cobra.ExactArgs(1),
+	RunE:        runConfigAddContext,
+}
+
+var configUseContextCmd = &cobra.Command{
+	Use:         "use-context <name>",
+	Short:       "Select the context commands use by default",
+	Annotations: map[string]string{anyContext: "true"},
+	Args:        cobra.ExactArgs(1),
+	RunE:        runConfigUseContext,
+}
+
+var configGetContextsCmd = &cobra.Command{
+	Use:         "get-contexts",
+	Short:       "List contexts",
+	Annotations: map[string]string{anyContext: "true"},
+	Args:        cobra.NoArgs,
+	RunE:        runConfigGetContexts,
+}
+
+var configCurrentContextCmd = &cobra.Command{
+	Use:         "current-context",
+	Short:       "Print the current context",
+	Annotations: map[string]string{anyContext: "true"},
+	Args:        cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if configFile.CurrentContext == "" {
+			return fmt.Errorf("no current context; set one with 'syno-vm config use-context <name>'")
+		}
+		fmt.Println(configFile.CurrentContext)
+		return nil
+	},
+}
+
+var configDeleteContextCmd = &cobra.Command{
+	Use:         "delete-context <name>",
+	Short:       "Delete a context",
+	Annotations: map[string]string{anyContext: "true"},
+	Args:        cobra.ExactArgs(1),
+	RunE:        runConfigDeleteContext,
+}
+
+func runConfigAddContext(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if err := config.ValidateContextName(name); err != nil {
+		return err
+	}
+	if _, ok := configFile.Contexts[name]; ok {
+		return fmt.Errorf("context %q already exists; change it with 'syno-vm --context %s config set'", name, name)
+	}
+
+	keys, values, err := changedSettings(cmd)
+	if err != nil {
+		return err
+	}
+	if _, ok := values["host"]; !ok {
+		return fmt.Errorf("--host is required")
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+	if err := storeSettings(ctx, name, keys, values); err != nil {
+		return err
+	}
+	if addContextUse || configFile.CurrentContext == "" {
+		configFile.CurrentContext = name
+	}
+	if err := configFile.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added context %s\n", name)
+	if configFile.CurrentContext == name {
+		fmt.Printf("Switched to context %s\n", name)
+	}
+	return nil
+}
+
+func runConfigUseContext(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if _, ok := configFile.Contexts[name]; !ok {
+		return fmt.Errorf("context %q not found", name)
+	}
+
+	configFile.CurrentContext = name
+	if err := configFile.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to context %s\n", name)
+	return nil
+}
+
+func runConfigDeleteContext(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if _, ok := configFile.Contexts[name]; !ok {
+		return fmt.Errorf("context %q not found", name)
+	}
+
+	settings := configFile.Settings(name)
+	delete(configFile.Contexts, name)
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+	deleteStoredSecrets(ctx, name, settings)
+	if err := synology.NewSessionCache(configFile.SessionPath(name)).Clear(); err != nil {
+		return err
+	}
+	if configFile.CurrentContext == name {
+		configFile.CurrentContext = ""
+	}
+	if err := configFile.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted context %s\n", name)
+	if configFile.CurrentContext == "" && len(configFile.Contexts) > 0 {
+		fmt.Println("No current context; select one with 'syno-vm config use-context <name>'")
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// contextSummary is a row of config get-contexts
+type contextSummary struct {
+	Name     string `json:"name"`
+	Current  bool   `json:"current"`
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	Backend  string `json:"backend"`
+}
+
+// contextList prints contexts
+var contextList = printer.List[contextSummary]{
+	Columns: []printer.Column[contextSummary]{
+		{Header: "CURRENT", Value: func(c contextSummary) string {
+			if c.Current {
+				return "*"
+			}
+			return ""
+		}},
+		{Header: "NAME", Value: func(c contextSummary) string { return c.Name }},
+		{Header: "HOST", Value: func(c contextSummary) string { return c.Host }},
+		{Header: "USERNAME", Value: func(c contextSummary) string { return c.Username }},
+		{Header: "BACKEND", Value: func(c contextSummary) string { return c.Backend }},
+	},
+	Name:  func(c contextSummary) string { return c.Name },
+	Empty: "No contexts configured. Add one with 'syno-vm config add-context <name> --host <host>'.",
+}
+
+func runConfigGetContexts(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	summaries := []contextSummary{}
+	for _, name := range configFile.Names() {
+		settings := configFile.Contexts[name]
+		str := func(key string) string {
+			if v, ok := settings[key]; ok {
+				return fmt.Sprint(v)
+			}
+			return ""
+		}
+		summaries = append(summaries, contextSummary{
+			Name:     name,
+			Current:  name == configFile.CurrentContext,
+			Host:     str("host"),
+			Username: str("username"),
+			Backend:  str("backend"),
+		})
+	}
+
+	return contextList.Print(os.Stdout, format, summaries)
+}
@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/scttfrdmn/syno-vm/internal/config"
+	"github.com/scttfrdmn/syno-vm/internal/secrets"
+	"github.com/scttfrdmn/syno-vm/test/mock"
 	"github.com/spf13/viper"
 )
 
@@ -19,6 +25,7 @@ func TestConfigOperations(t *testing.T) {
 
 	// Set up viper to use temp directory
 	viper.Reset()
+	t.Cleanup(viper.Reset)
 	viper.AddConfigPath(configDir)
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -124,4 +131,279 @@ func expandTildePath(path string) (string, error) {
 	}
 
 	return filepath.Join(home, path[2:]), nil
-}
\ No newline at end of file
+}
+
+func TestConfigContexts(t *testing.T) {
+	m := mock.NewMockClient()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		return captureStdout(t, func() error {
+			return executeWithMock(t, m, append([]string{"--config", path}, args...)...)
+		})
+	}
+
+	if _, err := run("config", "add-context", "home", "--host", "home-nas.local", "--username", "admin"); err != nil {
+		t.Fatalf("add-context home failed: %v", err)
+	}
+	if _, err := run("config", "add-context", "lab", "--host", "lab-nas.local", "--backend", "virsh"); err != nil {
+		t.Fatalf("add-context lab failed: %v", err)
+	}
+	if _, err := run("config", "add-context", "lab", "--host", "other.local"); err == nil {
+		t.Error("expected a duplicate context to be rejected")
+	}
+	if _, err := run("config", "add-context", "bad name", "--host", "x"); err == nil {
+		t.Error("expected an invalid context name to be rejected")
+	}
+
+	// The first context added becomes the current one
+	out, err := run("config", "get", "host")
+	if err != nil || strings.TrimSpace(out) != "host: home-nas.local" {
+		t.Errorf("get host = %q, %v", out, err)
+	}
+	out, err = run("--context", "lab", "config", "get", "host")
+	if err != nil || strings.TrimSpace(out) != "host: lab-nas.local" {
+		t.Errorf("get host --context lab = %q, %v", out, err)
+	}
+
+	if _, err := run("config", "use-context", "lab"); err != nil {
+		t.Fatalf("use-context failed: %v", err)
+	}
+	out, err = run("config", "current-context")
+	if err != nil || strings.TrimSpace(out) != "lab" {
+		t.Errorf("current-context = %q, %v", out, err)
+	}
+	if _, err := run("config", "set", "--timeout", "5"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	out, err = run("--context", "home", "config", "get", "timeout")
+	if err != nil || strings.TrimSpace(out) != "timeout: 30" {
+		t.Errorf("set changed another context: %q, %v", out, err)
+	}
+
+	out, err = run("config", "get-contexts")
+	if err != nil {
+		t.Fatalf("get-contexts failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[2], "*") || !strings.Contains(lines[2], "lab-nas.local") {
+		t.Errorf("unexpected get-contexts output:\n%s", out)
+	}
+
+	if _, err := run("--context", "missing", "list"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected an unknown context to be reported, got %v", err)
+	}
+	if _, err := run("--context", "../../escape", "login"); err == nil || !strings.Contains(err.Error(), "invalid context name") {
+		t.Errorf("expected a context name with a path to be rejected, got %v", err)
+	}
+
+	if _, err := run("config", "delete-context", "lab"); err != nil {
+		t.Fatalf("delete-context failed: %v", err)
+	}
+	if _, err := run("config", "current-context"); err == nil {
+		t.Error("expected no current context after deleting it")
+	}
+}
+
+func TestConfigMigratesFlatFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("host: old-nas.local\nport: 2222\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "--config", path, "config", "get", "host")
+	})
+	if err != nil || strings.TrimSpace(out) != "host: old-nas.local" {
+		t.Fatalf("get host = %q, %v", out, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "current-context: default") || !strings.Contains(string(data), "contexts:") {
+		t.Errorf("config file was not migrated:\n%s", data)
+	}
+}
+
+func TestConfigSetPasswordInVault(t *testing.T) {
+	t.Setenv(secrets.VaultPassphraseEnv, "correct horse")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("host: nas.local\nusername: admin\npassword: s3cret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Choosing a store moves the clear-text password into it
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "--config", path, "config", "set", "--password-store", "vault")
+	})
+	if err != nil {
+		t.Fatalf("config set failed: %v", err)
+	}
+	if !strings.Contains(out, "in vault as admin@nas.local") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") || !strings.Contains(string(data), "password_store: vault") {
+		t.Errorf("password was not moved out of the config file:\n%s", data)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("config file mode = %v, %v; want 600", info.Mode().Perm(), err)
+		}
+	}
+
+	// executeWithMock pointed HOME at the directory holding the vault
+	vaultPath, err := secrets.DefaultVaultPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := secrets.NewVault(vaultPath, secrets.EnvOrPromptPassphrase)
+	if got, err := v.Get(context.Background(), "admin@nas.local"); err != nil || got != "s3cret" {
+		t.Errorf("vault holds %q, %v", got, err)
+	}
+
+	out, err = captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "--config", path, "config", "get", "password")
+	})
+	if err != nil || strings.TrimSpace(out) != "password: [hidden, in vault as admin@nas.local]" {
+		t.Errorf("config get password = %q, %v", out, err)
+	}
+}
+
+func TestConfigSetPasswordCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	_, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "--config", path, "config", "set",
+			"--host", "nas.local", "--username", "admin", "--password-command", "pass show nas")
+	})
+	if err != nil {
+		t.Fatalf("config set failed: %v", err)
+	}
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "--config", path, "config", "list")
+	})
+	if err != nil {
+		t.Fatalf("config list failed: %v", err)
+	}
+	for _, want := range []string{`password: [from command "pass show nas"]`, "password_command: pass show nas"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("config list output missing %q:\n%s", want, out)
+		}
+	}
+
+	if err := executeWithMock(t, mock.NewMockClient(), "--config", path, "config", "set", "--password-store", "wallet"); err == nil {
+		t.Error("expected an unknown password store to be rejected")
+	}
+}
+
+func TestConfigSetOTPSecret(t *testing.T) {
+	t.Setenv(secrets.VaultPassphraseEnv, "correct horse")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	m := mock.NewMockClient()
+
+	if err := executeWithMock(t, m, "--config", path, "config", "set", "--otp-secret", "not base32!"); err == nil {
+		t.Error("expected an invalid OTP secret to be rejected")
+	}
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, m, "--config", path, "config", "set", "--host", "nas.local", "--username", "admin",
+			"--password-store", "vault", "--otp-secret", "GEZD GNBV GY3T QOJQ")
+	})
+	if err != nil {
+		t.Fatalf("config set failed: %v", err)
+	}
+	if !strings.Contains(out, "Set OTP secret: [hidden, in vault as admin@nas.local/otp]") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "GEZD") {
+		t.Errorf("OTP secret was written to the config file:\n%s", data)
+	}
+}
+
+func TestConfigMovesSecretsOfOldAccounts(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(secrets.VaultPassphraseEnv, "correct horse")
+	vaultPath, err := secrets.DefaultVaultPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := secrets.NewVault(vaultPath, secrets.EnvOrPromptPassphrase)
+	for _, account := range []string{"admin@nas.local", "admin@nas.local/otp", "admin@lab.local", "admin@lab.local/otp"} {
+		if err := v.Set(ctx, account, "s3cret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored := func(account string) bool {
+		t.Helper()
+		_, err := v.Get(ctx, account)
+		return err == nil
+	}
+
+	origFile := configFile
+	t.Cleanup(func() { configFile = origFile })
+	configFile = config.New(filepath.Join(t.TempDir(), "config.yaml"))
+	configFile.Contexts = map[string]config.Context{
+		"home": {"host": "nas.local", "username": "admin", "password_store": "vault"},
+		"work": {"host": "nas.local", "username": "admin", "password_store": "vault"},
+		"lab":  {"host": "lab.local", "username": "admin", "password_store": "vault"},
+	}
+
+	// Secrets another context still uses are kept
+	if _, err := captureStdout(t, func() error { return runConfigDeleteContext(configDeleteContextCmd, []string{"home"}) }); err != nil {
+		t.Fatalf("delete-context home failed: %v", err)
+	}
+	if !stored("admin@nas.local") || !stored("admin@nas.local/otp") {
+		t.Error("deleting home removed the secrets work uses")
+	}
+
+	// Changing the host of the last context using them moves them
+	out, err := captureStdout(t, func() error {
+		return storeSettings(ctx, "work", []string{"host"}, map[string]interface{}{"host": "nas2.local"})
+	})
+	if err != nil {
+		t.Fatalf("storeSettings failed: %v", err)
+	}
+	if stored("admin@nas.local") || stored("admin@nas.local/otp") {
+		t.Error("changing the host of work kept the secrets of the old account")
+	}
+	if !stored("admin@nas2.local") || !stored("admin@nas2.local/otp") {
+		t.Error("changing the host of work did not move the secrets to the new account")
+	}
+	if !strings.Contains(out, "Moved the password of admin@nas.local to admin@nas2.local in vault") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	// A new password replaces the moved one, and the old one is not kept
+	if _, err := captureStdout(t, func() error {
+		return storeSettings(ctx, "work", []string{"username", "password"}, map[string]interface{}{"username": "ops", "password": "n3w"})
+	}); err != nil {
+		t.Fatalf("storeSettings failed: %v", err)
+	}
+	if got, err := v.Get(ctx, "ops@nas2.local"); err != nil || got != "n3w" {
+		t.Errorf("password of the new account = %q, %v", got, err)
+	}
+	if stored("admin@nas2.local") || !stored("ops@nas2.local/otp") {
+		t.Error("changing the username did not replace the password and move the OTP secret")
+	}
+
+	if _, err := captureStdout(t, func() error { return runConfigDeleteContext(configDeleteContextCmd, []string{"lab"}) }); err != nil {
+		t.Fatalf("delete-context lab failed: %v", err)
+	}
+	if stored("admin@lab.local") || stored("admin@lab.local/otp") {
+		t.Error("deleting lab kept its secrets")
+	}
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/printer"
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
+)
+
+// controlCmd represents the control command
+var controlCmd = &cobra.Command{
+	Use:   "control",
+	Short: "Manage the persistent SSH connection",
+	Long: `Manage a control master: a background syno-vm process that keeps one SSH
+connection to the NAS open and runs commands for every other syno-vm
+invocation, like OpenSSH's ControlMaster. While it runs, commands skip the
+SSH handshake.
+
+The control socket lives in ~/.syno-vm/control and is only accessible to
+the current user.`,
+}
+
+var controlStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start a control master in the background",
+	Long: `Connect to the NAS and leave a control master running in the background.
+It exits after being idle for --persist, or when stopped with
+'syno-vm control stop'.`,
+	Args: cobra.NoArgs,
+	RunE: runControlStart,
+}
+
+var controlServeCmd = &cobra.Command{
+	Use:    "serve",
+	Short:  "Run a control master in the foreground",
+	Args:   cobra.NoArgs,
+	Hidden: true,
+	RunE:   runControlServe,
+}
+
+var controlStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the control master",
+	Args:  cobra.NoArgs,
+	RunE:  runControlStop,
+}
+
+var controlStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether a control master is running",
+	Args:  cobra.NoArgs,
+	RunE:  runControlStatus,
+}
+
+var controlPersist time.Duration
+
+// controlStartTimeout bounds how long 'control start' waits for the
+// background master to accept connections
+const controlStartTimeout = 30 * time.Second
+
+func init() {
+	rootCmd.AddCommand(controlCmd)
+	controlCmd.AddCommand(controlStartCmd)
+	controlCmd.AddCommand(controlServeCmd)
+	controlCmd.AddCommand(controlStopCmd)
+	controlCmd.AddCommand(controlStatusCmd)
+
+	for _, c := range []*cobra.Command{controlStartCmd, controlServeCmd} {
+		c.Flags().DurationVar(&controlPersist, "persist", 10*time.Minute, "Exit after being idle this long (0 means never)")
+	}
+}
+
+// controlClient returns the SSH client whose control socket the control
+// commands manage
+func controlClient() (*synology.Client, error) {
+	client, err := synology.NewClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	if client.ControlPath() == "" {
+		return nil, fmt.Errorf("control sockets are not available: no home directory")
+	}
+	return client, nil
+}
+
+func runControlStart(cmd *cobra.Command, args []string) error {
+	client, err := controlClient()
+	if err != nil {
+		return err
+	}
+	defer closeManager(client)
+	path := client.ControlPath()
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), controlStartTimeout)
+	defer cancel()
+
+	if status, err := synology.PingControl(ctx, path); err == nil {
+		fmt.Printf("Control master for %s already running (pid %d)\n", status.Target, status.PID)
+		return nil
+	}
+
+	// Connect here first so that host key prompts and authentication errors
+	// reach the terminal rather than the background process's log
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create control directory: %w", err)
+	}
+	logFile, err := os.OpenFile(path+".log", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open control master log: %w", err)
+	}
+	defer func() { _ = logFile.Close() }()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find syno-vm executable: %w", err)
+	}
+
+	master := exec.Command(executable, controlServeArgs(cmd)...)
+	master.Stdout = logFile
+	master.Stderr = logFile
+	master.SysProcAttr = detachedProcAttr()
+	if err := master.Start(); err != nil {
+		return fmt.Errorf("failed to start control master: %w", err)
+	}
+	pid := master.Process.Pid
+	_ = master.Process.Release()
+
+	for {
+		status, err := synology.PingControl(ctx, path)
+		if err == nil {
+			fmt.Printf("Control master for %s started (pid %d)\n", status.Target, pid)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("control master did not start, see %s.log: %w", path, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// controlServeArgs returns the arguments of the background 'control serve'
+// process, which must connect with the same config and context as cmd
+func controlServeArgs(cmd *cobra.Command) []string {
+	args := []string{"control", "serve", "--persist", controlPersist.String()}
+	if cfgFile != "" {
+		args = append(args, "--config", cfgFile)
+	}
+	// A context missing from the config file can only be the implied
+	// default, which the child resolves by itself but would reject if named
+	if _, ok := configFile.Contexts[activeContext]; ok {
+		args = append(args, "--context", activeContext)
+	}
+	if insecure, _ := cmd.Flags().GetBool("insecure-skip-host-key-check"); insecure {
+		args = append(args, "--insecure-skip-host-key-check")
+	}
+	return args
+}
+
+func runControlServe(cmd *cobra.Command, args []string) error {
+	client, err := controlClient()
+	if err != nil {
+		return err
+	}
+	defer closeManager(client)
+
+	return client.ServeControl(cmd.Context(), controlPersist)
+}
+
+func runControlStop(cmd *cobra.Command, args []string) error {
+	client, err := controlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), controlStartTimeout)
+	defer cancel()
+
+	status, err := synology.StopControl(ctx, client.ControlPath())
+	if err != nil {
+		fmt.Println("No control master running")
+		return nil
+	}
+
+	fmt.Printf("Control master for %s stopped (pid %d)\n", status.Target, status.PID)
+	return nil
+}
+
+func runControlStatus(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	client, err := controlClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), controlStartTimeout)
+	defer cancel()
+
+	status, err := synology.PingControl(ctx, client.ControlPath())
+	if err != nil {
+		if format.IsTable() {
+			fmt.Println("No control master running")
+			return nil
+		}
+		return fmt.Errorf("no control master running")
+	}
+
+	return printer.PrintObject(os.Stdout, format, status, status.Target, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "Control master for %s running (pid %d, since %s)\nSocket: %s\n",
+			status.Target, status.PID, status.Started.Format(time.RFC3339), client.ControlPath())
+		return err
+	})
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/config"
+)
+
+func TestControlServeArgs(t *testing.T) {
+	origFile, origPath, origContext, origPersist := configFile, cfgFile, activeContext, controlPersist
+	t.Cleanup(func() {
+		configFile, cfgFile, activeContext, controlPersist = origFile, origPath, origContext, origPersist
+	})
+
+	configFile = config.New("")
+	configFile.Contexts = map[string]config.Context{"home": {}, "work": {}}
+	cfgFile = "/tmp/syno-vm.yaml"
+	activeContext = "work"
+	controlPersist = 5 * time.Minute
+
+	got := strings.Join(controlServeArgs(controlStartCmd), " ")
+	want := "control serve --persist 5m0s --config /tmp/syno-vm.yaml --context work"
+	if got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+
+	// Without a config file the default context is implied, and naming it
+	// would make the child fail
+	configFile = config.New("")
+	cfgFile = ""
+	activeContext = config.DefaultContext
+	got = strings.Join(controlServeArgs(controlStartCmd), " ")
+	if want := "control serve --persist 5m0s"; got != want {
+		t.Errorf("args without contexts = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package cmd
+
+import "syscall"
+
+// detachedProcAttr starts the control master in its own session so it
+// outlives the terminal it was started from
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
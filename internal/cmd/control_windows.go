@@ -0,0 +1,17 @@
+//go:build windows
+
+package cmd
+
+import "syscall"
+
+// detachedProcess is DETACHED_PROCESS from the Windows API
+const detachedProcess = 0x00000008
+
+// detachedProcAttr starts the control master without a console so it
+// outlives the terminal it was started from
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+		HideWindow:    true,
+	}
+}
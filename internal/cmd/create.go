@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
 
-	"github.com/spf13/cobra"
 	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // createCmd represents the create command
@@ -21,18 +24,30 @@ var (
 	createCPU      int
 	createMemory   int
 	createStorage  string
+	createNetwork  string
+	createDiskSize int
+	createISO      string
+	createAutorun  bool
+	createDryRun   bool
 )
 
 func init() {
 	rootCmd.AddCommand(createCmd)
 
 	createCmd.Flags().StringVar(&createName, "name", "", "Name of the virtual machine (required)")
-	createCmd.Flags().StringVar(&createTemplate, "template", "", "Template to use for VM creation")
+	createCmd.Flags().StringVar(&createTemplate, "template", "", "Template to use for VM creation (virsh: installation ISO path; VMM: image name)")
 	createCmd.Flags().IntVar(&createCPU, "cpu", 2, "Number of CPU cores")
 	createCmd.Flags().IntVar(&createMemory, "memory", 2048, "Memory in MB")
-	createCmd.Flags().StringVar(&createStorage, "storage", "", "Storage configuration")
+	createCmd.Flags().StringVar(&createStorage, "storage", "", "Storage configuration (virsh: disk image path on the NAS; VMM: storage name)")
+	createCmd.Flags().StringVar(&createNetwork, "network", "", "Network to attach the VM to (virsh: host bridge, e.g. ovs_eth0; VMM: network name)")
+	createCmd.Flags().IntVar(&createDiskSize, "disk-size", 0, "Virtual disk size in GB (VMM backends)")
+	createCmd.Flags().StringVar(&createISO, "iso", "", "ISO image to mount (VMM backends)")
+	createCmd.Flags().BoolVar(&createAutorun, "autorun", false, "Start the VM when the NAS boots")
+	createCmd.Flags().BoolVar(&createDryRun, "dry-run", false, "Print the definition that would be sent to the NAS without creating the VM")
 
 	createCmd.MarkFlagRequired("name") // nolint:errcheck // CLI flag setup
+
+	addTimeoutFlag(createCmd)
 }
 
 func runCreate(cmd *cobra.Command, args []string) error {
@@ -40,18 +55,30 @@ func runCreate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("VM name is required")
 	}
 
-	client, err := synology.NewClient()
-	if err != nil {
-		return fmt.Errorf("failed to create client: %w", err)
-	}
-
 	vmConfig := synology.VMConfig{
 		Name:     createName,
 		Template: createTemplate,
 		CPU:      createCPU,
 		Memory:   createMemory,
 		Storage:  createStorage,
+		Network:  createNetwork,
+		DiskSize: createDiskSize,
+		ISO:      createISO,
+		Autorun:  createAutorun,
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	if createDryRun {
+		return planCreate(ctx, vmConfig)
+	}
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
 	fmt.Printf("Creating VM: %s\n", createName)
 	fmt.Printf("  CPU: %d cores\n", createCPU)
@@ -60,10 +87,57 @@ func runCreate(cmd *cobra.Command, args []string) error {
 		fmt.Printf("  Template: %s\n", createTemplate)
 	}
 
-	if err := client.CreateVM(vmConfig); err != nil {
+	// The VMM backends report the ID of the new guest
+	if creator, ok := client.(synology.GuestCreator); ok {
+		result, err := creator.CreateGuest(ctx, vmConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create VM: %w", err)
+		}
+		fmt.Printf("VM %s created successfully (guest ID %s)\n", result.Name, result.GuestID)
+		return nil
+	}
+
+	if err := client.CreateVM(ctx, vmConfig); err != nil {
 		return fmt.Errorf("failed to create VM: %w", err)
 	}
 
 	fmt.Printf("VM %s created successfully\n", createName)
 	return nil
-}
\ No newline at end of file
+}
+
+// planCreate prints what create would send to the NAS. Only the VMM backends
+// need the NAS for that, to look up the default storage; probing for a
+// backend would too, so auto renders the virsh domain definition.
+func planCreate(ctx context.Context, config synology.VMConfig) error {
+	backend, err := synology.ParseBackend(viper.GetString("backend"))
+	if err != nil {
+		return err
+	}
+
+	var plan []byte
+	switch backend {
+	case synology.BackendWebAPI, synology.BackendSynoWebAPI:
+		client, err := newManager(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+		defer closeManager(client)
+
+		planner, ok := client.(synology.CreatePlanner)
+		if !ok {
+			return fmt.Errorf("--dry-run is not supported by the configured backend")
+		}
+		plan, err = planner.PlanCreate(ctx, config)
+	default:
+		if backend == synology.BackendAuto {
+			fmt.Fprintf(os.Stderr, "Showing the virsh domain definition; set the backend to %s or %s to see the VMM request instead\n",
+				synology.BackendWebAPI, synology.BackendSynoWebAPI)
+		}
+		plan, err = synology.BuildDomainXML(config)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to plan VM creation: %w", err)
+	}
+	fmt.Print(string(plan))
+	return nil
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/printer"
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
+)
+
+// eventsCmd represents the events command
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Stream VM lifecycle events",
+	Long: `Print VM lifecycle events as they happen: defined, undefined, started,
+suspended, resumed, stopped and crashed.
+
+With the virsh and synowebapi backends events are streamed from 'virsh
+event'. The webapi backend cannot push events, so it falls back to polling
+the VM list every --poll-interval and reporting the changes; changes that
+revert within one interval are missed.
+
+Events are printed one per line, or as JSON lines with -o json. --webhook
+additionally POSTs every event as a JSON object to a URL; failed deliveries
+are reported on stderr and do not stop the stream.`,
+	Args: cobra.NoArgs,
+	RunE: runEvents,
+}
+
+var (
+	eventsVMs          []string
+	eventsWebhook      string
+	eventsPollInterval time.Duration
+)
+
+// webhookTimeout bounds each webhook delivery
+const webhookTimeout = 10 * time.Second
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+
+	eventsCmd.Flags().StringSliceVar(&eventsVMs, "vm", nil, "Only show events for these VMs (comma-separated)")
+	eventsCmd.Flags().StringVar(&eventsWebhook, "webhook", "", "POST every event as JSON to this URL")
+	eventsCmd.Flags().DurationVar(&eventsPollInterval, "poll-interval", 5*time.Second, "How often to poll for changes with the webapi backend, which has no event stream")
+
+	addTimeoutFlag(eventsCmd)
+}
+
+func runEvents(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+	if format.Kind != printer.Table && format.Kind != printer.JSON {
+		return fmt.Errorf("events supports -o table or json, not %s", format.Kind)
+	}
+	if eventsPollInterval <= 0 {
+		return fmt.Errorf("--poll-interval must be positive")
+	}
+	if eventsWebhook != "" {
+		if u, err := url.Parse(eventsWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid --webhook URL %q: must be an http or https URL", eventsWebhook)
+		}
+	}
+
+	wanted := make(map[string]bool, len(eventsVMs))
+	for _, name := range eventsVMs {
+		wanted[name] = true
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+
+	handle := func(event synology.Event) {
+		if len(wanted) > 0 && !wanted[event.VM] {
+			return
+		}
+		if err := printEvent(os.Stdout, format, event); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to print event: %v\n", err)
+		}
+		if eventsWebhook != "" {
+			if err := postEvent(ctx, eventsWebhook, event); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+	}
+
+	if watcher, ok := client.(synology.EventWatcher); ok {
+		return watcher.WatchEvents(ctx, handle)
+	}
+	return synology.PollEvents(ctx, client, eventsPollInterval, handle)
+}
+
+// printEvent writes an event as one line of text or JSON
+func printEvent(w io.Writer, format printer.Format, event synology.Event) error {
+	if format.Kind == printer.JSON {
+		return json.NewEncoder(w).Encode(event)
+	}
+
+	line := fmt.Sprintf("%s  %-9s  %s", event.Time.Format(time.RFC3339), event.Type, event.VM)
+	if event.Detail != "" {
+		line += " (" + event.Detail + ")"
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
+
+// postEvent delivers an event to a webhook as a JSON object
+func postEvent(ctx context.Context, webhook string, event synology.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver event to webhook: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+func TestEventsJSONWithFilterAndWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var delivered []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		delivered = append(delivered, string(body))
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m := mock.NewMockClient()
+	m.Events = []synology.Event{
+		{Time: now, VM: "test-vm-1", Type: synology.EventStopped, Detail: "shutdown"},
+		{Time: now, VM: "test-vm-2", Type: synology.EventStarted, Detail: "booted"},
+	}
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, m, "events", "--vm", "test-vm-1", "-o", "json", "--webhook", hook.URL)
+	})
+	if err != nil {
+		t.Fatalf("events failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one event, got %q", out)
+	}
+	var event synology.Event
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatalf("event is not JSON: %v", err)
+	}
+	if event.VM != "test-vm-1" || event.Type != synology.EventStopped || !event.Time.Equal(now) {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delivered) != 1 || delivered[0] != lines[0] {
+		t.Errorf("expected the event to be delivered to the webhook, got %q", delivered)
+	}
+}
+
+func TestEventsText(t *testing.T) {
+	m := mock.NewMockClient()
+	m.Events = []synology.Event{
+		{Time: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), VM: "test-vm-1", Type: synology.EventCrashed, Detail: "panicked"},
+	}
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, m, "events")
+	})
+	if err != nil {
+		t.Fatalf("events failed: %v", err)
+	}
+	if want := "2026-10-16T12:00:00Z  crashed    test-vm-1 (panicked)\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestEventsRejectsInvalidFlags(t *testing.T) {
+	tests := [][]string{
+		{"events", "-o", "yaml"},
+		{"events", "--webhook", "nas.local/hook"},
+		{"events", "--poll-interval", "0s"},
+	}
+	for _, args := range tests {
+		if err := executeWithMock(t, mock.NewMockClient(), args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/exporter"
+	"github.com/spf13/cobra"
+)
+
+// exporterCmd represents the exporter command
+var exporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Serve Prometheus metrics for VMs and the NAS",
+	Long: `Run an HTTP server exposing the state and resource usage of every VM,
+plus NAS-level totals, in the Prometheus text format at /metrics.
+
+With the virsh and synowebapi backends the metrics come from 'virsh
+domstats', 'nodeinfo' and 'nodememstats' in a single round trip; the webapi
+backend reports state, vCPUs and memory only. Results are cached for --interval, so scrapes more
+frequent than that do not reach the NAS. A failed collection is reported
+as syno_vm_exporter_up 0.
+
+--once prints the metrics to stdout and exits, for testing or for the
+node_exporter textfile collector.`,
+	Args: cobra.NoArgs,
+	RunE: runExporter,
+}
+
+var (
+	exporterListen   string
+	exporterInterval time.Duration
+	exporterOnce     bool
+)
+
+func init() {
+	rootCmd.AddCommand(exporterCmd)
+
+	exporterCmd.Flags().StringVar(&exporterListen, "listen", ":9798", "Address to serve metrics on")
+	exporterCmd.Flags().DurationVar(&exporterInterval, "interval", 30*time.Second, "Minimum time between collections from the NAS")
+	exporterCmd.Flags().BoolVar(&exporterOnce, "once", false, "Print the metrics once and exit")
+}
+
+func runExporter(cmd *cobra.Command, args []string) error {
+	if exporterInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+
+	exp := exporter.New(client, exporterInterval)
+	if exporterOnce {
+		return exp.WriteMetrics(ctx, os.Stdout)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>syno-vm exporter</title></head><body><h1>syno-vm exporter</h1><p><a href="/metrics">Metrics</a></p></body></html>`)
+	})
+
+	srv := &http.Server{
+		Addr:              exporterListen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		stopped <- srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics\n", exporterListen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return <-stopped
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+func TestExporterOnce(t *testing.T) {
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "exporter", "--once")
+	})
+	if err != nil {
+		t.Fatalf("exporter --once failed: %v", err)
+	}
+	if !strings.Contains(out, "syno_vm_exporter_up 1\n") || !strings.Contains(out, `syno_vm_state{name="test-vm-1",state="running"} 1`) {
+		t.Errorf("unexpected metrics:\n%s", out)
+	}
+}
+
+func TestExporterRejectsInterval(t *testing.T) {
+	if err := executeWithMock(t, mock.NewMockClient(), "exporter", "--once", "--interval", "0s"); err == nil {
+		t.Fatal("expected a zero interval to be rejected")
+	}
+}
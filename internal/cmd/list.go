@@ -2,60 +2,167 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/spf13/cobra"
+	"github.com/scttfrdmn/syno-vm/internal/printer"
 	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
 )
 
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List virtual machines",
-	Long:  `List all virtual machines on the Synology NAS.`,
-	RunE:  runList,
+	Long: `List virtual machines on the Synology NAS.
+
+Stopped VMs are hidden unless --all is given. --state selects VMs by state
+instead (running, paused, shutting-down, stopped, crashed, suspended or
+unknown) and --name by a shell-style glob such as 'web-*'.`,
+	RunE: runList,
 }
 
 var (
-	listAll bool
+	listAll    bool
+	listStates []string
+	listName   string
+	listSortBy string
 )
 
+// vmSortKeys are the --sort-by values and how they order VMs
+var vmSortKeys = map[string]func(a, b synology.VM) bool{
+	"name":   func(a, b synology.VM) bool { return a.Name < b.Name },
+	"id":     func(a, b synology.VM) bool { return a.ID != 0 && (b.ID == 0 || a.ID < b.ID) },
+	"state":  func(a, b synology.VM) bool { return a.Status < b.Status },
+	"cpu":    func(a, b synology.VM) bool { return a.CPU < b.CPU },
+	"memory": func(a, b synology.VM) bool { return a.Memory < b.Memory },
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
 
 	listCmd.Flags().BoolVarP(&listAll, "all", "a", false, "Show all VMs including stopped ones")
+	listCmd.Flags().StringSliceVar(&listStates, "state", nil, "Only show VMs in these states (comma-separated)")
+	listCmd.Flags().StringVar(&listName, "name", "", "Only show VMs whose name matches this glob")
+	listCmd.Flags().StringVar(&listSortBy, "sort-by", "", "Sort by name, id, state, cpu or memory")
+
+	addTimeoutFlag(listCmd)
+}
+
+// vmList prints VMs
+var vmList = printer.List[synology.VM]{
+	Columns: []printer.Column[synology.VM]{
+		{Header: "ID", Value: func(vm synology.VM) string { return formatID(vm.ID) }},
+		{Header: "NAME", Value: func(vm synology.VM) string { return vm.Name }},
+		{Header: "STATUS", Value: func(vm synology.VM) string { return string(vm.Status) }},
+		{Header: "CPU", Value: func(vm synology.VM) string { return fmt.Sprintf("%d cores", vm.CPU) }},
+		{Header: "MEMORY", Value: func(vm synology.VM) string { return fmt.Sprintf("%d MB", vm.Memory) }},
+		{Header: "STORAGE", Wide: true, Value: func(vm synology.VM) string { return vm.Storage }},
+		{Header: "IP", Wide: true, Value: func(vm synology.VM) string { return vm.IPAddress }},
+	},
+	Name:  func(vm synology.VM) string { return vm.Name },
+	Empty: "No virtual machines found.",
 }
 
 func runList(cmd *cobra.Command, args []string) error {
-	client, err := synology.NewClient()
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	less, ok := vmSortKeys[listSortBy]
+	if listSortBy != "" && !ok {
+		return fmt.Errorf("invalid --sort-by %q: must be one of name, id, state, cpu, memory", listSortBy)
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
-	vms, err := client.ListVMs()
+	vms, err := client.ListVMs(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list VMs: %w", err)
 	}
 
-	if len(vms) == 0 {
-		fmt.Println("No virtual machines found.")
-		return nil
+	shown, err := filterVMs(vms, listAll, listStates, listName)
+	if err != nil {
+		return err
+	}
+
+	if less != nil {
+		sort.SliceStable(shown, func(i, j int) bool { return less(shown[i], shown[j]) })
 	}
 
-	// Print header
-	fmt.Printf("%-20s %-15s %-10s %-15s\n", "NAME", "STATUS", "CPU", "MEMORY")
-	fmt.Println("------------------------------------------------------------")
+	return vmList.Print(os.Stdout, format, shown)
+}
 
-	// Print VMs
+// validState reports whether state is one of the normalised states
+func validState(state synology.VMState) bool {
+	for _, s := range synology.VMStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// filterVMs returns the VMs matching the list filters. Without states, all
+// VMs are shown if all is set and all but stopped ones otherwise.
+func filterVMs(vms []synology.VM, all bool, states []string, namePattern string) ([]synology.VM, error) {
+	if namePattern != "" {
+		if _, err := path.Match(namePattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --name pattern %q: %w", namePattern, err)
+		}
+	}
+
+	wanted := make(map[synology.VMState]bool)
+	for _, s := range states {
+		state := synology.ParseVMState(s)
+		if !validState(state) {
+			names := make([]string, len(synology.VMStates))
+			for i, v := range synology.VMStates {
+				names[i] = string(v)
+			}
+			return nil, fmt.Errorf("invalid --state %q: must be one of %s", s, strings.Join(names, ", "))
+		}
+		wanted[state] = true
+	}
+
+	var shown []synology.VM
 	for _, vm := range vms {
-		if !listAll && vm.Status == "stopped" {
+		switch {
+		case len(wanted) > 0:
+			if !wanted[vm.Status] {
+				continue
+			}
+		case !all && vm.Status == synology.StateStopped:
 			continue
 		}
-		fmt.Printf("%-20s %-15s %-10s %-15s\n",
-			vm.Name,
-			vm.Status,
-			fmt.Sprintf("%d cores", vm.CPU),
-			fmt.Sprintf("%d MB", vm.Memory))
+
+		if namePattern != "" {
+			if ok, _ := path.Match(namePattern, vm.Name); !ok {
+				continue
+			}
+		}
+
+		shown = append(shown, vm)
 	}
 
-	return nil
-}
\ No newline at end of file
+	return shown, nil
+}
+
+// formatID formats a libvirt domain ID, which inactive domains do not have
+func formatID(id int) string {
+	if id == 0 {
+		return "-"
+	}
+	return strconv.Itoa(id)
+}
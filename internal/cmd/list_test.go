@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+func TestFilterVMs(t *testing.T) {
+	vms := []synology.VM{
+		{Name: "web-01", Status: synology.StateRunning},
+		{Name: "web-02", Status: synology.StateStopped},
+		{Name: "db-01", Status: synology.StatePaused},
+	}
+
+	tests := []struct {
+		name    string
+		all     bool
+		states  []string
+		pattern string
+		want    []string
+		wantErr bool
+	}{
+		{name: "hides stopped by default", want: []string{"web-01", "db-01"}},
+		{name: "all", all: true, want: []string{"web-01", "web-02", "db-01"}},
+		{name: "state", states: []string{"stopped"}, want: []string{"web-02"}},
+		{name: "libvirt state name", states: []string{"shut off", "paused"}, want: []string{"web-02", "db-01"}},
+		{name: "name glob", all: true, pattern: "web-*", want: []string{"web-01", "web-02"}},
+		{name: "glob and state", states: []string{"running"}, pattern: "db-*"},
+		{name: "unknown state", states: []string{"runing"}, wantErr: true},
+		{name: "invalid glob", pattern: "web-[", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shown, err := filterVMs(vms, tt.all, tt.states, tt.pattern)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected filterVMs() to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("filterVMs() error = %v", err)
+			}
+
+			var names []string
+			for _, vm := range shown {
+				names = append(names, vm.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestListSortAndID(t *testing.T) {
+	m := mock.NewMockClient()
+	m.VMs[0].ID = 4
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, m, "list", "--all", "--sort-by", "memory", "-o", "template={{.Name}} {{.Memory}}")
+	})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if out != "test-vm-1 2048\ntest-vm-2 4096\n" {
+		t.Errorf("unexpected sorted output %q", out)
+	}
+
+	out, err = captureStdout(t, func() error {
+		return executeWithMock(t, m, "list", "--all")
+	})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	lines := strings.Split(out, "\n")
+	if !strings.HasPrefix(lines[0], "ID") || !strings.HasPrefix(lines[1], "4 ") || !strings.HasPrefix(lines[2], "- ") {
+		t.Errorf("expected an ID column, got:\n%s", out)
+	}
+
+	if err := executeWithMock(t, m, "list", "--sort-by", "colour"); err == nil {
+		t.Error("expected an unknown sort key to fail")
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to the DSM Web API and cache the session",
+	Long: `Log in to the DSM Web API of the selected context and cache the session,
+so later commands reuse it instead of logging in again. Commands log in
+again by themselves when DSM expires the session. A cached session DSM
+still accepts is kept; one it rejects is logged out and replaced.
+
+Logging in once interactively also answers 2-step verification before
+commands run from scripts.`,
+	Args: cobra.NoArgs,
+	RunE: runLogin,
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "End the cached DSM Web API session",
+	Long: `End the Web API session cached for the selected context on the NAS and
+remove it from the cache.`,
+	Args: cobra.NoArgs,
+	RunE: runLogout,
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+
+	addTimeoutFlag(loginCmd, logoutCmd)
+}
+
+func runLogin(cmd *cobra.Command, args []string) error {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := synology.NewWebAPIClientFromConfig()
+	if err != nil {
+		return err
+	}
+	kept, err := client.Refresh(ctx)
+	if err != nil {
+		return err
+	}
+
+	if kept {
+		fmt.Printf("Already logged in to %s as %s\n", viper.GetString("host"), viper.GetString("username"))
+	} else {
+		fmt.Printf("Logged in to %s as %s\n", viper.GetString("host"), viper.GetString("username"))
+	}
+	fmt.Printf("Session cached for context %s\n", activeContext)
+	return nil
+}
+
+func runLogout(cmd *cobra.Command, args []string) error {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := synology.NewWebAPIClientFromConfig()
+	if err != nil {
+		return err
+	}
+	if !client.HasSession() {
+		fmt.Printf("No cached session for context %s\n", activeContext)
+		return nil
+	}
+
+	// The cached session is dropped even if DSM cannot be reached
+	if err := client.Logout(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to end the session on %s: %v\n", viper.GetString("host"), err)
+	}
+	fmt.Printf("Logged out of %s\n", viper.GetString("host"))
+	return nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+func TestLogoutWithoutSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "contexts:\n  lab:\n    host: nas.local\n    username: admin\n    password: s3cret\ncurrent-context: lab\n"
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "--config", path, "logout")
+	})
+	if err != nil || !strings.Contains(out, "No cached session for context lab") {
+		t.Errorf("logout = %q, %v", out, err)
+	}
+
+	// Deleting the context drops its cached session
+	sessionPath := filepath.Join(filepath.Dir(path), "sessions", "lab.json")
+	if err := synology.NewSessionCache(sessionPath).Save(synology.Session{Account: "admin@nas.local", SID: "sid-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "--config", path, "config", "delete-context", "lab")
+	}); err != nil {
+		t.Fatalf("delete-context failed: %v", err)
+	}
+	if _, err := os.Stat(sessionPath); !os.IsNotExist(err) {
+		t.Errorf("session cache of a deleted context still exists: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/scttfrdmn/syno-vm/internal/manifest"
+	"github.com/scttfrdmn/syno-vm/internal/printer"
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan -f FILE",
+	Short: "Show the changes needed to match a manifest",
+	Long: `Compare the VMs on the NAS with a YAML manifest and print the changes
+'syno-vm apply' would make, without changing anything.
+
+A manifest lists the desired VMs:
+
+  vms:
+    - name: web-01
+      cpu: 2
+      memory: 2048          # MB
+      disks:
+        - storage: /volume1/vms/web-01.qcow2
+      nics:
+        - network: ovs_eth0
+      template: /volume1/iso/ubuntu.iso   # only used when creating
+      autostart: true
+      state: running        # running or stopped; unmanaged if omitted
+
+VMs missing from the NAS are created and differing vCPUs, memory and
+autostart are updated. VMs on the NAS that the manifest does not list are
+left alone unless --prune is given. Disks and NICs cannot be changed after
+creation; differences are reported as warnings.`,
+	Args: cobra.NoArgs,
+	RunE: runPlan,
+}
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply -f FILE",
+	Short: "Create, update, start, stop or delete VMs to match a manifest",
+	Long: `Compute the plan for a YAML manifest, as 'syno-vm plan' does, and
+execute it. Applying the same manifest again makes no further changes.
+
+Deleting VMs with --prune asks for confirmation unless --yes is given.
+See 'syno-vm plan --help' for the manifest format.`,
+	Args: cobra.NoArgs,
+	RunE: runApply,
+}
+
+var (
+	manifestFile  string
+	manifestPrune bool
+	applyYes      bool
+)
+
+func init() {
+	rootCmd.AddCommand(planCmd, applyCmd)
+
+	for _, c := range []*cobra.Command{planCmd, applyCmd} {
+		c.Flags().StringVarP(&manifestFile, "filename", "f", "", "Manifest file, or - for standard input (required)")
+		c.Flags().BoolVar(&manifestPrune, "prune", false, "Delete VMs that the manifest does not list")
+		c.MarkFlagRequired("filename") // nolint:errcheck // CLI flag setup
+	}
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Delete VMs without confirmation")
+
+	addTimeoutFlag(planCmd, applyCmd)
+}
+
+// loadPlan reads the manifest and computes its plan against the NAS
+func loadPlan(ctx context.Context, client synology.VMManager) (*manifest.Plan, error) {
+	m, err := manifest.Load(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := manifest.Diff(ctx, client, m, manifest.Options{Prune: manifestPrune})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute plan: %w", err)
+	}
+	return plan, nil
+}
+
+func runPlan(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+
+	plan, err := loadPlan(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, c := range plan.Changes {
+		names = append(names, c.VM)
+	}
+	return printer.PrintObject(os.Stdout, format, plan, strings.Join(names, "\n"), func(w io.Writer) error {
+		return printPlan(w, plan)
+	})
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+
+	plan, err := loadPlan(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	if err := printPlan(os.Stdout, plan); err != nil {
+		return err
+	}
+	if len(plan.Changes) == 0 {
+		return nil
+	}
+
+	if n := plan.Count(manifest.ActionDelete); n > 0 && !applyYes && !confirm(fmt.Sprintf("Delete %d VM(s)?", n)) {
+		fmt.Println("Apply cancelled")
+		return nil
+	}
+
+	fmt.Println()
+	err = manifest.Apply(ctx, client, plan, func(c manifest.Change) {
+		fmt.Printf("%s %s...\n", actionVerbs[c.Action], c.VM)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Apply complete")
+	return nil
+}
+
+// actionSymbols prefix the changes of a printed plan
+var actionSymbols = map[manifest.Action]string{
+	manifest.ActionCreate: "+",
+	manifest.ActionUpdate: "~",
+	manifest.ActionStart:  ">",
+	manifest.ActionStop:   "<",
+	manifest.ActionDelete: "-",
+}
+
+// actionVerbs describe changes while they are applied
+var actionVerbs = map[manifest.Action]string{
+	manifest.ActionCreate: "Creating",
+	manifest.ActionUpdate: "Updating",
+	manifest.ActionStart:  "Starting",
+	manifest.ActionStop:   "Stopping",
+	manifest.ActionDelete: "Deleting",
+}
+
+// printPlan prints the changes and warnings of a plan and a summary
+func printPlan(w io.Writer, plan *manifest.Plan) error {
+	for _, c := range plan.Changes {
+		fmt.Fprintf(w, "%s %s %s\n", actionSymbols[c.Action], c.Action, c.VM)
+		for _, d := range c.Details {
+			fmt.Fprintf(w, "    %s\n", d)
+		}
+	}
+	for _, warning := range plan.Warnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+
+	if len(plan.Changes) == 0 {
+		_, err := fmt.Fprintln(w, "No changes: the NAS matches the manifest.")
+		return err
+	}
+
+	counts := make([]string, 0, len(manifest.Actions))
+	for _, a := range manifest.Actions {
+		counts = append(counts, fmt.Sprintf("%d to %s", plan.Count(a), a))
+	}
+	_, err := fmt.Fprintf(w, "\nPlan: %s.\n", strings.Join(counts, ", "))
+	return err
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+// writeManifest writes a manifest to a temporary file and returns its path
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vms.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testManifestYAML = `vms:
+  - name: test-vm-1
+    cpu: 2
+    memory: 2048
+  - name: web-03
+    cpu: 2
+    memory: 1024
+    disks:
+      - storage: /volume1/vms/web-03.qcow2
+    state: running
+`
+
+func TestPlanAndApply(t *testing.T) {
+	m := mock.NewMockClient()
+	path := writeManifest(t, testManifestYAML)
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, m, "plan", "-f", path, "--prune")
+	})
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	for _, want := range []string{"+ create web-03", "> start web-03", "- delete test-vm-2", "Plan: 1 to create, 0 to update, 1 to start, 0 to stop, 1 to delete."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan output missing %q:\n%s", want, out)
+		}
+	}
+	if len(m.VMs) != 2 {
+		t.Fatal("plan changed the VMs")
+	}
+
+	out, err = captureStdout(t, func() error {
+		return executeWithMock(t, m, "apply", "-f", path, "--prune", "--yes")
+	})
+	if err != nil {
+		t.Fatalf("apply failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Apply complete") {
+		t.Errorf("unexpected apply output:\n%s", out)
+	}
+	if vm := findVM(m, "web-03"); vm == nil || vm.Status != "running" {
+		t.Errorf("web-03 was not created and started: %+v", vm)
+	}
+	if findVM(m, "test-vm-2") != nil {
+		t.Error("test-vm-2 was not pruned")
+	}
+
+	out, err = captureStdout(t, func() error {
+		return executeWithMock(t, m, "plan", "-f", path, "--prune")
+	})
+	if err != nil || !strings.Contains(out, "No changes") {
+		t.Errorf("expected no changes after apply, got %v:\n%s", err, out)
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	path := writeManifest(t, testManifestYAML)
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "plan", "-f", path, "-o", "json")
+	})
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+
+	var plan struct {
+		Changes []struct {
+			Action string `json:"action"`
+			VM     string `json:"vm"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal([]byte(out), &plan); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if len(plan.Changes) != 2 || plan.Changes[0].Action != "create" || plan.Changes[0].VM != "web-03" {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+}
+
+func TestPlanInvalidManifest(t *testing.T) {
+	path := writeManifest(t, "vms:\n  - name: a\n    cpus: 2\n")
+	if err := executeWithMock(t, mock.NewMockClient(), "plan", "-f", path); err == nil {
+		t.Fatal("expected an invalid manifest to be rejected")
+	}
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
+)
+
+// powerAction describes a single-VM power operation command
+type powerAction struct {
+	use   string
+	short string
+	long  string
+	// verb and done complete "failed to <verb> VM" and "VM <name> <done>"
+	verb string
+	done string
+	// state is what --wait waits for; empty means the command has no --wait
+	state synology.VMState
+	run   func(ctx context.Context, client synology.VMManager, vmName string) error
+}
+
+// managerMethod adapts a VMManager method expression, which takes the
+// manager first, to powerAction.run
+func managerMethod(method func(synology.VMManager, context.Context, string) error) func(context.Context, synology.VMManager, string) error {
+	return func(ctx context.Context, client synology.VMManager, vmName string) error {
+		return method(client, ctx, vmName)
+	}
+}
+
+var powerActions = []powerAction{
+	{
+		use:   "poweroff <vm-name>",
+		short: "Forcibly power off a virtual machine",
+		long: `Immediately power off a virtual machine, like pulling the plug.
+
+The guest is not asked to shut down and may lose unsaved data. Use this for
+hung guests; use 'stop' for a graceful shutdown.`,
+		verb:  "power off",
+		done:  "powered off",
+		state: synology.StateStopped,
+		run:   managerMethod(synology.VMManager.PowerOffVM),
+	},
+	{
+		use:   "reset <vm-name>",
+		short: "Hard-reset a virtual machine",
+		long: `Reset a virtual machine as if its reset button had been pressed.
+
+The guest is not asked to shut down first. Use 'restart' for a graceful
+reboot. Like 'restart', the VM does not leave the running state, so there is
+no --wait.`,
+		verb: "reset",
+		done: "reset",
+		run:  managerMethod(synology.VMManager.ResetVM),
+	},
+	{
+		use:   "pause <vm-name>",
+		short: "Pause a running virtual machine",
+		long: `Suspend a running virtual machine in memory. It keeps its memory but
+gets no CPU time until it is resumed with 'resume'.`,
+		verb:  "pause",
+		done:  "paused",
+		state: synology.StatePaused,
+		run:   managerMethod(synology.VMManager.PauseVM),
+	},
+	{
+		use:   "resume <vm-name>",
+		short: "Resume a paused virtual machine",
+		long:  `Resume a virtual machine paused with 'pause'.`,
+		verb:  "resume",
+		done:  "resumed",
+		state: synology.StateRunning,
+		run:   managerMethod(synology.VMManager.ResumeVM),
+	},
+	{
+		use:   "save <vm-name>",
+		short: "Save a virtual machine's state to disk",
+		long: `Save the memory state of a running virtual machine to disk and stop it.
+Use 'restore' to continue where it left off, for example after NAS
+maintenance.`,
+		verb:  "save",
+		done:  "saved",
+		state: synology.StateStopped,
+		run:   managerMethod(synology.VMManager.SaveVM),
+	},
+	{
+		use:   "restore <vm-name>",
+		short: "Restore a virtual machine saved with 'save'",
+		long:  `Start a virtual machine from the state saved with 'save'.`,
+		verb:  "restore",
+		done:  "restored",
+		state: synology.StateRunning,
+		run:   managerMethod(synology.VMManager.RestoreVM),
+	},
+}
+
+func init() {
+	for _, action := range powerActions {
+		c := newPowerCommand(action)
+		rootCmd.AddCommand(c)
+		addTimeoutFlag(c)
+		if action.state != "" {
+			addWaitFlags(c)
+		}
+	}
+}
+
+// newPowerCommand builds the command for a power action
+func newPowerCommand(action powerAction) *cobra.Command {
+	return &cobra.Command{
+		Use:   action.use,
+		Short: action.short,
+		Long:  action.long,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPowerAction(cmd, action, args[0])
+		},
+	}
+}
+
+func runPowerAction(cmd *cobra.Command, action powerAction, vmName string) error {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+
+	if err := action.run(ctx, client, vmName); err != nil {
+		return fmt.Errorf("failed to %s VM: %w", action.verb, err)
+	}
+
+	if action.state != "" {
+		if _, err := waitForState(ctx, cmd, client, vmName, action.state); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("VM %s %s\n", vmName, action.done)
+	return nil
+}
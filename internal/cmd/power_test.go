@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+func TestPowerCommandsWithMock(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       [][]string
+		wantErr    bool
+		wantStatus synology.VMState
+	}{
+		{
+			name:       "poweroff",
+			args:       [][]string{{"poweroff", "test-vm-1", "--wait"}},
+			wantStatus: "stopped",
+		},
+		{
+			name:       "reset",
+			args:       [][]string{{"reset", "test-vm-1"}},
+			wantStatus: "running",
+		},
+		{
+			name:    "reset has no wait",
+			args:    [][]string{{"reset", "test-vm-1", "--wait"}},
+			wantErr: true,
+		},
+		{
+			name:       "pause and wait",
+			args:       [][]string{{"pause", "test-vm-1", "--wait"}},
+			wantStatus: "paused",
+		},
+		{
+			name:       "pause and resume",
+			args:       [][]string{{"pause", "test-vm-1"}, {"resume", "test-vm-1", "--wait"}},
+			wantStatus: "running",
+		},
+		{
+			name:       "save",
+			args:       [][]string{{"save", "test-vm-1"}},
+			wantStatus: "stopped",
+		},
+		{
+			name:       "save and restore",
+			args:       [][]string{{"save", "test-vm-1"}, {"restore", "test-vm-1"}},
+			wantStatus: "running",
+		},
+		{
+			name:    "resume running VM",
+			args:    [][]string{{"resume", "test-vm-1"}},
+			wantErr: true,
+		},
+		{
+			name:    "poweroff missing VM",
+			args:    [][]string{{"poweroff", "missing"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mock.NewMockClient()
+
+			var err error
+			for _, args := range tt.args {
+				if err = executeWithMock(t, m, args...); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantStatus != "" {
+				if vm := findVM(m, "test-vm-1"); vm.Status != tt.wantStatus {
+					t.Errorf("expected status %s, got %s", tt.wantStatus, vm.Status)
+				}
+			}
+		})
+	}
+}
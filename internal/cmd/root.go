@@ -1,24 +1,45 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/scttfrdmn/syno-vm/internal/config"
+	"github.com/scttfrdmn/syno-vm/internal/printer"
+	"github.com/scttfrdmn/syno-vm/internal/synology"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	cfgFile string
-	verbose bool
+	cfgFile     string
+	contextName string
+	verbose     bool
+	output      string
+
+	// Set by initConfig
+	configFile    *config.File
+	activeContext string
+	configErr     error // reported before any command runs
 
 	// Version info set by main
-	appVersion = "0.1.0"
+	appVersion  = "0.1.0"
 	buildCommit = "unknown"
-	buildDate = "unknown"
-	builtBy = "unknown"
+	buildDate   = "unknown"
+	builtBy     = "unknown"
 )
 
+// newManager creates the VM manager used by commands. Tests replace it to run
+// the command tree against a mock backend.
+var newManager = synology.NewManager
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "syno-vm",
@@ -29,12 +50,104 @@ start, stop, and manage VMs through Synology's VMM API.
 
 This tool is adapted from qnap-vm for Synology DSM 7.x+ systems.`,
 	Version: appVersion,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if errors.Is(configErr, errContextNotFound) && cmd.Annotations[anyContext] != "" {
+			return nil
+		}
+		return configErr
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The first interrupt cancels the running command's context; a second one
+// terminates the process immediately.
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return rootCmd.ExecuteContext(ctx)
+}
+
+// Exit codes for the failures scripts most often need to tell apart. Any
+// other error exits with 1.
+const (
+	exitError        = 1
+	exitNotFound     = 3
+	exitAuth         = 4
+	exitPermission   = 5
+	exitConflict     = 6
+	exitNotAvailable = 7
+	exitBusy         = 8
+)
+
+// exitCodes maps the errors shared by every backend to exit codes
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{synology.ErrGuestNotFound, exitNotFound},
+	{synology.ErrInvalidCredentials, exitAuth},
+	{synology.ErrAccountDisabled, exitAuth},
+	{synology.ErrPasswordExpired, exitAuth},
+	{synology.ErrOTPRequired, exitAuth},
+	{synology.ErrOTPInvalid, exitAuth},
+	{synology.ErrOTPEnforced, exitAuth},
+	{synology.ErrSessionExpired, exitAuth},
+	{synology.ErrPermissionDenied, exitPermission},
+	{synology.ErrGuestRunning, exitConflict},
+	{synology.ErrGuestStopped, exitConflict},
+	{synology.ErrNameConflict, exitConflict},
+	{synology.ErrAPINotAvailable, exitNotAvailable},
+	{synology.ErrBusy, exitBusy},
+}
+
+// ExitCode returns the process exit code for an error returned by Execute
+func ExitCode(err error) int {
+	for _, e := range exitCodes {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+	return exitError
+}
+
+// addTimeoutFlag adds a --timeout flag bounding how long each command may run
+func addTimeoutFlag(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().Duration("timeout", 0, "Give up after this long, e.g. 30s or 5m (0 means no limit)")
+	}
+}
+
+// commandContext returns the context a command should run under: cancelled
+// on interrupt and, if --timeout is set, after that duration
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if d, err := cmd.Flags().GetDuration("timeout"); err == nil && d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// outputFormat returns the format selected with -o/--output
+func outputFormat() (printer.Format, error) {
+	return printer.Parse(output)
+}
+
+// closeManager releases the connection held by a VM manager, if any
+func closeManager(client synology.VMManager) {
+	if closer, ok := client.(io.Closer); ok {
+		_ = closer.Close()
+	}
 }
 
 // SetVersionInfo sets the version information from build-time variables
@@ -59,45 +172,91 @@ func init() {
 
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.syno-vm/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&contextName, "context", "", "config context to use (default is the current context, or $SYNO_VM_CONTEXT)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().Bool("insecure-skip-host-key-check", false, "do not verify the NAS SSH host key (insecure)")
+	rootCmd.PersistentFlags().String("otp-code", "", "2-step verification code for the Web API login, if DSM asks for one")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", string(printer.Table), "output format: table, wide, json, yaml, name or template=<go template>")
 
 	// Bind flags to viper
-	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose")) // nolint:errcheck // CLI setup
+	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))                                           // nolint:errcheck // CLI setup
+	viper.BindPFlag("insecure_skip_host_key_check", rootCmd.PersistentFlags().Lookup("insecure-skip-host-key-check")) // nolint:errcheck // CLI setup
+	viper.BindPFlag("otp_code", rootCmd.PersistentFlags().Lookup("otp-code"))                                         // nolint:errcheck // CLI setup
 }
 
-// initConfig reads in config file and ENV variables.
+// errContextNotFound is reported when --context or SYNO_VM_CONTEXT names a
+// context the config file does not have
+var errContextNotFound = errors.New("context not found")
+
+// anyContext annotates commands that manage contexts, which still run when
+// the selected context does not exist
+const anyContext = "anyContext"
+
+// initConfig reads the config file, selects the context and loads its
+// settings and environment variables into viper
 func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := os.UserHomeDir()
+	configErr = nil
+
+	path := cfgFile
+	if path == "" {
+		p, err := config.DefaultPath()
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+		path = p
+	}
 
-		// Search config in home directory with name ".syno-vm" (without extension).
-		configDir := home + "/.syno-vm"
-		viper.AddConfigPath(configDir)
-		viper.SetConfigType("yaml")
-		viper.SetConfigName("config")
-
-		// Create config directory if it doesn't exist
-		if _, err := os.Stat(configDir); os.IsNotExist(err) {
-			_ = os.MkdirAll(configDir, 0755) // Best effort directory creation
+	file, migrated, err := config.Load(path)
+	if err != nil {
+		configErr = err
+		file = config.New(path)
+	}
+	if migrated {
+		if err := file.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save migrated config: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Moved the settings in %s into context %q\n", path, config.DefaultContext)
 		}
 	}
+	configFile = file
 
-	viper.AutomaticEnv() // read in environment variables that match
+	requested := contextName
+	if requested == "" {
+		requested = os.Getenv("SYNO_VM_CONTEXT")
+	}
+	activeContext = file.Resolve(requested)
+	// The name becomes part of the session cache path
+	nameErr := config.ValidateContextName(activeContext)
+	if nameErr != nil && configErr == nil {
+		configErr = nameErr
+	}
+	if _, ok := file.Contexts[activeContext]; !ok && requested != "" && configErr == nil {
+		configErr = fmt.Errorf("%w: %q; create it with 'syno-vm config add-context %s'", errContextNotFound, activeContext, activeContext)
+	}
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil && verbose {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	// viper sees the settings of the selected context as its config file
+	settings := file.Settings(activeContext)
+	if nameErr == nil {
+		settings["session_file"] = file.SessionPath(activeContext)
+	}
+	data, err := yaml.Marshal(settings)
+	if err == nil {
+		viper.SetConfigType("yaml")
+		err = viper.ReadConfig(bytes.NewReader(data))
+	}
+	if err != nil && configErr == nil {
+		configErr = fmt.Errorf("failed to load context %q: %w", activeContext, err)
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Using config file %s, context %s\n", path, activeContext)
 	}
 
+	viper.AutomaticEnv() // read in environment variables that match
+
 	// Set default values
 	viper.SetDefault("port", 22)
 	viper.SetDefault("timeout", 30)
-}
\ No newline at end of file
+	viper.SetDefault("keepalive_interval", 30)
+	viper.SetDefault("backend", string(synology.BackendAuto))
+}
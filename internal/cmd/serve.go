@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/server"
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a REST API for managing VMs",
+	Long: `Run an HTTP server exposing VM management as a JSON REST API, for
+dashboards and CI runners that should not shell out to the CLI.
+
+The server listens on a loopback address (--listen) or a unix socket
+(--socket). On a TCP address every request needs the header
+"Authorization: Bearer <token>"; the token is taken from --token or
+SYNO_VM_API_TOKEN, or generated and printed at startup. A unix socket is
+only accessible to the current user and needs no token unless one is given.
+
+The OpenAPI document is served at /openapi.json and printed by
+--print-openapi.`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+var (
+	serveListen       string
+	serveSocket       string
+	serveToken        string
+	servePrintOpenAPI bool
+)
+
+// serveShutdownTimeout bounds how long in-flight requests may take to finish
+// once the server is asked to stop
+const serveShutdownTimeout = 30 * time.Second
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8080", "Loopback address to listen on")
+	serveCmd.Flags().StringVar(&serveSocket, "socket", "", "Listen on this unix socket instead of --listen")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "Bearer token clients must send (default $SYNO_VM_API_TOKEN)")
+	serveCmd.Flags().BoolVar(&servePrintOpenAPI, "print-openapi", false, "Print the OpenAPI document and exit")
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	token := serveToken
+	if token == "" {
+		token = os.Getenv("SYNO_VM_API_TOKEN")
+	}
+
+	if servePrintOpenAPI {
+		doc := server.New(nil, server.Options{Token: token, Version: appVersion}).OpenAPI()
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+
+	if serveSocket == "" {
+		if err := checkLoopback(serveListen); err != nil {
+			return err
+		}
+		if token == "" {
+			generated, err := generateToken()
+			if err != nil {
+				return err
+			}
+			token = generated
+			fmt.Fprintf(os.Stderr, "API token: %s\n", token)
+		}
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+
+	ln, err := serveListener(serveListen, serveSocket)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           server.New(client, server.Options{Token: token, Version: appVersion}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		stopped <- srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving API on %s\n", ln.Addr())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return <-stopped
+}
+
+// checkLoopback refuses TCP addresses reachable from other hosts. The API
+// grants full control over the NAS's VMs, so it is not exposed directly.
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", address, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("refusing to listen on %q: only loopback addresses are allowed; put a reverse proxy in front for remote access", address)
+}
+
+// serveListener listens on the unix socket if one is given, or on the TCP
+// address otherwise
+func serveListener(address, socket string) (net.Listener, error) {
+	if socket == "" {
+		ln, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+		}
+		return ln, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if conn, err := net.Dial("unix", socket); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("another server is already listening on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socket, err)
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+// generateToken returns a random API token
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
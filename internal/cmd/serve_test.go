@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+func TestCheckLoopback(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{"127.0.0.1:8080", false},
+		{"[::1]:8080", false},
+		{"localhost:8080", false},
+		{"0.0.0.0:8080", true},
+		{":8080", true},
+		{"192.168.1.10:8080", true},
+		{"nas.local:8080", true},
+		{"127.0.0.1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := checkLoopback(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkLoopback(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServePrintOpenAPI(t *testing.T) {
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, mock.NewMockClient(), "serve", "--print-openapi")
+	})
+	if err != nil {
+		t.Fatalf("serve --print-openapi failed: %v", err)
+	}
+
+	var doc struct {
+		Paths map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if _, ok := doc.Paths["/v1/vms/{name}/start"]; !ok {
+		t.Errorf("expected the start endpoint in %v", doc.Paths)
+	}
+}
+
+func TestServeRefusesRemoteAddress(t *testing.T) {
+	err := executeWithMock(t, mock.NewMockClient(), "serve", "--listen", "0.0.0.0:0")
+	if err == nil {
+		t.Fatal("expected serving on a non-loopback address to fail")
+	}
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/scttfrdmn/syno-vm/internal/printer"
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage VM snapshots",
+	Long: `Manage virtual machine snapshots.
+
+Snapshots require the virsh or synowebapi backend.`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <vm-name>",
+	Short: "Take a snapshot of a VM",
+	Long: `Take a snapshot of a virtual machine.
+
+With --quiesce the guest's filesystems are frozen while the snapshot is taken,
+which requires the QEMU guest agent to be running in the guest.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSnapshotCreate,
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list <vm-name>",
+	Short: "List the snapshots of a VM",
+	Long:  `List the snapshots of a virtual machine as a tree. The current snapshot is marked with '*'.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSnapshotList,
+}
+
+var snapshotRevertCmd = &cobra.Command{
+	Use:   "revert <vm-name> <snapshot-name>",
+	Short: "Revert a VM to a snapshot",
+	Long:  `Revert a virtual machine to a snapshot. Changes made since the snapshot are lost.`,
+	Args:  cobra.ExactArgs(2),
+	RunE:  runSnapshotRevert,
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <vm-name> <snapshot-name>",
+	Short: "Delete a snapshot",
+	Long:  `Delete a snapshot of a virtual machine. Its child snapshots are kept.`,
+	Args:  cobra.ExactArgs(2),
+	RunE:  runSnapshotDelete,
+}
+
+var (
+	snapshotName        string
+	snapshotDescription string
+	snapshotQuiesce     bool
+	snapshotForce       bool
+)
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRevertCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+
+	snapshotCreateCmd.Flags().StringVar(&snapshotName, "name", "", "Name of the snapshot (generated if not set)")
+	snapshotCreateCmd.Flags().StringVarP(&snapshotDescription, "description", "d", "", "Description of the snapshot")
+	snapshotCreateCmd.Flags().BoolVar(&snapshotQuiesce, "quiesce", false, "Freeze guest filesystems via the guest agent")
+
+	snapshotRevertCmd.Flags().BoolVarP(&snapshotForce, "force", "f", false, "Revert without confirmation")
+	snapshotDeleteCmd.Flags().BoolVarP(&snapshotForce, "force", "f", false, "Delete without confirmation")
+
+	addTimeoutFlag(snapshotCreateCmd, snapshotListCmd, snapshotRevertCmd, snapshotDeleteCmd)
+}
+
+// snapshotManager returns the client's snapshot support, if it has any
+func snapshotManager(client synology.VMManager) (synology.SnapshotManager, error) {
+	sm, ok := client.(synology.SnapshotManager)
+	if !ok {
+		return nil, fmt.Errorf("snapshots are not supported by the configured backend; use the virsh or synowebapi backend")
+	}
+	return sm, nil
+}
+
+// confirm asks a yes/no question on the terminal
+func confirm(question string) bool {
+	fmt.Printf("%s (y/N): ", question)
+	var response string
+	_, _ = fmt.Scanln(&response) // Ignore input errors for confirmation
+	return response == "y" || response == "Y" || response == "yes"
+}
+
+func runSnapshotCreate(cmd *cobra.Command, args []string) error {
+	vmName := args[0]
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+	sm, err := snapshotManager(client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Creating snapshot of VM: %s\n", vmName)
+
+	opts := synology.SnapshotOptions{
+		Name:        snapshotName,
+		Description: snapshotDescription,
+		Quiesce:     snapshotQuiesce,
+	}
+	if err := sm.CreateSnapshot(ctx, vmName, opts); err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	fmt.Println("Snapshot created successfully")
+	return nil
+}
+
+// snapshotList prints snapshots for the structured output formats; tables
+// are printed as a tree by printSnapshotTree
+var snapshotList = printer.List[synology.Snapshot]{
+	Name: func(s synology.Snapshot) string { return s.Name },
+}
+
+func runSnapshotList(cmd *cobra.Command, args []string) error {
+	vmName := args[0]
+
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+	sm, err := snapshotManager(client)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := sm.ListSnapshots(ctx, vmName)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	if !format.IsTable() {
+		return snapshotList.Print(os.Stdout, format, snapshots)
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Printf("No snapshots found for VM %s.\n", vmName)
+		return nil
+	}
+
+	return printSnapshotTree(os.Stdout, snapshots)
+}
+
+// printSnapshotTree prints snapshots with each child indented under its
+// parent, siblings ordered by creation time
+func printSnapshotTree(w io.Writer, snapshots []synology.Snapshot) error {
+	children := make(map[string][]synology.Snapshot)
+	known := make(map[string]bool)
+	for _, s := range snapshots {
+		known[s.Name] = true
+	}
+	for _, s := range snapshots {
+		parent := s.Parent
+		if !known[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], s)
+	}
+	for _, list := range children {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCREATED\tSTATE\tDESCRIPTION")
+
+	var walk func(parent, indent string)
+	walk = func(parent, indent string) {
+		for _, s := range children[parent] {
+			marker := " "
+			if s.Current {
+				marker = "*"
+			}
+			fmt.Fprintf(tw, "%s%s%s\t%s\t%s\t%s\n",
+				marker, indent, s.Name,
+				s.CreatedAt.Format("2006-01-02 15:04:05"),
+				s.State,
+				s.Description)
+			walk(s.Name, indent+"  ")
+		}
+	}
+	walk("", "")
+
+	return tw.Flush()
+}
+
+func runSnapshotRevert(cmd *cobra.Command, args []string) error {
+	vmName, name := args[0], args[1]
+
+	if !snapshotForce && !confirm(fmt.Sprintf("Revert VM '%s' to snapshot '%s'? Changes since the snapshot will be lost.", vmName, name)) {
+		fmt.Println("Revert cancelled.")
+		return nil
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+	sm, err := snapshotManager(client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reverting VM %s to snapshot %s\n", vmName, name)
+
+	if err := sm.RevertSnapshot(ctx, vmName, name); err != nil {
+		return fmt.Errorf("failed to revert snapshot: %w", err)
+	}
+
+	fmt.Printf("VM %s reverted to snapshot %s\n", vmName, name)
+	return nil
+}
+
+func runSnapshotDelete(cmd *cobra.Command, args []string) error {
+	vmName, name := args[0], args[1]
+
+	if !snapshotForce && !confirm(fmt.Sprintf("Delete snapshot '%s' of VM '%s'?", name, vmName)) {
+		fmt.Println("Delete cancelled.")
+		return nil
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer closeManager(client)
+	sm, err := snapshotManager(client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleting snapshot %s of VM %s\n", name, vmName)
+
+	if err := sm.DeleteSnapshot(ctx, vmName, name); err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+
+	fmt.Printf("Snapshot %s deleted successfully\n", name)
+	return nil
+}
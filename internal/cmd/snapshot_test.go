@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+func TestSnapshotCommandsWithMock(t *testing.T) {
+	m := mock.NewMockClient()
+
+	if err := executeWithMock(t, m, "snapshot", "create", "test-vm-1", "--name", "base", "-d", "clean"); err != nil {
+		t.Fatalf("snapshot create failed: %v", err)
+	}
+	if err := executeWithMock(t, m, "snapshot", "create", "test-vm-1", "--name", "next", "--quiesce"); err != nil {
+		t.Fatalf("snapshot create failed: %v", err)
+	}
+
+	snapshots := m.Snapshots["test-vm-1"]
+	if len(snapshots) != 2 || snapshots[1].Parent != "base" || snapshots[0].Description != "clean" {
+		t.Fatalf("unexpected snapshots: %+v", snapshots)
+	}
+
+	if err := executeWithMock(t, m, "snapshot", "list", "test-vm-1"); err != nil {
+		t.Fatalf("snapshot list failed: %v", err)
+	}
+
+	if err := executeWithMock(t, m, "snapshot", "revert", "test-vm-1", "base", "--force"); err != nil {
+		t.Fatalf("snapshot revert failed: %v", err)
+	}
+	if !m.Snapshots["test-vm-1"][0].Current {
+		t.Error("expected base to be the current snapshot")
+	}
+
+	if err := executeWithMock(t, m, "snapshot", "delete", "test-vm-1", "base", "--force"); err != nil {
+		t.Fatalf("snapshot delete failed: %v", err)
+	}
+	snapshots = m.Snapshots["test-vm-1"]
+	if len(snapshots) != 1 || snapshots[0].Parent != "" {
+		t.Errorf("expected next to be re-parented to the root, got %+v", snapshots)
+	}
+
+	if err := executeWithMock(t, m, "snapshot", "delete", "test-vm-1", "missing", "--force"); err == nil {
+		t.Error("expected deleting a missing snapshot to fail")
+	}
+}
+
+func TestPrintSnapshotTree(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := []synology.Snapshot{
+		{Name: "b", Parent: "a", CreatedAt: base.Add(2 * time.Hour), Current: true},
+		{Name: "a", CreatedAt: base},
+		{Name: "c", Parent: "a", CreatedAt: base.Add(time.Hour)},
+		{Name: "d", Parent: "c", CreatedAt: base.Add(3 * time.Hour)},
+	}
+
+	var buf bytes.Buffer
+	if err := printSnapshotTree(&buf, snapshots); err != nil {
+		t.Fatalf("printSnapshotTree() error = %v", err)
+	}
+
+	// Children are indented under their parent, oldest first, and the
+	// current snapshot is marked
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasPrefix(lines[1], " a") || !strings.HasPrefix(lines[2], "   c") ||
+		!strings.HasPrefix(lines[3], "     d") || !strings.HasPrefix(lines[4], "*  b") {
+		t.Errorf("unexpected tree:\n%s", buf.String())
+	}
+}
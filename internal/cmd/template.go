@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
-	"github.com/spf13/cobra"
+	"github.com/scttfrdmn/syno-vm/internal/printer"
 	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
 )
 
 // templateCmd represents the template command
@@ -49,48 +51,59 @@ func init() {
 
 	templateCreateCmd.Flags().StringVar(&templateName, "name", "", "Name of the template (required)")
 	templateCreateCmd.Flags().StringVar(&templateFromVM, "from-vm", "", "Create template from existing VM (required)")
-	templateCreateCmd.MarkFlagRequired("name")   // nolint:errcheck // CLI setup
+	templateCreateCmd.MarkFlagRequired("name")    // nolint:errcheck // CLI setup
 	templateCreateCmd.MarkFlagRequired("from-vm") // nolint:errcheck // CLI setup
+
+	addTimeoutFlag(templateListCmd, templateCreateCmd, templateDeleteCmd)
+}
+
+// templateList prints templates
+var templateList = printer.List[synology.Template]{
+	Columns: []printer.Column[synology.Template]{
+		{Header: "NAME", Value: func(t synology.Template) string { return t.Name }},
+		{Header: "DESCRIPTION", Value: func(t synology.Template) string { return t.Description }},
+		{Header: "OS", Value: func(t synology.Template) string { return t.OS }},
+	},
+	Name:  func(t synology.Template) string { return t.Name },
+	Empty: "No templates found.",
 }
 
 func runTemplateList(cmd *cobra.Command, args []string) error {
-	client, err := synology.NewClient()
+	format, err := outputFormat()
 	if err != nil {
-		return fmt.Errorf("failed to create client: %w", err)
+		return err
 	}
 
-	templates, err := client.ListTemplates()
-	if err != nil {
-		return fmt.Errorf("failed to list templates: %w", err)
-	}
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
 
-	if len(templates) == 0 {
-		fmt.Println("No templates found.")
-		return nil
+	client, err := newManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
-	fmt.Printf("%-20s %-20s %-15s\n", "NAME", "DESCRIPTION", "OS")
-	fmt.Println("-------------------------------------------------------")
-
-	for _, template := range templates {
-		fmt.Printf("%-20s %-20s %-15s\n",
-			template.Name,
-			template.Description,
-			template.OS)
+	templates, err := client.ListTemplates(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
 	}
 
-	return nil
+	return templateList.Print(os.Stdout, format, templates)
 }
 
 func runTemplateCreate(cmd *cobra.Command, args []string) error {
-	client, err := synology.NewClient()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
 	fmt.Printf("Creating template '%s' from VM '%s'\n", templateName, templateFromVM)
 
-	if err := client.CreateTemplate(templateName, templateFromVM); err != nil {
+	if err := client.CreateTemplate(ctx, templateName, templateFromVM); err != nil {
 		return fmt.Errorf("failed to create template: %w", err)
 	}
 
@@ -101,17 +114,21 @@ func runTemplateCreate(cmd *cobra.Command, args []string) error {
 func runTemplateDelete(cmd *cobra.Command, args []string) error {
 	templateName := args[0]
 
-	client, err := synology.NewClient()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
 	fmt.Printf("Deleting template: %s\n", templateName)
 
-	if err := client.DeleteTemplate(templateName); err != nil {
+	if err := client.DeleteTemplate(ctx, templateName); err != nil {
 		return fmt.Errorf("failed to delete template: %w", err)
 	}
 
 	fmt.Printf("Template %s deleted successfully\n", templateName)
 	return nil
-}
\ No newline at end of file
+}
@@ -1,10 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/spf13/cobra"
+	"github.com/scttfrdmn/syno-vm/internal/printer"
 	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/spf13/cobra"
 )
 
 // startCmd represents the start command
@@ -20,27 +28,39 @@ var startCmd = &cobra.Command{
 var stopCmd = &cobra.Command{
 	Use:   "stop <vm-name>",
 	Short: "Stop a virtual machine",
-	Long:  `Stop a virtual machine by name.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runStop,
+	Long: `Stop a virtual machine by name.
+
+By default a graceful (ACPI) shutdown is requested and the command returns
+without waiting for the guest to power off. Use --wait to wait until it has
+stopped, and --force-after to power it off forcibly if it has not stopped in
+time. --wait-timeout also bounds the wait for the forced power off.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runStop,
 }
 
 // restartCmd represents the restart command
 var restartCmd = &cobra.Command{
 	Use:   "restart <vm-name>",
 	Short: "Restart a virtual machine",
-	Long:  `Restart a virtual machine by name.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runRestart,
+	Long: `Restart a virtual machine by name.
+
+The guest reboots without the VM leaving the running state, so there is no
+--wait: use 'status' or a guest health check to tell when it is back.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestart,
 }
 
 // statusCmd represents the status command
 var statusCmd = &cobra.Command{
 	Use:   "status <vm-name>",
 	Short: "Show virtual machine status",
-	Long:  `Show detailed status information for a virtual machine.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runStatus,
+	Long: `Show detailed status information for a virtual machine.
+
+With --detail the full VM definition is shown as well: disks with their
+location and size on the NAS, network interfaces, graphics, firmware, boot
+order and CPU topology. --detail requires the virsh or synowebapi backend.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runStatus,
 }
 
 // deleteCmd represents the delete command
@@ -53,9 +73,13 @@ var deleteCmd = &cobra.Command{
 }
 
 var (
-	force bool
+	force        bool
+	statusDetail bool
 )
 
+// waitPollInterval is how often --wait polls the VM state
+var waitPollInterval = 2 * time.Second
+
 func init() {
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(stopCmd)
@@ -64,55 +88,124 @@ func init() {
 	rootCmd.AddCommand(deleteCmd)
 
 	deleteCmd.Flags().BoolVarP(&force, "force", "f", false, "Force delete without confirmation")
+	statusCmd.Flags().BoolVarP(&statusDetail, "detail", "d", false, "Show the full VM definition")
+
+	addTimeoutFlag(startCmd, stopCmd, restartCmd, statusCmd, deleteCmd)
+	addWaitFlags(startCmd, stopCmd)
+
+	stopCmd.Flags().Duration("force-after", 0, "Force power off if the VM has not stopped after this long, e.g. 2m")
+}
+
+// addWaitFlags adds --wait and --wait-timeout to power state commands
+func addWaitFlags(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().Bool("wait", false, "Wait until the VM reaches the requested state")
+		c.Flags().Duration("wait-timeout", 5*time.Minute, "Give up waiting after this long (0 means no limit)")
+	}
+}
+
+// waitForState waits for the VM to reach state if --wait is set
+func waitForState(ctx context.Context, cmd *cobra.Command, client synology.VMManager, vmName string, state synology.VMState) (bool, error) {
+	wait, _ := cmd.Flags().GetBool("wait")
+	if !wait {
+		return false, nil
+	}
+
+	if d, _ := cmd.Flags().GetDuration("wait-timeout"); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	fmt.Printf("Waiting for VM %s to be %s...\n", vmName, state)
+	if _, err := synology.WaitForState(ctx, client, vmName, state, waitPollInterval); err != nil {
+		return true, err
+	}
+	return true, nil
 }
 
 func runStart(cmd *cobra.Command, args []string) error {
 	vmName := args[0]
 
-	client, err := synology.NewClient()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
 	fmt.Printf("Starting VM: %s\n", vmName)
 
-	if err := client.StartVM(vmName); err != nil {
+	if err := client.StartVM(ctx, vmName); err != nil {
 		return fmt.Errorf("failed to start VM: %w", err)
 	}
 
-	fmt.Printf("VM %s started successfully\n", vmName)
+	waited, err := waitForState(ctx, cmd, client, vmName, synology.StateRunning)
+	if err != nil {
+		return err
+	}
+
+	if waited {
+		fmt.Printf("VM %s is running\n", vmName)
+	} else {
+		fmt.Printf("VM %s started successfully\n", vmName)
+	}
 	return nil
 }
 
 func runStop(cmd *cobra.Command, args []string) error {
 	vmName := args[0]
 
-	client, err := synology.NewClient()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
 	fmt.Printf("Stopping VM: %s\n", vmName)
 
-	if err := client.StopVM(vmName); err != nil {
+	if err := client.StopVM(ctx, vmName); err != nil {
 		return fmt.Errorf("failed to stop VM: %w", err)
 	}
 
-	fmt.Printf("VM %s stopped successfully\n", vmName)
+	if forceAfter, _ := cmd.Flags().GetDuration("force-after"); forceAfter > 0 {
+		waitTimeout, _ := cmd.Flags().GetDuration("wait-timeout")
+		return stopOrPowerOff(ctx, client, vmName, forceAfter, waitTimeout)
+	}
+
+	waited, err := waitForState(ctx, cmd, client, vmName, synology.StateStopped)
+	if err != nil {
+		return err
+	}
+
+	if waited {
+		fmt.Printf("VM %s stopped successfully\n", vmName)
+	} else {
+		fmt.Printf("Shutdown requested for VM %s\n", vmName)
+	}
 	return nil
 }
 
 func runRestart(cmd *cobra.Command, args []string) error {
 	vmName := args[0]
 
-	client, err := synology.NewClient()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
 	fmt.Printf("Restarting VM: %s\n", vmName)
 
-	if err := client.RestartVM(vmName); err != nil {
+	if err := client.RestartVM(ctx, vmName); err != nil {
 		return fmt.Errorf("failed to restart VM: %w", err)
 	}
 
@@ -120,29 +213,150 @@ func runRestart(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// stopOrPowerOff waits up to forceAfter for a graceful shutdown to complete
+// and forcibly powers the VM off if it has not, then waits up to waitTimeout
+// (0 means no limit) for the power off
+func stopOrPowerOff(ctx context.Context, client synology.VMManager, vmName string, forceAfter, waitTimeout time.Duration) error {
+	graceCtx, cancel := context.WithTimeout(ctx, forceAfter)
+	_, err := synology.WaitForState(graceCtx, client, vmName, synology.StateStopped, waitPollInterval)
+	cancel()
+	if err == nil {
+		fmt.Printf("VM %s stopped successfully\n", vmName)
+		return nil
+	}
+	// Only escalate when the grace period ran out, not on interrupt or a
+	// failed status query
+	if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		return err
+	}
+
+	fmt.Printf("VM %s did not shut down within %s, forcing power off\n", vmName, forceAfter)
+	if err := client.PowerOffVM(ctx, vmName); err != nil {
+		return fmt.Errorf("failed to power off VM: %w", err)
+	}
+
+	if waitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+		defer cancel()
+	}
+	if _, err := synology.WaitForState(ctx, client, vmName, synology.StateStopped, waitPollInterval); err != nil {
+		return err
+	}
+
+	fmt.Printf("VM %s powered off\n", vmName)
+	return nil
+}
+
 func runStatus(cmd *cobra.Command, args []string) error {
 	vmName := args[0]
 
-	client, err := synology.NewClient()
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
-	vm, err := client.GetVMStatus(vmName)
+	vm, err := client.GetVMStatus(ctx, vmName)
 	if err != nil {
 		return fmt.Errorf("failed to get VM status: %w", err)
 	}
 
-	fmt.Printf("Virtual Machine: %s\n", vm.Name)
-	fmt.Printf("Status: %s\n", vm.Status)
-	fmt.Printf("CPU Cores: %d\n", vm.CPU)
-	fmt.Printf("Memory: %d MB\n", vm.Memory)
-	fmt.Printf("Storage: %s\n", vm.Storage)
-	if vm.IPAddress != "" {
-		fmt.Printf("IP Address: %s\n", vm.IPAddress)
+	if statusDetail {
+		inspector, ok := client.(synology.DomainInspector)
+		if !ok {
+			return fmt.Errorf("--detail is not supported by the configured backend; use the virsh or synowebapi backend")
+		}
+		if vm.Domain, err = inspector.GetDomain(ctx, vmName); err != nil {
+			return fmt.Errorf("failed to get VM definition: %w", err)
+		}
 	}
 
-	return nil
+	return printer.PrintObject(os.Stdout, format, vm, vm.Name, func(w io.Writer) error {
+		fmt.Fprintf(w, "Virtual Machine: %s\n", vm.Name)
+		fmt.Fprintf(w, "Status: %s\n", vm.Status)
+		fmt.Fprintf(w, "CPU Cores: %d\n", vm.CPU)
+		fmt.Fprintf(w, "Memory: %d MB\n", vm.Memory)
+		fmt.Fprintf(w, "Storage: %s\n", vm.Storage)
+		if vm.IPAddress != "" {
+			fmt.Fprintf(w, "IP Address: %s\n", vm.IPAddress)
+		}
+		if vm.Domain != nil {
+			return printDomain(w, vm.Domain)
+		}
+		return nil
+	})
+}
+
+// printDomain prints the sections status --detail adds
+func printDomain(w io.Writer, d *synology.Domain) error {
+	fmt.Fprintf(w, "UUID: %s\n", d.UUID)
+	fmt.Fprintf(w, "Firmware: %s\n", d.Firmware)
+	fmt.Fprintf(w, "Autostart: %t\n", d.Autostart)
+	if d.Machine != "" {
+		fmt.Fprintf(w, "Machine: %s\n", d.Machine)
+	}
+	if len(d.BootOrder) > 0 {
+		fmt.Fprintf(w, "Boot Order: %s\n", strings.Join(d.BootOrder, ", "))
+	}
+	cpu := fmt.Sprintf("%d vCPUs", d.CPU.VCPUs)
+	if d.CPU.Sockets > 0 {
+		cpu += fmt.Sprintf(" (%d sockets, %d cores, %d threads)", d.CPU.Sockets, d.CPU.Cores, d.CPU.Threads)
+	}
+	if d.CPU.Mode != "" {
+		cpu += ", " + d.CPU.Mode
+	}
+	fmt.Fprintf(w, "CPU: %s\n", cpu)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "\nDisks:")
+	fmt.Fprintln(tw, "  TARGET\tDEVICE\tBUS\tFORMAT\tCAPACITY\tALLOCATED\tSOURCE")
+	for _, disk := range d.Disks {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			disk.Target, disk.Device, disk.Bus, disk.Format,
+			formatBytes(disk.Capacity), formatBytes(disk.Physical), disk.Source)
+	}
+
+	fmt.Fprintln(tw, "\nNetwork Interfaces:")
+	fmt.Fprintln(tw, "  MAC\tTYPE\tSOURCE\tMODEL\tTARGET")
+	for _, nic := range d.NICs {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", nic.MAC, nic.Type, nic.Source, nic.Model, nic.Target)
+	}
+
+	if len(d.Graphics) > 0 {
+		fmt.Fprintln(tw, "\nGraphics:")
+		for _, g := range d.Graphics {
+			fmt.Fprintf(tw, "  %s\t%s:%d\n", g.Type, g.Listen, g.Port)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// formatBytes formats a byte count with a binary unit, or "-" if unknown
+func formatBytes(n uint64) string {
+	if n == 0 {
+		return "-"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
 }
 
 func runDelete(cmd *cobra.Command, args []string) error {
@@ -158,17 +372,21 @@ func runDelete(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	client, err := synology.NewClient()
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	client, err := newManager(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	defer closeManager(client)
 
 	fmt.Printf("Deleting VM: %s\n", vmName)
 
-	if err := client.DeleteVM(vmName); err != nil {
+	if err := client.DeleteVM(ctx, vmName); err != nil {
 		return fmt.Errorf("failed to delete VM: %w", err)
 	}
 
 	fmt.Printf("VM %s deleted successfully\n", vmName)
 	return nil
-}
\ No newline at end of file
+}
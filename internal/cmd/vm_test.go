@@ -0,0 +1,413 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+	"github.com/spf13/cobra"
+)
+
+// executeWithMock runs the root command with args against the given mock
+func executeWithMock(t *testing.T, m *mock.MockClient, args ...string) error {
+	t.Helper()
+
+	t.Setenv("HOME", t.TempDir())
+
+	origManager := newManager
+	newManager = func(ctx context.Context) (synology.VMManager, error) {
+		return m, nil
+	}
+	t.Cleanup(func() { newManager = origManager })
+
+	origInterval := waitPollInterval
+	waitPollInterval = time.Millisecond
+	t.Cleanup(func() { waitPollInterval = origInterval })
+
+	rootCmd.SetArgs(args)
+	c, err := rootCmd.ExecuteC()
+	resetFlags(c, args)
+	return err
+}
+
+// resetFlags restores the flags set by args to their defaults, since cobra
+// keeps flag values between executions of the same command tree
+func resetFlags(c *cobra.Command, args []string) {
+	flags := c.Flags()
+	for _, arg := range args {
+		if arg == "--" {
+			return
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name == "" {
+			continue
+		}
+
+		f := flags.Lookup(name)
+		if f == nil && !strings.HasPrefix(arg, "--") {
+			f = flags.ShorthandLookup(name[:1])
+		}
+		if f == nil {
+			continue
+		}
+		if sv, ok := f.Value.(interface{ Replace([]string) error }); ok {
+			_ = sv.Replace(nil)
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+
+	fnErr := fn()
+	w.Close()
+	return <-out, fnErr
+}
+
+func findVM(m *mock.MockClient, name string) *synology.VM {
+	for i := range m.VMs {
+		if m.VMs[i].Name == name {
+			return &m.VMs[i]
+		}
+	}
+	return nil
+}
+
+func TestVMCommandsWithMock(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantErr    bool
+		wantVM     string
+		wantStatus synology.VMState
+	}{
+		{
+			name:       "start stopped VM",
+			args:       []string{"start", "test-vm-2"},
+			wantVM:     "test-vm-2",
+			wantStatus: "running",
+		},
+		{
+			name:       "stop running VM",
+			args:       []string{"stop", "test-vm-1"},
+			wantVM:     "test-vm-1",
+			wantStatus: "stopped",
+		},
+		{
+			name:       "restart VM",
+			args:       []string{"restart", "test-vm-2"},
+			wantVM:     "test-vm-2",
+			wantStatus: "running",
+		},
+		{
+			name: "status of existing VM",
+			args: []string{"status", "test-vm-1"},
+		},
+		{
+			name:    "status of missing VM",
+			args:    []string{"status", "missing"},
+			wantErr: true,
+		},
+		{
+			name:    "start missing VM",
+			args:    []string{"start", "missing"},
+			wantErr: true,
+		},
+		{
+			name: "list VMs",
+			args: []string{"list", "--all"},
+		},
+		{
+			name:       "start and wait",
+			args:       []string{"start", "test-vm-2", "--wait"},
+			wantVM:     "test-vm-2",
+			wantStatus: "running",
+		},
+		{
+			name:       "stop and wait",
+			args:       []string{"stop", "test-vm-1", "--wait", "--wait-timeout", "1s"},
+			wantVM:     "test-vm-1",
+			wantStatus: "stopped",
+		},
+		{
+			name:       "start with timeout",
+			args:       []string{"start", "test-vm-2", "--timeout", "30s"},
+			wantVM:     "test-vm-2",
+			wantStatus: "running",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mock.NewMockClient()
+
+			err := executeWithMock(t, m, tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+
+			if tt.wantVM != "" {
+				vm := findVM(m, tt.wantVM)
+				if vm == nil {
+					t.Fatalf("VM %s not found in mock", tt.wantVM)
+				}
+				if vm.Status != tt.wantStatus {
+					t.Errorf("expected VM %s status %s, got %s", tt.wantVM, tt.wantStatus, vm.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateAndDeleteWithMock(t *testing.T) {
+	m := mock.NewMockClient()
+
+	if err := executeWithMock(t, m, "create", "--name", "new-vm", "--cpu", "4", "--memory", "8192"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	vm := findVM(m, "new-vm")
+	if vm == nil {
+		t.Fatal("expected new-vm to be created")
+	}
+	if vm.CPU != 4 || vm.Memory != 8192 {
+		t.Errorf("expected 4 CPUs and 8192 MB, got %d CPUs and %d MB", vm.CPU, vm.Memory)
+	}
+
+	if err := executeWithMock(t, m, "delete", "new-vm", "--force"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if findVM(m, "new-vm") != nil {
+		t.Error("expected new-vm to be deleted")
+	}
+}
+
+func TestCreateDryRunSkipsBackend(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// Planning for virsh must not need a connection to the NAS
+	origManager := newManager
+	newManager = func(ctx context.Context) (synology.VMManager, error) {
+		return nil, errors.New("--dry-run connected to a backend")
+	}
+	t.Cleanup(func() { newManager = origManager })
+
+	args := []string{"create", "--name", "new-vm", "--dry-run"}
+	out, err := captureStdout(t, func() error {
+		rootCmd.SetArgs(args)
+		c, err := rootCmd.ExecuteC()
+		resetFlags(c, args)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create --dry-run failed: %v", err)
+	}
+	if !strings.Contains(out, "<name>new-vm</name>") {
+		t.Errorf("expected the domain XML, got:\n%s", out)
+	}
+}
+
+func TestTemplateCommandsWithMock(t *testing.T) {
+	m := mock.NewMockClient()
+
+	if err := executeWithMock(t, m, "template", "create", "--name", "base", "--from-vm", "test-vm-1"); err != nil {
+		t.Fatalf("template create failed: %v", err)
+	}
+	if len(m.Templates) != 3 {
+		t.Fatalf("expected 3 templates, got %d", len(m.Templates))
+	}
+
+	if err := executeWithMock(t, m, "template", "list"); err != nil {
+		t.Fatalf("template list failed: %v", err)
+	}
+
+	if err := executeWithMock(t, m, "template", "delete", "base"); err != nil {
+		t.Fatalf("template delete failed: %v", err)
+	}
+	if len(m.Templates) != 2 {
+		t.Errorf("expected 2 templates, got %d", len(m.Templates))
+	}
+}
+
+func TestCommandPropagatesBackendFailure(t *testing.T) {
+	m := mock.NewMockClient()
+	m.SetFailure("ListVMs", true)
+
+	err := executeWithMock(t, m, "list")
+	if err == nil {
+		t.Fatal("expected list to fail when the backend fails")
+	}
+	if code := ExitCode(err); code != exitError {
+		t.Errorf("exit code = %d, want %d", code, exitError)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	m := mock.NewMockClient()
+
+	err := executeWithMock(t, m, "start", "missing-vm")
+	if code := ExitCode(err); code != exitNotFound {
+		t.Errorf("exit code for a missing VM = %d (%v), want %d", code, err, exitNotFound)
+	}
+
+	login := fmt.Errorf("authentication failed: %w", &synology.WebAPIError{Code: 400, API: "SYNO.API.Auth", Method: "login"})
+	if code := ExitCode(login); code != exitAuth {
+		t.Errorf("exit code for rejected credentials = %d, want %d", code, exitAuth)
+	}
+}
+
+func TestStopWaitTimesOutWhenShutdownIgnored(t *testing.T) {
+	m := mock.NewMockClient()
+	m.IgnoreShutdown = true
+
+	err := executeWithMock(t, m, "stop", "test-vm-1", "--wait", "--wait-timeout", "20ms")
+	if err == nil {
+		t.Fatal("expected stop --wait to time out")
+	}
+	if vm := findVM(m, "test-vm-1"); vm.Status != "running" {
+		t.Errorf("expected VM to still be running, got %s", vm.Status)
+	}
+}
+
+func TestStopForceAfterPowersOff(t *testing.T) {
+	m := mock.NewMockClient()
+	m.IgnoreShutdown = true
+
+	if err := executeWithMock(t, m, "stop", "test-vm-1", "--force-after", "20ms"); err != nil {
+		t.Fatalf("stop --force-after failed: %v", err)
+	}
+	if vm := findVM(m, "test-vm-1"); vm.Status != "stopped" {
+		t.Errorf("expected VM to be powered off, got %s", vm.Status)
+	}
+}
+
+func TestStopForceAfterHonoursWaitTimeout(t *testing.T) {
+	m := mock.NewMockClient()
+	m.IgnoreShutdown = true
+	m.IgnorePowerOff = true
+
+	err := executeWithMock(t, m, "stop", "test-vm-1", "--force-after", "20ms", "--wait-timeout", "50ms")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("stop --force-after error = %v, want the power off wait to time out", err)
+	}
+}
+
+func TestStopForceAfterSkipsPowerOffOnGracefulShutdown(t *testing.T) {
+	m := mock.NewMockClient()
+	m.SetFailure("PowerOffVM", true)
+
+	if err := executeWithMock(t, m, "stop", "test-vm-1", "--force-after", "1s"); err != nil {
+		t.Fatalf("stop --force-after failed: %v", err)
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	m := mock.NewMockClient()
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, m, "list", "--all", "-o", "json")
+	})
+	if err != nil {
+		t.Fatalf("list -o json failed: %v", err)
+	}
+	var vms []synology.VM
+	if err := json.Unmarshal([]byte(out), &vms); err != nil {
+		t.Fatalf("list -o json printed invalid JSON %q: %v", out, err)
+	}
+	if len(vms) != 2 {
+		t.Errorf("expected 2 VMs, got %d", len(vms))
+	}
+
+	out, err = captureStdout(t, func() error {
+		return executeWithMock(t, m, "status", "test-vm-1", "-o", "template={{.Name}} {{.Status}}")
+	})
+	if err != nil {
+		t.Fatalf("status -o template failed: %v", err)
+	}
+	if out != "test-vm-1 running\n" {
+		t.Errorf("unexpected template output %q", out)
+	}
+
+	out, err = captureStdout(t, func() error {
+		return executeWithMock(t, m, "template", "list", "-o", "name")
+	})
+	if err != nil {
+		t.Fatalf("template list -o name failed: %v", err)
+	}
+	if out != "ubuntu-20.04\nwindows-10\n" {
+		t.Errorf("unexpected name output %q", out)
+	}
+
+	if err := executeWithMock(t, m, "list", "-o", "xml"); err == nil {
+		t.Error("expected an unknown output format to fail")
+	}
+}
+
+func TestStatusDetail(t *testing.T) {
+	m := mock.NewMockClient()
+
+	out, err := captureStdout(t, func() error {
+		return executeWithMock(t, m, "status", "test-vm-1", "--detail", "-o", "json")
+	})
+	if err != nil {
+		t.Fatalf("status --detail failed: %v", err)
+	}
+
+	var vm synology.VM
+	if err := json.Unmarshal([]byte(out), &vm); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if vm.Domain == nil || len(vm.Domain.Disks) != 1 || vm.Domain.Disks[0].Source != "/volume1/vms/test-vm-1.qcow2" {
+		t.Errorf("expected the domain definition in the output, got %+v", vm.Domain)
+	}
+
+	out, err = captureStdout(t, func() error {
+		return executeWithMock(t, m, "status", "test-vm-1", "--detail")
+	})
+	if err != nil {
+		t.Fatalf("status --detail failed: %v", err)
+	}
+	if !strings.Contains(out, "/volume1/vms/test-vm-1.qcow2") || !strings.Contains(out, "52:54:00:00:00:01") {
+		t.Errorf("expected disks and NICs in the output, got:\n%s", out)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[uint64]string{
+		0:           "-",
+		512:         "512 B",
+		1536:        "1.5 KiB",
+		21474836480: "20.0 GiB",
+	}
+	for in, want := range tests {
+		if got := formatBytes(in); got != want {
+			t.Errorf("formatBytes(%d) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Package config reads and writes the syno-vm configuration file. The file
+// holds named contexts, each with the connection settings of one NAS, and
+// the name of the context used by default.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultContext is the context flat configurations are migrated into, and
+// the one used when no context is selected
+const DefaultContext = "default"
+
+// ContextKeys are the settings a context holds
+var ContextKeys = []string{"host", "username", "password", "password_command", "password_store", "otp_secret", "port", "keyfile", "timeout", "keepalive_interval", "backend"}
+
+// Context is the settings of one NAS, by key
+type Context map[string]interface{}
+
+// File is the configuration file
+type File struct {
+	CurrentContext string             `yaml:"current-context,omitempty"`
+	Contexts       map[string]Context `yaml:"contexts,omitempty"`
+
+	// Global holds settings outside any context, which apply to all of them
+	Global map[string]interface{} `yaml:",inline"`
+
+	path string
+}
+
+// DefaultPath returns the default location of the configuration file,
+// ~/.syno-vm/config.yaml
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".syno-vm", "config.yaml"), nil
+}
+
+// New returns an empty configuration to be saved at path
+func New(path string) *File {
+	return &File{path: path}
+}
+
+// Load reads the configuration file at path. A missing file yields an empty
+// configuration. A flat configuration from before contexts existed is moved
+// into DefaultContext, in which case migrated is true and the caller should
+// Save the result.
+func Load(path string) (f *File, migrated bool, err error) {
+	f = New(path)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, false, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if f.Contexts == nil {
+		flat := Context{}
+		for _, key := range ContextKeys {
+			if value, ok := f.Global[key]; ok {
+				flat[key] = value
+				delete(f.Global, key)
+			}
+		}
+		if len(flat) > 0 {
+			f.Contexts = map[string]Context{DefaultContext: flat}
+			f.CurrentContext = DefaultContext
+			migrated = true
+		}
+	}
+
+	return f, migrated, nil
+}
+
+// Path returns the location of the file
+func (f *File) Path() string {
+	return f.path
+}
+
+// Save writes the file, readable only by the current user since contexts
+// may hold passwords. Files and directories created with wider permissions
+// by older versions are restricted too.
+func (f *File) Save() error {
+	dir := filepath.Dir(f.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if filepath.Base(dir) == ".syno-vm" {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return fmt.Errorf("failed to restrict config directory: %w", err)
+		}
+	}
+
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := os.WriteFile(f.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Chmod(f.path, 0600); err != nil {
+		return fmt.Errorf("failed to restrict config file: %w", err)
+	}
+	return nil
+}
+
+// SessionPath returns where the Web API session of the named context is
+// cached, in a sessions directory next to the file
+func (f *File) SessionPath(name string) string {
+	return filepath.Join(filepath.Dir(f.path), "sessions", name+".json")
+}
+
+// Names returns the context names in order
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Contexts))
+	for name := range f.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the name of the context to use: override if set,
+// otherwise the current context, otherwise DefaultContext
+func (f *File) Resolve(override string) string {
+	switch {
+	case override != "":
+		return override
+	case f.CurrentContext != "":
+		return f.CurrentContext
+	default:
+		return DefaultContext
+	}
+}
+
+// Settings returns the global settings overlaid with those of the named
+// context
+func (f *File) Settings(name string) map[string]interface{} {
+	settings := make(map[string]interface{}, len(f.Global)+len(f.Contexts[name]))
+	for key, value := range f.Global {
+		settings[key] = value
+	}
+	for key, value := range f.Contexts[name] {
+		settings[key] = value
+	}
+	return settings
+}
+
+// Set stores a setting in the named context, creating it if necessary
+func (f *File) Set(name, key string, value interface{}) {
+	if f.Contexts == nil {
+		f.Contexts = make(map[string]Context)
+	}
+	if f.Contexts[name] == nil {
+		f.Contexts[name] = Context{}
+	}
+	f.Contexts[name][key] = value
+}
+
+// Unset removes a setting from the named context
+func (f *File) Unset(name, key string) {
+	delete(f.Contexts[name], key)
+}
+
+var contextNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateContextName checks that a context name is made of letters,
+// digits, '.', '_' and '-', so it can also name files
+func ValidateContextName(name string) error {
+	if !contextNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid context name %q: use letters, digits, '.', '_' and '-', starting with a letter or digit", name)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLoadMissing(t *testing.T) {
+	f, migrated, err := Load(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil || migrated {
+		t.Fatalf("Load() = %v, %v; want an empty config", migrated, err)
+	}
+	if len(f.Contexts) != 0 || f.Resolve("") != DefaultContext {
+		t.Errorf("unexpected config %+v", f)
+	}
+}
+
+func TestLoadMigratesFlatConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	flat := "host: nas.local\nusername: admin\nport: 2222\ninsecure_skip_host_key_check: true\n"
+	if err := os.WriteFile(path, []byte(flat), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, migrated, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !migrated || f.CurrentContext != DefaultContext {
+		t.Fatalf("expected migration into %q, got %+v", DefaultContext, f)
+	}
+	ctx := f.Contexts[DefaultContext]
+	if ctx["host"] != "nas.local" || ctx["username"] != "admin" || ctx["port"] != 2222 {
+		t.Errorf("unexpected default context %v", ctx)
+	}
+	if _, ok := f.Global["host"]; ok {
+		t.Error("host was left outside the context")
+	}
+	if f.Global["insecure_skip_host_key_check"] != true {
+		t.Errorf("global setting was not kept: %v", f.Global)
+	}
+
+	if err := f.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	f, migrated, err = Load(path)
+	if err != nil || migrated {
+		t.Fatalf("reloading a migrated config = %v, %v", migrated, err)
+	}
+	if f.Settings(DefaultContext)["host"] != "nas.local" {
+		t.Errorf("unexpected settings after reload %v", f.Settings(DefaultContext))
+	}
+}
+
+func TestSaveAndSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config.yaml")
+	f := New(path)
+	f.Global = map[string]interface{}{"timeout": 60}
+	f.Set("home", "host", "home-nas.local")
+	f.Set("lab", "host", "lab-nas.local")
+	f.Set("lab", "timeout", 5)
+	f.CurrentContext = "home"
+	if err := f.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("config file mode = %o, want 600", perm)
+		}
+	}
+
+	f, _, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if names := f.Names(); len(names) != 2 || names[0] != "home" || names[1] != "lab" {
+		t.Errorf("Names() = %v", names)
+	}
+	if got := f.Resolve(""); got != "home" {
+		t.Errorf("Resolve(\"\") = %q, want home", got)
+	}
+	if got := f.Resolve("lab"); got != "lab" {
+		t.Errorf("Resolve(lab) = %q", got)
+	}
+
+	home := f.Settings("home")
+	if home["host"] != "home-nas.local" || home["timeout"] != 60 {
+		t.Errorf("Settings(home) = %v", home)
+	}
+	lab := f.Settings("lab")
+	if lab["host"] != "lab-nas.local" || lab["timeout"] != 5 {
+		t.Errorf("Settings(lab) = %v", lab)
+	}
+}
+
+func TestValidateContextName(t *testing.T) {
+	for _, name := range []string{"default", "lab-2", "nas.home", "DS_920"} {
+		if err := ValidateContextName(name); err != nil {
+			t.Errorf("ValidateContextName(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "-lab", "lab nas", "a/b", "../x"} {
+		if err := ValidateContextName(name); err == nil {
+			t.Errorf("ValidateContextName(%q) accepted an invalid name", name)
+		}
+	}
+}
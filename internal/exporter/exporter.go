@@ -0,0 +1,247 @@
+// Package exporter exposes VM and host resource usage as Prometheus metrics.
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+)
+
+// ContentType is the content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Exporter collects resource usage from a VM manager and renders it as
+// metrics. Collections are cached for the configured interval, so frequent
+// scrapes do not each cost a round trip to the NAS.
+type Exporter struct {
+	manager  synology.VMManager
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	collected time.Time // zero before the first collection
+	duration  time.Duration
+	stats     *synology.Stats
+	detailed  bool // stats came from a StatsCollector rather than ListVMs
+	err       error
+}
+
+// New creates an Exporter that collects from manager at most once per
+// interval
+func New(manager synology.VMManager, interval time.Duration) *Exporter {
+	return &Exporter{
+		manager:  manager,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// ServeHTTP implements http.Handler, serving the metrics
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := e.WriteMetrics(r.Context(), &buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// WriteMetrics writes the metrics to w, collecting first if the cached
+// collection is older than the interval. A failed collection is reported
+// through syno_vm_exporter_up rather than as an error.
+func (e *Exporter) WriteMetrics(ctx context.Context, w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Holding the lock makes concurrent scrapes share one collection
+	if e.collected.IsZero() || e.now().Sub(e.collected) >= e.interval {
+		start := e.now()
+		e.stats, e.detailed, e.err = e.collect(ctx)
+		e.collected = e.now()
+		e.duration = e.collected.Sub(start)
+	}
+
+	return writeFamilies(w, e.families())
+}
+
+// collect samples resource usage, falling back to the VM list for backends
+// without detailed statistics
+func (e *Exporter) collect(ctx context.Context) (*synology.Stats, bool, error) {
+	if collector, ok := e.manager.(synology.StatsCollector); ok {
+		stats, err := collector.CollectStats(ctx)
+		return stats, true, err
+	}
+
+	vms, err := e.manager.ListVMs(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list VMs: %w", err)
+	}
+	stats := &synology.Stats{}
+	for _, vm := range vms {
+		stats.Domains = append(stats.Domains, synology.DomainStats{
+			Name:         vm.Name,
+			State:        vm.Status,
+			VCPUs:        vm.CPU,
+			MemoryMaxKiB: uint64(vm.Memory) * 1024,
+		})
+	}
+	return stats, false, nil
+}
+
+// families builds the metric families from the cached collection
+func (e *Exporter) families() []*family {
+	up := &family{name: "syno_vm_exporter_up", typ: gauge, help: "Whether the last collection from the NAS succeeded."}
+	duration := &family{name: "syno_vm_exporter_collect_duration_seconds", typ: gauge, help: "Duration of the last collection from the NAS."}
+	timestamp := &family{name: "syno_vm_exporter_last_collect_timestamp_seconds", typ: gauge, help: "Unix time of the last collection from the NAS."}
+
+	duration.add(e.duration.Seconds())
+	timestamp.add(float64(e.collected.UnixNano()) / 1e9)
+	if e.err != nil {
+		up.add(0)
+		return []*family{up, duration, timestamp}
+	}
+	up.add(1)
+
+	families := []*family{up, duration, timestamp}
+	families = append(families, hostFamilies(e.stats)...)
+	families = append(families, domainFamilies(e.stats.Domains, e.detailed)...)
+	return families
+}
+
+// active reports whether a VM holds host resources
+func active(state synology.VMState) bool {
+	return state == synology.StateRunning || state == synology.StatePaused || state == synology.StateShuttingDown
+}
+
+// hostFamilies returns NAS-level capacity and totals over all VMs
+func hostFamilies(stats *synology.Stats) []*family {
+	cpus := &family{name: "syno_vm_host_cpus", typ: gauge, help: "Number of host CPUs."}
+	memory := &family{name: "syno_vm_host_memory_bytes", typ: gauge, help: "Host memory."}
+	free := &family{name: "syno_vm_host_memory_free_bytes", typ: gauge, help: "Free host memory."}
+	vms := &family{name: "syno_vm_host_vms", typ: gauge, help: "Number of VMs by state."}
+	vcpus := &family{name: "syno_vm_host_allocated_vcpus", typ: gauge, help: "Virtual CPUs of running VMs."}
+	allocated := &family{name: "syno_vm_host_allocated_memory_bytes", typ: gauge, help: "Maximum memory of running VMs."}
+
+	if stats.Host.CPUs > 0 {
+		cpus.add(float64(stats.Host.CPUs))
+	}
+	if stats.Host.MemoryBytes > 0 {
+		memory.add(float64(stats.Host.MemoryBytes))
+	}
+	if stats.Host.MemoryFreeBytes > 0 {
+		free.add(float64(stats.Host.MemoryFreeBytes))
+	}
+
+	counts := make(map[synology.VMState]int)
+	var totalVCPUs int
+	var totalMemory uint64
+	for _, d := range stats.Domains {
+		counts[d.State]++
+		if active(d.State) {
+			totalVCPUs += d.VCPUs
+			totalMemory += d.MemoryMaxKiB * 1024
+		}
+	}
+	for _, state := range synology.VMStates {
+		vms.add(float64(counts[state]), "state", string(state))
+	}
+	vcpus.add(float64(totalVCPUs))
+	allocated.add(float64(totalMemory))
+
+	return []*family{cpus, memory, free, vms, vcpus, allocated}
+}
+
+// domainFamilies returns per-VM metrics. Usage counters are only reported
+// when detailed statistics are available.
+func domainFamilies(domains []synology.DomainStats, detailed bool) []*family {
+	state := &family{name: "syno_vm_state", typ: gauge, help: "Current state of the VM: 1 for the current state, 0 otherwise."}
+	vcpus := &family{name: "syno_vm_vcpus", typ: gauge, help: "Number of virtual CPUs."}
+	memMax := &family{name: "syno_vm_memory_max_bytes", typ: gauge, help: "Maximum memory of the VM."}
+
+	cpu := &family{name: "syno_vm_cpu_seconds_total", typ: counter, help: "CPU time used by the VM."}
+	memCurrent := &family{name: "syno_vm_memory_current_bytes", typ: gauge, help: "Memory currently assigned to the VM by the balloon driver."}
+	memRSS := &family{name: "syno_vm_memory_rss_bytes", typ: gauge, help: "Resident memory of the VM process on the host."}
+	memAvailable := &family{name: "syno_vm_memory_available_bytes", typ: gauge, help: "Memory available to the guest as reported by the balloon driver."}
+	memUnused := &family{name: "syno_vm_memory_unused_bytes", typ: gauge, help: "Memory left unused by the guest as reported by the balloon driver."}
+
+	diskRead := &family{name: "syno_vm_disk_read_bytes_total", typ: counter, help: "Bytes read from the disk."}
+	diskWritten := &family{name: "syno_vm_disk_written_bytes_total", typ: counter, help: "Bytes written to the disk."}
+	diskReads := &family{name: "syno_vm_disk_reads_total", typ: counter, help: "Read requests to the disk."}
+	diskWrites := &family{name: "syno_vm_disk_writes_total", typ: counter, help: "Write requests to the disk."}
+	diskCapacity := &family{name: "syno_vm_disk_capacity_bytes", typ: gauge, help: "Size of the disk as seen by the guest."}
+	diskAllocation := &family{name: "syno_vm_disk_allocation_bytes", typ: gauge, help: "Space used by the disk on the NAS."}
+
+	netRxBytes := &family{name: "syno_vm_network_receive_bytes_total", typ: counter, help: "Bytes received by the interface."}
+	netTxBytes := &family{name: "syno_vm_network_transmit_bytes_total", typ: counter, help: "Bytes transmitted by the interface."}
+	netRxPackets := &family{name: "syno_vm_network_receive_packets_total", typ: counter, help: "Packets received by the interface."}
+	netTxPackets := &family{name: "syno_vm_network_transmit_packets_total", typ: counter, help: "Packets transmitted by the interface."}
+	netRxErrors := &family{name: "syno_vm_network_receive_errors_total", typ: counter, help: "Receive errors on the interface."}
+	netTxErrors := &family{name: "syno_vm_network_transmit_errors_total", typ: counter, help: "Transmit errors on the interface."}
+	netRxDrops := &family{name: "syno_vm_network_receive_drops_total", typ: counter, help: "Received packets dropped by the interface."}
+	netTxDrops := &family{name: "syno_vm_network_transmit_drops_total", typ: counter, help: "Transmitted packets dropped by the interface."}
+
+	kib := func(f *family, v *uint64, name string) {
+		if v != nil {
+			f.add(float64(*v)*1024, "name", name)
+		}
+	}
+
+	for _, d := range domains {
+		for _, s := range synology.VMStates {
+			value := 0.0
+			if d.State == s {
+				value = 1
+			}
+			state.add(value, "name", d.Name, "state", string(s))
+		}
+		vcpus.add(float64(d.VCPUs), "name", d.Name)
+		memMax.add(float64(d.MemoryMaxKiB)*1024, "name", d.Name)
+
+		if !detailed {
+			continue
+		}
+
+		cpu.add(float64(d.CPUTimeNs)/1e9, "name", d.Name)
+		kib(memCurrent, d.MemoryCurrentKiB, d.Name)
+		kib(memRSS, d.MemoryRSSKiB, d.Name)
+		kib(memAvailable, d.MemoryAvailableKiB, d.Name)
+		kib(memUnused, d.MemoryUnusedKiB, d.Name)
+
+		for _, disk := range d.Disks {
+			labels := []string{"name", d.Name, "device", disk.Device}
+			diskRead.add(float64(disk.ReadBytes), labels...)
+			diskWritten.add(float64(disk.WriteBytes), labels...)
+			diskReads.add(float64(disk.ReadReqs), labels...)
+			diskWrites.add(float64(disk.WriteReqs), labels...)
+			diskCapacity.add(float64(disk.Capacity), labels...)
+			diskAllocation.add(float64(disk.Allocation), labels...)
+		}
+
+		for _, nic := range d.NICs {
+			labels := []string{"name", d.Name, "interface", nic.Interface}
+			netRxBytes.add(float64(nic.RxBytes), labels...)
+			netTxBytes.add(float64(nic.TxBytes), labels...)
+			netRxPackets.add(float64(nic.RxPackets), labels...)
+			netTxPackets.add(float64(nic.TxPackets), labels...)
+			netRxErrors.add(float64(nic.RxErrors), labels...)
+			netTxErrors.add(float64(nic.TxErrors), labels...)
+			netRxDrops.add(float64(nic.RxDrops), labels...)
+			netTxDrops.add(float64(nic.TxDrops), labels...)
+		}
+	}
+
+	return []*family{
+		state, vcpus, memMax,
+		cpu, memCurrent, memRSS, memAvailable, memUnused,
+		diskRead, diskWritten, diskReads, diskWrites, diskCapacity, diskAllocation,
+		netRxBytes, netTxBytes, netRxPackets, netTxPackets,
+		netRxErrors, netTxErrors, netRxDrops, netTxDrops,
+	}
+}
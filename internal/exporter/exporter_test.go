@@ -0,0 +1,138 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+// scrape returns the metrics written by e
+func scrape(t *testing.T, e *Exporter) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := e.WriteMetrics(context.Background(), &buf); err != nil {
+		t.Fatalf("WriteMetrics() error = %v", err)
+	}
+	return buf.String()
+}
+
+func TestWriteMetrics(t *testing.T) {
+	out := scrape(t, New(mock.NewMockClient(), time.Minute))
+
+	for _, line := range []string{
+		"# HELP syno_vm_exporter_up Whether the last collection from the NAS succeeded.",
+		"# TYPE syno_vm_exporter_up gauge",
+		"syno_vm_exporter_up 1",
+		"syno_vm_host_cpus 4",
+		"syno_vm_host_memory_bytes 17179869184",
+		`syno_vm_host_vms{state="running"} 1`,
+		`syno_vm_host_vms{state="stopped"} 1`,
+		"syno_vm_host_allocated_vcpus 2",
+		"syno_vm_host_allocated_memory_bytes 2147483648",
+		`syno_vm_state{name="test-vm-1",state="running"} 1`,
+		`syno_vm_state{name="test-vm-1",state="stopped"} 0`,
+		`syno_vm_state{name="test-vm-2",state="stopped"} 1`,
+		`syno_vm_vcpus{name="test-vm-2"} 4`,
+		"# TYPE syno_vm_cpu_seconds_total counter",
+		`syno_vm_cpu_seconds_total{name="test-vm-1"} 1.5`,
+		`syno_vm_memory_current_bytes{name="test-vm-1"} 2147483648`,
+		`syno_vm_disk_read_bytes_total{name="test-vm-1",device="vda"} 1024`,
+		`syno_vm_network_transmit_bytes_total{name="test-vm-1",interface="vnet0"} 8192`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing line %q", line)
+		}
+	}
+
+	// Balloon stats are only reported for VMs that have them
+	if strings.Contains(out, `syno_vm_memory_current_bytes{name="test-vm-2"}`) {
+		t.Error("unexpected current memory for a stopped VM")
+	}
+}
+
+func TestWriteMetricsCaches(t *testing.T) {
+	m := mock.NewMockClient()
+	e := New(m, time.Minute)
+	now := time.Unix(1700000000, 0)
+	e.now = func() time.Time { return now }
+
+	scrape(t, e)
+	scrape(t, e)
+	if m.StatsCalls != 1 {
+		t.Errorf("expected 1 collection within the interval, got %d", m.StatsCalls)
+	}
+
+	now = now.Add(time.Minute)
+	out := scrape(t, e)
+	if m.StatsCalls != 2 {
+		t.Errorf("expected a new collection after the interval, got %d", m.StatsCalls)
+	}
+	if !strings.Contains(out, "syno_vm_exporter_last_collect_timestamp_seconds 1700000060\n") {
+		t.Errorf("unexpected collection timestamp in\n%s", out)
+	}
+}
+
+func TestWriteMetricsCollectionFailure(t *testing.T) {
+	m := mock.NewMockClient()
+	m.Fail["CollectStats"] = true
+
+	out := scrape(t, New(m, time.Minute))
+	if !strings.Contains(out, "syno_vm_exporter_up 0\n") {
+		t.Errorf("expected up 0 in\n%s", out)
+	}
+	if strings.Contains(out, "syno_vm_state") {
+		t.Error("expected no VM metrics after a failed collection")
+	}
+}
+
+// vmOnly hides the optional interfaces of a manager
+type vmOnly struct{ synology.VMManager }
+
+func TestWriteMetricsWithoutStatsCollector(t *testing.T) {
+	out := scrape(t, New(vmOnly{mock.NewMockClient()}, time.Minute))
+
+	if !strings.Contains(out, `syno_vm_memory_max_bytes{name="test-vm-2"} 4294967296`+"\n") {
+		t.Errorf("expected memory from the VM list in\n%s", out)
+	}
+	if strings.Contains(out, "syno_vm_cpu_seconds_total") || strings.Contains(out, "syno_vm_host_cpus") {
+		t.Errorf("expected no usage counters or host capacity without detailed stats\n%s", out)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	rec := httptest.NewRecorder()
+	New(mock.NewMockClient(), time.Minute).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+}
+
+func TestWriteFamiliesEscaping(t *testing.T) {
+	f := &family{name: "test_metric", typ: gauge, help: "Help with a \\ and\na newline."}
+	f.add(0.25, "name", "a \"quoted\"\\name\n")
+	empty := &family{name: "empty_metric", typ: gauge, help: "Never written."}
+
+	var buf bytes.Buffer
+	if err := writeFamilies(&buf, []*family{f, empty}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP test_metric Help with a \\ and\na newline.
+# TYPE test_metric gauge
+test_metric{name="a \"quoted\"\\name\n"} 0.25
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package exporter
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the Prometheus text format
+const (
+	gauge   = "gauge"
+	counter = "counter"
+)
+
+// family is a metric family: a name with help text, a type and samples
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+// sample is one labelled value of a family
+type sample struct {
+	labels []string // alternating names and values
+	value  float64
+}
+
+// add appends a sample. labels alternate names and values.
+func (f *family) add(value float64, labels ...string) {
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+// writeFamilies writes families in the Prometheus text exposition format,
+// version 0.0.4. Families without samples are skipped.
+func writeFamilies(w io.Writer, families []*family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if len(f.samples) == 0 {
+			continue
+		}
+
+		bw.WriteString("# HELP " + f.name + " " + helpEscaper.Replace(f.help) + "\n")
+		bw.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			bw.WriteString(f.name)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(s.labels[i] + `="` + labelEscaper.Replace(s.labels[i+1]) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + formatValue(s.value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// formatValue formats a sample value, writing integers without an exponent
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
@@ -0,0 +1,135 @@
+// Package manifest describes the VMs of a NAS declaratively and computes
+// and applies the changes that make the NAS match the description.
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is the desired set of VMs on a NAS
+type Manifest struct {
+	VMs []VM `yaml:"vms"`
+}
+
+// VM is the desired configuration of a virtual machine
+type VM struct {
+	Name   string `yaml:"name"`
+	CPU    int    `yaml:"cpu"`
+	Memory int    `yaml:"memory"` // MB
+	Disks  []Disk `yaml:"disks,omitempty"`
+	NICs   []NIC  `yaml:"nics,omitempty"`
+
+	// Template and ISO are only used when the VM is created
+	Template string `yaml:"template,omitempty"` // virsh: installation image; VMM: image to clone the disk from
+	ISO      string `yaml:"iso,omitempty"`      // VMM: ISO image to mount
+
+	Autostart *bool            `yaml:"autostart,omitempty"` // left unchanged if not set
+	State     synology.VMState `yaml:"state,omitempty"`     // running or stopped; left unchanged if not set
+}
+
+// Disk is a disk of a VM
+type Disk struct {
+	Storage string `yaml:"storage"`        // virsh: disk image path on the NAS; VMM: storage name
+	Size    int    `yaml:"size,omitempty"` // VMM: size of the new disk in GB
+}
+
+// NIC is a network interface of a VM
+type NIC struct {
+	Network string `yaml:"network"` // virsh: host bridge; VMM: network name
+}
+
+// Load reads a manifest from a file, or from standard input if path is "-"
+func Load(path string) (*Manifest, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates a YAML manifest. Unknown fields are rejected
+// so that typos do not go unnoticed.
+func Parse(data []byte) (*Manifest, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var m Manifest
+	if err := dec.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate checks that every VM is valid and named only once
+func (m *Manifest) Validate() error {
+	seen := make(map[string]bool, len(m.VMs))
+	for i, vm := range m.VMs {
+		if err := vm.Validate(); err != nil {
+			if vm.Name == "" {
+				return fmt.Errorf("vms[%d]: %w", i, err)
+			}
+			return fmt.Errorf("VM %s: %w", vm.Name, err)
+		}
+		if seen[vm.Name] {
+			return fmt.Errorf("VM %s is defined more than once", vm.Name)
+		}
+		seen[vm.Name] = true
+	}
+	return nil
+}
+
+// Validate validates the VM configuration
+func (vm VM) Validate() error {
+	if err := vm.Config().Validate(); err != nil {
+		return err
+	}
+	// VMConfig describes a single disk and NIC
+	if len(vm.Disks) > 1 {
+		return fmt.Errorf("only one disk is supported, got %d", len(vm.Disks))
+	}
+	if len(vm.NICs) > 1 {
+		return fmt.Errorf("only one NIC is supported, got %d", len(vm.NICs))
+	}
+	switch vm.State {
+	case "", synology.StateRunning, synology.StateStopped:
+	default:
+		return fmt.Errorf("invalid state %q: must be running or stopped", vm.State)
+	}
+	return nil
+}
+
+// Config returns the configuration CreateVM needs to create the VM
+func (vm VM) Config() synology.VMConfig {
+	config := synology.VMConfig{
+		Name:     vm.Name,
+		Template: vm.Template,
+		CPU:      vm.CPU,
+		Memory:   vm.Memory,
+		ISO:      vm.ISO,
+		Autorun:  vm.Autostart != nil && *vm.Autostart,
+	}
+	if len(vm.Disks) > 0 {
+		config.Storage = vm.Disks[0].Storage
+		config.DiskSize = vm.Disks[0].Size
+	}
+	if len(vm.NICs) > 0 {
+		config.Network = vm.NICs[0].Network
+	}
+	return config
+}
@@ -0,0 +1,80 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(`
+vms:
+  - name: web-01
+    cpu: 2
+    memory: 2048
+    disks:
+      - storage: /volume1/vms/web-01.qcow2
+    nics:
+      - network: ovs_eth0
+    template: /volume1/iso/ubuntu.iso
+    autostart: true
+    state: running
+  - name: db-01
+    cpu: 4
+    memory: 8192
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(m.VMs) != 2 {
+		t.Fatalf("expected 2 VMs, got %d", len(m.VMs))
+	}
+
+	want := synology.VMConfig{
+		Name:     "web-01",
+		Template: "/volume1/iso/ubuntu.iso",
+		CPU:      2,
+		Memory:   2048,
+		Storage:  "/volume1/vms/web-01.qcow2",
+		Network:  "ovs_eth0",
+		Autorun:  true,
+	}
+	if got := m.VMs[0].Config(); got != want {
+		t.Errorf("Config() = %+v, want %+v", got, want)
+	}
+	if m.VMs[0].State != synology.StateRunning || m.VMs[1].Autostart != nil {
+		t.Errorf("unexpected VMs %+v", m.VMs)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"unknown field", "vms:\n  - name: a\n    cpus: 2\n    memory: 512\n", "field cpus not found"},
+		{"missing cpu", "vms:\n  - name: a\n    memory: 512\n", "CPU must be greater than 0"},
+		{"missing name", "vms:\n  - cpu: 1\n    memory: 512\n", "vms[0]"},
+		{"duplicate", "vms:\n  - {name: a, cpu: 1, memory: 512}\n  - {name: a, cpu: 2, memory: 512}\n", "more than once"},
+		{"two disks", "vms:\n  - name: a\n    cpu: 1\n    memory: 512\n    disks: [{storage: /a.qcow2}, {storage: /b.qcow2}]\n", "only one disk"},
+		{"invalid state", "vms:\n  - {name: a, cpu: 1, memory: 512, state: paused}\n", "invalid state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	m, err := Parse(nil)
+	if err != nil || len(m.VMs) != 0 {
+		t.Errorf("Parse(nil) = %+v, %v; want an empty manifest", m, err)
+	}
+}
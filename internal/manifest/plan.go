@@ -0,0 +1,268 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+)
+
+// Action is the kind of a change
+type Action string
+
+// Plan actions
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionStart  Action = "start"
+	ActionStop   Action = "stop"
+	ActionDelete Action = "delete"
+)
+
+// Actions lists the plan actions in the order they are summarised
+var Actions = []Action{ActionCreate, ActionUpdate, ActionStart, ActionStop, ActionDelete}
+
+// Change is one step of a plan
+type Change struct {
+	Action  Action   `json:"action"`
+	VM      string   `json:"vm"`
+	Details []string `json:"details,omitempty"` // e.g. "cpu: 2 -> 4"
+
+	config synology.VMConfig // for ActionCreate
+	update synology.VMUpdate // for ActionUpdate
+	state  synology.VMState  // state of the VM before the change
+}
+
+// Plan is the list of changes that make a NAS match a manifest
+type Plan struct {
+	Changes []Change `json:"changes"`
+
+	// Warnings are differences that applying the plan does not fix, such
+	// as updates the configured backend cannot make
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Count returns the number of changes with action a
+func (p *Plan) Count(a Action) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == a {
+			n++
+		}
+	}
+	return n
+}
+
+// Options control how a plan is computed
+type Options struct {
+	// Prune deletes VMs on the NAS that the manifest does not list
+	Prune bool
+}
+
+// active reports whether a VM is using host resources
+func active(state synology.VMState) bool {
+	return state == synology.StateRunning || state == synology.StatePaused || state == synology.StateShuttingDown
+}
+
+// Diff compares the VMs on the NAS with a manifest and returns the changes
+// that reconcile them. Changes are ordered as the manifest lists VMs,
+// followed by deletions.
+func Diff(ctx context.Context, m synology.VMManager, manifest *Manifest, opts Options) (*Plan, error) {
+	vms, err := m.ListVMs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+	current := make(map[string]synology.VM, len(vms))
+	for _, vm := range vms {
+		current[vm.Name] = vm
+	}
+
+	plan := &Plan{Changes: []Change{}}
+	inspector, canInspect := m.(synology.DomainInspector)
+	_, canUpdate := m.(synology.VMUpdater)
+
+	for _, want := range manifest.VMs {
+		have, exists := current[want.Name]
+		if !exists {
+			plan.Changes = append(plan.Changes, createChange(want))
+			if want.State == synology.StateRunning {
+				plan.Changes = append(plan.Changes, Change{Action: ActionStart, VM: want.Name, state: synology.StateStopped})
+			}
+			continue
+		}
+
+		var domain *synology.Domain
+		if canInspect {
+			if domain, err = inspector.GetDomain(ctx, want.Name); err != nil {
+				return nil, fmt.Errorf("failed to inspect VM %s: %w", want.Name, err)
+			}
+			have.CPU, have.Memory = domain.CPU.VCPUs, domain.Memory
+			if have.Autostart == nil {
+				have.Autostart = &domain.Autostart
+			}
+		}
+
+		if change, ok := updateChange(want, have); ok {
+			if !canUpdate {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: %s cannot be changed with the configured backend", want.Name, strings.Join(change.Details, ", ")))
+			} else {
+				if (change.update.CPU != 0 || change.update.Memory != 0) && active(have.Status) {
+					change.Details = append(change.Details, "takes effect when the VM restarts")
+				}
+				plan.Changes = append(plan.Changes, change)
+			}
+		}
+		plan.Warnings = append(plan.Warnings, deviceWarnings(want, domain)...)
+		if want.Autostart != nil && have.Autostart == nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: autostart cannot be checked with the configured backend", want.Name))
+		}
+
+		switch {
+		case want.State == synology.StateRunning && !active(have.Status):
+			plan.Changes = append(plan.Changes, Change{Action: ActionStart, VM: want.Name, Details: []string{"state: " + string(have.Status) + " -> running"}, state: have.Status})
+		case want.State == synology.StateRunning && have.Status == synology.StatePaused:
+			plan.Changes = append(plan.Changes, Change{Action: ActionStart, VM: want.Name, Details: []string{"state: paused -> running"}, state: have.Status})
+		case want.State == synology.StateStopped && (have.Status == synology.StateRunning || have.Status == synology.StatePaused):
+			plan.Changes = append(plan.Changes, Change{Action: ActionStop, VM: want.Name, Details: []string{"state: " + string(have.Status) + " -> stopped"}, state: have.Status})
+		}
+	}
+
+	if opts.Prune {
+		wanted := make(map[string]bool, len(manifest.VMs))
+		for _, vm := range manifest.VMs {
+			wanted[vm.Name] = true
+		}
+		for _, vm := range vms {
+			if wanted[vm.Name] {
+				continue
+			}
+			change := Change{Action: ActionDelete, VM: vm.Name, state: vm.Status}
+			if active(vm.Status) {
+				change.Details = []string{"is " + string(vm.Status) + " and will be powered off"}
+			}
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+
+	return plan, nil
+}
+
+// createChange returns the change that creates want
+func createChange(want VM) Change {
+	config := want.Config()
+	details := []string{fmt.Sprintf("cpu: %d", config.CPU), fmt.Sprintf("memory: %d MB", config.Memory)}
+	if config.Storage != "" {
+		details = append(details, "disk: "+config.Storage)
+	}
+	if config.Network != "" {
+		details = append(details, "network: "+config.Network)
+	}
+	if config.Autorun {
+		details = append(details, "autostart: true")
+	}
+	return Change{Action: ActionCreate, VM: want.Name, Details: details, config: config}
+}
+
+// updateChange returns the change that updates the definition of have to
+// match want, if they differ
+func updateChange(want VM, have synology.VM) (Change, bool) {
+	change := Change{Action: ActionUpdate, VM: want.Name, state: have.Status}
+
+	if want.CPU != have.CPU {
+		change.update.CPU = want.CPU
+		change.Details = append(change.Details, fmt.Sprintf("cpu: %d -> %d", have.CPU, want.CPU))
+	}
+	if want.Memory != have.Memory {
+		change.update.Memory = want.Memory
+		change.Details = append(change.Details, fmt.Sprintf("memory: %d -> %d MB", have.Memory, want.Memory))
+	}
+	if want.Autostart != nil && have.Autostart != nil && *want.Autostart != *have.Autostart {
+		change.update.Autostart = want.Autostart
+		change.Details = append(change.Details, fmt.Sprintf("autostart: %t -> %t", *have.Autostart, *want.Autostart))
+	}
+
+	if change.update.IsZero() {
+		return Change{}, false
+	}
+	return change, true
+}
+
+// deviceWarnings reports disks and NICs that differ from the manifest.
+// Devices are fixed when a VM is created, so changing them means
+// recreating the VM.
+func deviceWarnings(want VM, domain *synology.Domain) []string {
+	if domain == nil {
+		return nil
+	}
+
+	var warnings []string
+	if len(want.Disks) > 0 && path.IsAbs(want.Disks[0].Storage) {
+		var disk string
+		for _, d := range domain.Disks {
+			if d.Device == "disk" {
+				disk = d.Source
+				break
+			}
+		}
+		if disk != want.Disks[0].Storage {
+			warnings = append(warnings, fmt.Sprintf("%s: disk is %q on the NAS but %q in the manifest; recreate the VM to change it", want.Name, disk, want.Disks[0].Storage))
+		}
+	}
+	if len(want.NICs) > 0 {
+		var network string
+		if len(domain.NICs) > 0 {
+			network = domain.NICs[0].Source
+		}
+		if network != want.NICs[0].Network {
+			warnings = append(warnings, fmt.Sprintf("%s: network is %q on the NAS but %q in the manifest; recreate the VM to change it", want.Name, network, want.NICs[0].Network))
+		}
+	}
+	return warnings
+}
+
+// Apply executes the changes of a plan in order, calling progress before
+// each one. It stops at the first failure; since plans are computed from
+// the current state, running Diff and Apply again resumes where it stopped.
+func Apply(ctx context.Context, m synology.VMManager, plan *Plan, progress func(Change)) error {
+	updater, canUpdate := m.(synology.VMUpdater)
+	if plan.Count(ActionUpdate) > 0 && !canUpdate {
+		return fmt.Errorf("the plan updates VMs, which the configured backend does not support")
+	}
+
+	for _, c := range plan.Changes {
+		if progress != nil {
+			progress(c)
+		}
+
+		var err error
+		switch c.Action {
+		case ActionCreate:
+			err = m.CreateVM(ctx, c.config)
+		case ActionUpdate:
+			err = updater.UpdateVM(ctx, c.VM, c.update)
+		case ActionStart:
+			if c.state == synology.StatePaused {
+				err = m.ResumeVM(ctx, c.VM)
+			} else {
+				err = m.StartVM(ctx, c.VM)
+			}
+		case ActionStop:
+			err = m.StopVM(ctx, c.VM)
+		case ActionDelete:
+			if active(c.state) {
+				err = m.PowerOffVM(ctx, c.VM)
+			}
+			if err == nil {
+				err = m.DeleteVM(ctx, c.VM)
+			}
+		default:
+			err = fmt.Errorf("unknown action %q", c.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s VM %s: %w", c.Action, c.VM, err)
+		}
+	}
+	return nil
+}
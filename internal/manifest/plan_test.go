@@ -0,0 +1,196 @@
+package manifest
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+// testManifest changes the mock's two sample VMs and adds a third
+func testManifest() *Manifest {
+	return &Manifest{VMs: []VM{
+		{Name: "test-vm-1", CPU: 4, Memory: 2048, Autostart: boolPtr(true), State: synology.StateStopped},
+		{Name: "test-vm-2", CPU: 4, Memory: 4096, State: synology.StateRunning},
+		{
+			Name:   "web-03",
+			CPU:    2,
+			Memory: 1024,
+			Disks:  []Disk{{Storage: "/volume1/vms/web-03.qcow2"}},
+			NICs:   []NIC{{Network: "ovs_eth0"}},
+			State:  synology.StateRunning,
+		},
+	}}
+}
+
+// summary returns the actions and VMs of a plan, e.g. "create web-03"
+func summary(plan *Plan) []string {
+	var s []string
+	for _, c := range plan.Changes {
+		s = append(s, string(c.Action)+" "+c.VM)
+	}
+	return s
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	m := mock.NewMockClient()
+
+	plan, err := Diff(ctx, m, testManifest(), Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	want := []string{
+		"update test-vm-1",
+		"stop test-vm-1",
+		"start test-vm-2",
+		"create web-03",
+		"start web-03",
+	}
+	if got := summary(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	update := plan.Changes[0]
+	wantDetails := []string{"cpu: 2 -> 4", "autostart: false -> true", "takes effect when the VM restarts"}
+	if !reflect.DeepEqual(update.Details, wantDetails) {
+		t.Errorf("update details = %v, want %v", update.Details, wantDetails)
+	}
+	if len(plan.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", plan.Warnings)
+	}
+}
+
+func TestDiffPrune(t *testing.T) {
+	m := mock.NewMockClient()
+	manifest := &Manifest{VMs: []VM{{Name: "test-vm-2", CPU: 4, Memory: 4096}}}
+
+	plan, err := Diff(context.Background(), m, manifest, Options{Prune: true})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if got := summary(plan); !reflect.DeepEqual(got, []string{"delete test-vm-1"}) {
+		t.Fatalf("unexpected plan %v", got)
+	}
+	if len(plan.Changes[0].Details) != 1 || !strings.Contains(plan.Changes[0].Details[0], "powered off") {
+		t.Errorf("expected a note that the running VM is powered off, got %v", plan.Changes[0].Details)
+	}
+
+	if err := Apply(context.Background(), m, plan, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(m.VMs) != 1 || m.VMs[0].Name != "test-vm-2" {
+		t.Errorf("unexpected VMs after prune %+v", m.VMs)
+	}
+}
+
+func TestDiffDeviceWarnings(t *testing.T) {
+	manifest := &Manifest{VMs: []VM{{
+		Name:   "test-vm-2",
+		CPU:    4,
+		Memory: 4096,
+		Disks:  []Disk{{Storage: "/volume2/test-vm-2.qcow2"}},
+		NICs:   []NIC{{Network: "ovs_eth1"}},
+	}}}
+
+	plan, err := Diff(context.Background(), mock.NewMockClient(), manifest, Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(plan.Changes) != 0 || len(plan.Warnings) != 2 {
+		t.Errorf("expected only disk and network warnings, got %v and %v", summary(plan), plan.Warnings)
+	}
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	m := mock.NewMockClient()
+
+	plan, err := Diff(ctx, m, testManifest(), Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	var applied []string
+	if err := Apply(ctx, m, plan, func(c Change) { applied = append(applied, c.VM) }); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(applied) != len(plan.Changes) {
+		t.Errorf("progress called %d times for %d changes", len(applied), len(plan.Changes))
+	}
+
+	plan, err = Diff(ctx, m, testManifest(), Options{})
+	if err != nil {
+		t.Fatalf("second Diff() error = %v", err)
+	}
+	if len(plan.Changes) != 0 || len(plan.Warnings) != 0 {
+		t.Errorf("expected no changes after apply, got %v %v", summary(plan), plan.Warnings)
+	}
+}
+
+// noUpdates hides the optional interfaces of a manager
+type noUpdates struct{ synology.VMManager }
+
+func TestApplyWithoutUpdater(t *testing.T) {
+	ctx := context.Background()
+	m := noUpdates{mock.NewMockClient()}
+
+	plan, err := Diff(ctx, m, testManifest(), Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if plan.Count(ActionUpdate) != 0 {
+		t.Errorf("expected no updates without an updater, got %v", summary(plan))
+	}
+	wantWarnings := []string{
+		"test-vm-1: cpu: 2 -> 4 cannot be changed with the configured backend",
+		"test-vm-1: autostart cannot be checked with the configured backend",
+	}
+	if !reflect.DeepEqual(plan.Warnings, wantWarnings) {
+		t.Errorf("warnings = %v, want %v", plan.Warnings, wantWarnings)
+	}
+	if err := Apply(ctx, m, plan, nil); err != nil {
+		t.Errorf("Apply() error = %v", err)
+	}
+
+	update := &Plan{Changes: []Change{{Action: ActionUpdate, VM: "test-vm-1", update: synology.VMUpdate{CPU: 4}}}}
+	if err := Apply(ctx, m, update, nil); err == nil {
+		t.Error("expected applying updates without an updater to fail")
+	}
+}
+
+// listedAutostart is a manager that reports autostart in the VM list and
+// cannot inspect definitions, as the VMM backends do
+type listedAutostart struct {
+	synology.VMManager
+	synology.VMUpdater
+}
+
+func (l listedAutostart) ListVMs(ctx context.Context) ([]synology.VM, error) {
+	vms, err := l.VMManager.ListVMs(ctx)
+	for i := range vms {
+		vms[i].Autostart = boolPtr(false)
+	}
+	return vms, err
+}
+
+func TestDiffWithListedAutostart(t *testing.T) {
+	m := mock.NewMockClient()
+
+	plan, err := Diff(context.Background(), listedAutostart{m, m}, testManifest(), Options{})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(plan.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", plan.Warnings)
+	}
+	update := plan.Changes[0]
+	if update.Action != ActionUpdate || update.update.Autostart == nil || !*update.update.Autostart {
+		t.Errorf("expected test-vm-1 to be updated to autostart, got %+v", update)
+	}
+}
@@ -0,0 +1,192 @@
+// Package printer renders command output as tables, JSON, YAML, bare names
+// or Go templates, as selected by the global -o/--output flag.
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is an output format
+type Kind string
+
+// Supported output formats
+const (
+	Table    Kind = "table"
+	Wide     Kind = "wide"
+	JSON     Kind = "json"
+	YAML     Kind = "yaml"
+	Name     Kind = "name"
+	Template Kind = "template"
+)
+
+// Kinds lists the output formats in the order they are documented
+var Kinds = []Kind{Table, Wide, JSON, YAML, Name, Template}
+
+// Format is a parsed -o/--output value
+type Format struct {
+	Kind Kind
+	tmpl *template.Template
+}
+
+// Parse parses an output format: one of the Kinds, with a template given as
+// template=<text>. An empty string selects Table.
+func Parse(s string) (Format, error) {
+	if s == "" {
+		return Format{Kind: Table}, nil
+	}
+
+	if text, ok := strings.CutPrefix(s, string(Template)+"="); ok {
+		tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return Format{}, fmt.Errorf("invalid output template: %w", err)
+		}
+		return Format{Kind: Template, tmpl: tmpl}, nil
+	}
+
+	for _, k := range Kinds {
+		if s == string(k) {
+			if k == Template {
+				return Format{}, fmt.Errorf("output format template needs a template, e.g. -o template='{{.Name}}'")
+			}
+			return Format{Kind: k}, nil
+		}
+	}
+
+	return Format{}, fmt.Errorf("unknown output format %q (valid formats: table, wide, json, yaml, name, template=<text>)", s)
+}
+
+// IsTable reports whether f is a human-readable table format
+func (f Format) IsTable() bool {
+	return f.Kind == Table || f.Kind == Wide
+}
+
+// Column is a table column of a list of T
+type Column[T any] struct {
+	Header string
+	Wide   bool // only shown with -o wide
+	Value  func(T) string
+}
+
+// List describes how to print a list of T
+type List[T any] struct {
+	Columns []Column[T]
+	// Name returns the name printed for an item with -o name
+	Name func(T) string
+	// Empty is printed instead of an empty table
+	Empty string
+}
+
+// Print writes items to w in format f. JSON and YAML print the whole list;
+// name and template print one line per item.
+func (l List[T]) Print(w io.Writer, f Format, items []T) error {
+	if items == nil {
+		items = []T{}
+	}
+
+	switch f.Kind {
+	case JSON, YAML:
+		return writeStructured(w, f.Kind, items)
+	case Name:
+		for _, item := range items {
+			if _, err := fmt.Fprintln(w, l.Name(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Template:
+		for _, item := range items {
+			if err := writeTemplate(w, f.tmpl, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(items) == 0 && l.Empty != "" {
+		_, err := fmt.Fprintln(w, l.Empty)
+		return err
+	}
+
+	var columns []Column[T]
+	for _, c := range l.Columns {
+		if !c.Wide || f.Kind == Wide {
+			columns = append(columns, c)
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	cells := make([]string, len(columns))
+	for i, c := range columns {
+		cells[i] = c.Header
+	}
+	fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	for _, item := range items {
+		for i, c := range columns {
+			cells[i] = c.Value(item)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// PrintObject writes a single value to w in format f. Table formats call
+// table, which prints the human-readable form; name prints name.
+func PrintObject(w io.Writer, f Format, v interface{}, name string, table func(io.Writer) error) error {
+	switch f.Kind {
+	case JSON, YAML:
+		return writeStructured(w, f.Kind, v)
+	case Name:
+		_, err := fmt.Fprintln(w, name)
+		return err
+	case Template:
+		return writeTemplate(w, f.tmpl, v)
+	default:
+		return table(w)
+	}
+}
+
+// writeStructured writes v as JSON or YAML. YAML is produced from the JSON
+// encoding so that both use the json struct tags for field names.
+func writeStructured(w io.Writer, kind Kind, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+
+	if kind == JSON {
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(generic); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	return enc.Close()
+}
+
+// writeTemplate executes tmpl on v, ending the output with a newline
+func writeTemplate(w io.Writer, tmpl *template.Template, v interface{}) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, v); err != nil {
+		return fmt.Errorf("failed to execute output template: %w", err)
+	}
+	if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,105 @@
+package printer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+var itemList = List[item]{
+	Columns: []Column[item]{
+		{Header: "NAME", Value: func(i item) string { return i.Name }},
+		{Header: "SIZE", Wide: true, Value: func(i item) string { return strings.Repeat("#", i.Size) }},
+	},
+	Name:  func(i item) string { return i.Name },
+	Empty: "nothing here",
+}
+
+var items = []item{{Name: "a", Size: 1}, {Name: "bb", Size: 2}}
+
+func render(t *testing.T, format string, v []item) string {
+	t.Helper()
+
+	f, err := Parse(format)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", format, err)
+	}
+
+	var buf bytes.Buffer
+	if err := itemList.Print(&buf, f, v); err != nil {
+		t.Fatalf("Print(%q) error = %v", format, err)
+	}
+	return buf.String()
+}
+
+func TestListPrint(t *testing.T) {
+	tests := []struct {
+		format string
+		items  []item
+		want   string
+	}{
+		{"", items, "NAME\na\nbb\n"},
+		{"table", nil, "nothing here\n"},
+		{"wide", items, "NAME   SIZE\na      #\nbb     ##\n"},
+		{"json", items, "[\n  {\n    \"name\": \"a\",\n    \"size\": 1\n  },\n  {\n    \"name\": \"bb\",\n    \"size\": 2\n  }\n]\n"},
+		{"json", nil, "[]\n"},
+		{"yaml", items, "- name: a\n  size: 1\n- name: bb\n  size: 2\n"},
+		{"name", items, "a\nbb\n"},
+		{"template={{.Name}}={{.Size}}", items, "a=1\nbb=2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := render(t, tt.format, tt.items); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, format := range []string{"xml", "template", "template={{.Name"} {
+		if _, err := Parse(format); err == nil {
+			t.Errorf("Parse(%q) expected error", format)
+		}
+	}
+}
+
+func TestPrintObject(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"table", "human a\n"},
+		{"yaml", "name: a\nsize: 1\n"},
+		{"name", "a\n"},
+		{"template={{.Size}}", "1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			f, err := Parse(tt.format)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.format, err)
+			}
+
+			var buf bytes.Buffer
+			err = PrintObject(&buf, f, items[0], "a", func(w io.Writer) error {
+				_, err := io.WriteString(w, "human a\n")
+				return err
+			})
+			if err != nil {
+				t.Fatalf("PrintObject() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
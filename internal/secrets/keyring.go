@@ -0,0 +1,99 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secretTool is the libsecret command line client used to reach the
+// Secret Service
+var secretTool = "secret-tool"
+
+// keyringService is the service attribute of syno-vm secrets
+const keyringService = "syno-vm"
+
+// Keyring stores secrets with the freedesktop Secret Service, as used by
+// GNOME Keyring and KWallet, through secret-tool
+type Keyring struct{}
+
+var _ Store = Keyring{}
+
+// NewKeyring returns the Secret Service store
+func NewKeyring() Keyring {
+	return Keyring{}
+}
+
+// Name returns KeyringStore
+func (Keyring) Name() string {
+	return KeyringStore
+}
+
+// Get looks up the secret of account
+func (k Keyring) Get(ctx context.Context, account string) (string, error) {
+	out, stderr, err := k.run(ctx, nil, "lookup", "service", keyringService, "account", account)
+	if err != nil {
+		// secret-tool exits with status 1 and prints nothing when no
+		// secret matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && stderr == "" {
+			return "", ErrNotFound
+		}
+		return "", toolError("lookup", err, stderr)
+	}
+	if out == "" {
+		return "", ErrNotFound
+	}
+	return out, nil
+}
+
+// Set stores the secret of account, replacing any previous one
+func (k Keyring) Set(ctx context.Context, account, secret string) error {
+	_, stderr, err := k.run(ctx, []byte(secret), "store", "--label", "syno-vm "+account, "service", keyringService, "account", account)
+	if err != nil {
+		return toolError("store", err, stderr)
+	}
+	return nil
+}
+
+// Delete removes the secret of account
+func (k Keyring) Delete(ctx context.Context, account string) error {
+	_, stderr, err := k.run(ctx, nil, "clear", "service", keyringService, "account", account)
+	if err != nil {
+		return toolError("clear", err, stderr)
+	}
+	return nil
+}
+
+// run runs secret-tool and returns its output without the trailing newline,
+// and what it wrote to stderr
+func (Keyring) run(ctx context.Context, stdin []byte, args ...string) (string, string, error) {
+	path, err := exec.LookPath(secretTool)
+	if err != nil {
+		return "", "", fmt.Errorf("%s not found; install libsecret-tools or use --password-store vault", secretTool)
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	return strings.TrimSuffix(string(out), "\n"), strings.TrimSpace(stderr.String()), err
+}
+
+// toolError describes a failed secret-tool operation
+func toolError(op string, err error, stderr string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if stderr != "" {
+		return fmt.Errorf("%s %s failed: %w: %s", secretTool, op, err, stderr)
+	}
+	return fmt.Errorf("%s %s failed: %w", secretTool, op, err)
+}
@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeSecretTool installs a secret-tool that keeps secrets in files under a
+// temporary directory
+func fakeSecretTool(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+
+	dir := t.TempDir()
+	script := `#!/bin/sh
+store="` + dir + `/store"
+mkdir -p "$store"
+op=$1; shift
+[ "$op" = store ] && shift 2
+account=$4
+case $op in
+store) cat > "$store/$account" ;;
+lookup) [ -f "$store/$account" ] || exit 1; cat "$store/$account"; echo ;;
+clear) rm -f "$store/$account" ;;
+esac
+`
+	path := filepath.Join(dir, "secret-tool")
+	if err := os.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	orig := secretTool
+	secretTool = path
+	t.Cleanup(func() { secretTool = orig })
+}
+
+func TestKeyring(t *testing.T) {
+	fakeSecretTool(t)
+	ctx := context.Background()
+	k := NewKeyring()
+
+	if _, err := k.Get(ctx, "admin@nas"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() of a missing secret = %v, want ErrNotFound", err)
+	}
+	if err := k.Set(ctx, "admin@nas", "s3cret"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := k.Get(ctx, "admin@nas"); err != nil || got != "s3cret" {
+		t.Errorf("Get() = %q, %v", got, err)
+	}
+	if err := k.Delete(ctx, "admin@nas"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := k.Get(ctx, "admin@nas"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() = %v, want ErrNotFound", err)
+	}
+}
+
+func TestKeyringMissingTool(t *testing.T) {
+	orig := secretTool
+	secretTool = filepath.Join(t.TempDir(), "no-such-tool")
+	t.Cleanup(func() { secretTool = orig })
+
+	if _, err := NewKeyring().Get(context.Background(), "admin@nas"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a missing secret-tool to be reported, got %v", err)
+	}
+}
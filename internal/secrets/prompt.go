@@ -0,0 +1,24 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// readPassword asks for a secret on the terminal with echo turned off
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("stdin is not a terminal to ask for the vault passphrase; set %s", VaultPassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(password), nil
+}
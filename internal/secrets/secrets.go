@@ -0,0 +1,177 @@
+// Package secrets keeps the Web API password out of the configuration file.
+// A context can take its password from a command such as 'pass show nas',
+// from the freedesktop Secret Service, or from a local vault encrypted with
+// a passphrase.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrNotFound is returned when a store holds no secret for an account
+var ErrNotFound = errors.New("secret not found")
+
+// Store keeps secrets by account
+type Store interface {
+	// Name is the store name used in the configuration
+	Name() string
+	Get(ctx context.Context, account string) (string, error)
+	Set(ctx context.Context, account, secret string) error
+	Delete(ctx context.Context, account string) error
+}
+
+// Store names, as used by the password_store setting
+const (
+	KeyringStore = "keyring"
+	VaultStore   = "vault"
+)
+
+// Stores lists the valid store names
+var Stores = []string{KeyringStore, VaultStore}
+
+// DefaultStore returns the store passwords go to when none is chosen: the
+// Secret Service when secret-tool and a session bus are available, the
+// vault otherwise
+func DefaultStore() string {
+	if _, err := exec.LookPath(secretTool); err == nil && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+		return KeyringStore
+	}
+	return VaultStore
+}
+
+// Open returns the named store
+func Open(name string) (Store, error) {
+	switch name {
+	case KeyringStore:
+		return NewKeyring(), nil
+	case VaultStore:
+		path, err := DefaultVaultPath()
+		if err != nil {
+			return nil, err
+		}
+		return NewVault(path, EnvOrPromptPassphrase), nil
+	default:
+		return nil, fmt.Errorf("unknown password store %q (valid stores: %s)", name, strings.Join(Stores, ", "))
+	}
+}
+
+// Account names the secret of a user on a NAS
+func Account(username, host string) string {
+	return username + "@" + host
+}
+
+// Source says where a password comes from
+type Source string
+
+const (
+	// SourceNone means no password is configured
+	SourceNone Source = ""
+	// SourceConfig is a password stored in clear text in the config file
+	SourceConfig Source = "config"
+	// SourceCommand is the output of password_command
+	SourceCommand Source = "command"
+	// SourceKeyring is the freedesktop Secret Service
+	SourceKeyring Source = KeyringStore
+	// SourceVault is the encrypted vault file
+	SourceVault Source = VaultStore
+)
+
+// Ref describes where a context keeps its password. Command takes
+// precedence over Store, which takes precedence over Plain.
+type Ref struct {
+	Plain   string // password setting
+	Command string // password_command setting
+	Store   string // password_store setting
+	Account string // key of the password in Store
+}
+
+// Source returns where the password is taken from
+func (r Ref) Source() Source {
+	switch {
+	case r.Command != "":
+		return SourceCommand
+	case r.Store != "":
+		return Source(r.Store)
+	case r.Plain != "":
+		return SourceConfig
+	default:
+		return SourceNone
+	}
+}
+
+// Describe returns a human-readable description of the source, which never
+// includes the password itself
+func (r Ref) Describe() string {
+	switch r.Source() {
+	case SourceCommand:
+		return fmt.Sprintf("from command %q", r.Command)
+	case SourceKeyring:
+		return fmt.Sprintf("in keyring as %s", r.Account)
+	case SourceVault:
+		return fmt.Sprintf("in vault as %s", r.Account)
+	case SourceConfig:
+		return "in config file"
+	case SourceNone:
+		return "not set"
+	default:
+		return fmt.Sprintf("in unknown store %q", r.Store)
+	}
+}
+
+// Lookup returns the password. It returns "" if no password is configured,
+// and an error wrapping ErrNotFound if the store has none.
+func (r Ref) Lookup(ctx context.Context) (string, error) {
+	switch r.Source() {
+	case SourceNone:
+		return "", nil
+	case SourceConfig:
+		return r.Plain, nil
+	case SourceCommand:
+		return Command(ctx, r.Command)
+	}
+
+	store, err := Open(r.Store)
+	if err != nil {
+		return "", err
+	}
+	secret, err := store.Get(ctx, r.Account)
+	if errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("%w for %s in %s", ErrNotFound, r.Account, r.Store)
+	}
+	return secret, err
+}
+
+// Command runs a password command through the shell and returns the first
+// line of its output
+func Command(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("password command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("password command failed: %w", err)
+	}
+
+	secret, _, _ := strings.Cut(string(out), "\n")
+	secret = strings.TrimSuffix(secret, "\r")
+	if secret == "" {
+		return "", fmt.Errorf("password command printed no password")
+	}
+	return secret, nil
+}
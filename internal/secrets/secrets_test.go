@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRefSource(t *testing.T) {
+	tests := []struct {
+		ref  Ref
+		want Source
+		desc string
+	}{
+		{Ref{}, SourceNone, "not set"},
+		{Ref{Plain: "secret"}, SourceConfig, "in config file"},
+		{Ref{Plain: "secret", Store: VaultStore, Account: "admin@nas"}, SourceVault, "in vault as admin@nas"},
+		{Ref{Store: KeyringStore, Account: "admin@nas"}, SourceKeyring, "in keyring as admin@nas"},
+		{Ref{Command: "pass show nas", Store: VaultStore}, SourceCommand, `from command "pass show nas"`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.ref.Source(); got != tt.want {
+			t.Errorf("%+v.Source() = %q, want %q", tt.ref, got, tt.want)
+		}
+		if got := tt.ref.Describe(); got != tt.desc {
+			t.Errorf("%+v.Describe() = %q, want %q", tt.ref, got, tt.desc)
+		}
+	}
+}
+
+func TestRefLookup(t *testing.T) {
+	ctx := context.Background()
+
+	if got, err := (Ref{}).Lookup(ctx); got != "" || err != nil {
+		t.Errorf("Lookup() with no password = %q, %v", got, err)
+	}
+	if got, err := (Ref{Plain: "secret"}).Lookup(ctx); got != "secret" || err != nil {
+		t.Errorf("Lookup() of plain password = %q, %v", got, err)
+	}
+	if _, err := (Ref{Store: "wallet"}).Lookup(ctx); err == nil {
+		t.Error("expected an unknown store to be rejected")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	ctx := context.Background()
+
+	got, err := Command(ctx, "printf 's3cret\\nuser: admin\\n'")
+	if err != nil || got != "s3cret" {
+		t.Errorf("Command() = %q, %v; want the first line", got, err)
+	}
+
+	if _, err := Command(ctx, "echo locked >&2; exit 1"); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("expected the command's stderr in the error, got %v", err)
+	}
+	if _, err := Command(ctx, "true"); err == nil {
+		t.Error("expected empty output to be rejected")
+	}
+
+	got, err = (Ref{Plain: "ignored", Command: "echo from-command"}).Lookup(ctx)
+	if err != nil || got != "from-command" {
+		t.Errorf("Lookup() = %q, %v; want the command output", got, err)
+	}
+}
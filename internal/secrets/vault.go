@@ -0,0 +1,240 @@
+package secrets
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// VaultPassphraseEnv names the environment variable that unlocks the vault
+// without a prompt
+const VaultPassphraseEnv = "SYNO_VM_VAULT_PASSPHRASE"
+
+// scrypt work factor of new vaults, as recommended for interactive logins
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// PassphraseFunc returns the vault passphrase. create is true when the vault
+// does not exist yet, so a new passphrase is being chosen.
+type PassphraseFunc func(create bool) (string, error)
+
+// Vault stores secrets in a local file encrypted with XChaCha20-Poly1305
+// under a key derived from a passphrase with scrypt
+type Vault struct {
+	path       string
+	passphrase PassphraseFunc
+}
+
+var _ Store = (*Vault)(nil)
+
+// vaultFile is the on-disk format of the vault. The scrypt parameters are
+// stored so the work factor can be raised for new vaults later.
+type vaultFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// DefaultVaultPath returns the default location of the vault,
+// ~/.syno-vm/vault
+func DefaultVaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".syno-vm", "vault"), nil
+}
+
+// NewVault returns the vault stored at path, unlocked with passphrase
+func NewVault(path string, passphrase PassphraseFunc) *Vault {
+	return &Vault{path: path, passphrase: passphrase}
+}
+
+// Name returns VaultStore
+func (v *Vault) Name() string {
+	return VaultStore
+}
+
+// Get returns the secret of account
+func (v *Vault) Get(ctx context.Context, account string) (string, error) {
+	if !v.exists() {
+		return "", ErrNotFound
+	}
+	entries, _, err := v.open()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := entries[account]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set stores the secret of account, creating the vault if necessary
+func (v *Vault) Set(ctx context.Context, account, secret string) error {
+	entries, passphrase, err := v.open()
+	if err != nil {
+		return err
+	}
+	entries[account] = secret
+	return v.save(entries, passphrase)
+}
+
+// Delete removes the secret of account
+func (v *Vault) Delete(ctx context.Context, account string) error {
+	if !v.exists() {
+		return nil
+	}
+	entries, passphrase, err := v.open()
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[account]; !ok {
+		return nil
+	}
+	delete(entries, account)
+	return v.save(entries, passphrase)
+}
+
+// exists reports whether the vault file exists
+func (v *Vault) exists() bool {
+	_, err := os.Stat(v.path)
+	return err == nil
+}
+
+// open decrypts the vault. A missing vault is empty, and the passphrase
+// returned is the new one chosen for it.
+func (v *Vault) open() (map[string]string, string, error) {
+	data, err := os.ReadFile(v.path)
+	if errors.Is(err, os.ErrNotExist) {
+		passphrase, err := v.passphrase(true)
+		if err != nil {
+			return nil, "", err
+		}
+		return map[string]string{}, passphrase, nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read vault: %w", err)
+	}
+
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, "", fmt.Errorf("failed to parse vault %s: %w", v.path, err)
+	}
+	if f.Version != 1 {
+		return nil, "", fmt.Errorf("unsupported vault version %d", f.Version)
+	}
+
+	passphrase, err := v.passphrase(false)
+	if err != nil {
+		return nil, "", err
+	}
+	aead, err := vaultCipher(passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to unlock vault %s: wrong passphrase or corrupted file", v.path)
+	}
+
+	entries := map[string]string{}
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return nil, "", fmt.Errorf("failed to decode vault: %w", err)
+	}
+	return entries, passphrase, nil
+}
+
+// save encrypts entries with a fresh salt and nonce and writes the vault,
+// readable only by the current user
+func (v *Vault) save(entries map[string]string, passphrase string) error {
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode vault: %w", err)
+	}
+
+	f := vaultFile{Version: 1, Salt: make([]byte, 16), N: scryptN, R: scryptR, P: scryptP, Nonce: make([]byte, chacha20poly1305.NonceSizeX)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	aead, err := vaultCipher(passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return err
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode vault: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return fmt.Errorf("failed to create vault directory: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a failed write cannot lose
+	// the existing secrets
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	return nil
+}
+
+// vaultCipher derives the vault key from the passphrase
+func vaultCipher(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive vault key: %w", err)
+	}
+	return chacha20poly1305.NewX(key)
+}
+
+// EnvOrPromptPassphrase reads the vault passphrase from VaultPassphraseEnv,
+// or asks for it on the terminal
+func EnvOrPromptPassphrase(create bool) (string, error) {
+	if passphrase := os.Getenv(VaultPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !create {
+		return readPassword("Vault passphrase: ")
+	}
+
+	passphrase, err := readPassword("New vault passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the vault passphrase must not be empty")
+	}
+	again, err := readPassword("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if again != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fixedPassphrase returns a PassphraseFunc that always answers passphrase
+// and counts how often new vaults are created
+func fixedPassphrase(passphrase string, created *int) PassphraseFunc {
+	return func(create bool) (string, error) {
+		if create && created != nil {
+			*created++
+		}
+		return passphrase, nil
+	}
+}
+
+func TestVault(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), ".syno-vm", "vault")
+	var created int
+	v := NewVault(path, fixedPassphrase("correct horse", &created))
+
+	if _, err := v.Get(ctx, "admin@nas"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() on a missing vault = %v, want ErrNotFound", err)
+	}
+	if created != 0 {
+		t.Error("Get() asked for a new passphrase")
+	}
+
+	if err := v.Set(ctx, "admin@nas", "s3cret"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := v.Set(ctx, "ops@lab", "other"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if created != 1 {
+		t.Errorf("created %d vaults, want 1", created)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Error("vault holds the secret in clear text")
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("vault mode = %o, want 600", perm)
+		}
+	}
+
+	if got, err := v.Get(ctx, "admin@nas"); err != nil || got != "s3cret" {
+		t.Errorf("Get() = %q, %v", got, err)
+	}
+
+	if err := v.Delete(ctx, "admin@nas"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := v.Get(ctx, "admin@nas"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() = %v, want ErrNotFound", err)
+	}
+	if got, err := v.Get(ctx, "ops@lab"); err != nil || got != "other" {
+		t.Errorf("Delete() removed another secret: %q, %v", got, err)
+	}
+
+	wrong := NewVault(path, fixedPassphrase("battery staple", nil))
+	if _, err := wrong.Get(ctx, "ops@lab"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("expected a wrong passphrase to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+)
+
+// openAPIPath serves the OpenAPI document. It needs no token.
+const openAPIPath = "/openapi.json"
+
+// enums lists the values of string types with a fixed set of values
+var enums = map[reflect.Type][]string{
+	reflect.TypeOf(synology.VMState("")): stateNames(),
+}
+
+func stateNames() []string {
+	names := make([]string, len(synology.VMStates))
+	for i, state := range synology.VMStates {
+		names[i] = string(state)
+	}
+	return names
+}
+
+// OpenAPI returns the OpenAPI 3 document describing the API, generated
+// from the route table
+func (s *Server) OpenAPI() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+
+	for _, rt := range s.routes {
+		var params []interface{}
+		for _, name := range rt.pathParams() {
+			params = append(params, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, p := range rt.query {
+			params = append(params, map[string]interface{}{
+				"name":        p.name,
+				"in":          "query",
+				"description": p.description,
+				"schema":      map[string]interface{}{"type": p.typ},
+			})
+		}
+
+		op := map[string]interface{}{
+			"operationId": rt.id,
+			"summary":     rt.summary,
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if rt.body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": !rt.optionalBody,
+				"content":  jsonContent(schemaOf(reflect.TypeOf(rt.body), schemas)),
+			}
+		}
+
+		op["responses"] = map[string]interface{}{
+			strconv.Itoa(rt.status): map[string]interface{}{
+				"description": http.StatusText(rt.status),
+				"content":     jsonContent(schemaOf(reflect.TypeOf(rt.result), schemas)),
+			},
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     jsonContent(schemaOf(reflect.TypeOf(Error{}), schemas)),
+			},
+		}
+
+		item, _ := paths[rt.path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = op
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "syno-vm API",
+			"description": "Manage virtual machines on a Synology NAS",
+			"version":     s.version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+	if s.token != "" {
+		doc["components"].(map[string]interface{})["securitySchemes"] = map[string]interface{}{
+			"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+		}
+		doc["security"] = []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}}
+	}
+	return doc
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// schemaOf returns the JSON schema of t. Named structs are added to schemas
+// and referenced.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if values, ok := enums[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+		schema := map[string]interface{}{"type": "object"}
+		schemas[t.Name()] = schema // registered first so recursive types terminate
+
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type, schemas)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema["properties"] = properties
+		if required != nil {
+			schema["required"] = required
+		}
+		return ref
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	srv := New(nil, Options{Token: testToken, Version: "1.2.3"})
+
+	// Round trip through JSON as clients see it
+	data, err := json.Marshal(srv.OpenAPI())
+	if err != nil {
+		t.Fatalf("failed to encode OpenAPI document: %v", err)
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas         map[string]map[string]interface{} `json:"schemas"`
+			SecuritySchemes map[string]interface{}            `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("failed to decode OpenAPI document: %v", err)
+	}
+
+	if doc.OpenAPI != "3.0.3" || doc.Info.Version != "1.2.3" {
+		t.Errorf("unexpected header: %s %s", doc.OpenAPI, doc.Info.Version)
+	}
+	if _, ok := doc.Components.SecuritySchemes["bearerAuth"]; !ok {
+		t.Error("expected a bearer security scheme")
+	}
+
+	for _, rt := range srv.routes {
+		op, ok := doc.Paths[rt.path][strings.ToLower(rt.method)]
+		if !ok {
+			t.Errorf("%s %s missing from the document", rt.method, rt.path)
+			continue
+		}
+		if op["operationId"] != rt.id {
+			t.Errorf("%s %s: operationId %v", rt.method, rt.path, op["operationId"])
+		}
+		responses, _ := op["responses"].(map[string]interface{})
+		if _, ok := responses[strconv.Itoa(rt.status)]; !ok {
+			t.Errorf("%s %s: no %d response", rt.method, rt.path, rt.status)
+		}
+		if (rt.body != nil) != (op["requestBody"] != nil) {
+			t.Errorf("%s %s: requestBody mismatch", rt.method, rt.path)
+		}
+	}
+
+	vm, ok := doc.Components.Schemas["VM"]
+	if !ok {
+		t.Fatal("VM schema missing")
+	}
+	properties, _ := vm["properties"].(map[string]interface{})
+	status, _ := properties["status"].(map[string]interface{})
+	if enum, _ := status["enum"].([]interface{}); len(enum) == 0 {
+		t.Errorf("expected VM status to be an enum, got %v", status)
+	}
+	if _, ok := doc.Components.Schemas["Domain"]; !ok {
+		t.Error("expected nested Domain schema")
+	}
+
+	required, _ := doc.Components.Schemas["VMConfig"]["required"].([]interface{})
+	if len(required) != 3 {
+		t.Errorf("expected name, cpu and memory to be required in VMConfig, got %v", required)
+	}
+}
+
+func TestOpenAPIServedWithoutToken(t *testing.T) {
+	var doc map[string]interface{}
+	if code := do(t, nil, http.MethodGet, openAPIPath, "", &doc); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if doc["paths"] == nil {
+		t.Error("expected paths in the document")
+	}
+}
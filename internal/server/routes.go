@@ -0,0 +1,367 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+)
+
+// routeTable lists the API endpoints in the order they are documented
+func (s *Server) routeTable() []route {
+	return []route{
+		{
+			method:  http.MethodGet,
+			path:    "/v1/vms",
+			id:      "listVMs",
+			summary: "List virtual machines",
+			query: []param{
+				{name: "state", typ: "string", description: "Only list VMs in this state"},
+			},
+			result: []synology.VM{},
+			status: http.StatusOK,
+			handle: s.listVMs,
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/v1/vms",
+			id:      "createVM",
+			summary: "Create a virtual machine",
+			body:    synology.VMConfig{},
+			result:  Message{},
+			status:  http.StatusCreated,
+			handle:  s.createVM,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/v1/vms/{name}",
+			id:      "getVM",
+			summary: "Get the status of a virtual machine",
+			query: []param{
+				{name: "detail", typ: "boolean", description: "Include the full VM definition"},
+			},
+			result: synology.VM{},
+			status: http.StatusOK,
+			handle: s.getVM,
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/v1/vms/{name}",
+			id:      "deleteVM",
+			summary: "Delete a virtual machine",
+			result:  Message{},
+			status:  http.StatusOK,
+			handle:  s.deleteVM,
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/v1/vms/{name}/start",
+			id:      "startVM",
+			summary: "Start a virtual machine",
+			result:  Message{},
+			status:  http.StatusOK,
+			handle:  s.startVM,
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/v1/vms/{name}/stop",
+			id:      "stopVM",
+			summary: "Shut down a virtual machine",
+			query: []param{
+				{name: "force", typ: "boolean", description: "Power off immediately instead of requesting a shutdown"},
+			},
+			result: Message{},
+			status: http.StatusOK,
+			handle: s.stopVM,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/v1/vms/{name}/snapshots",
+			id:      "listSnapshots",
+			summary: "List the snapshots of a virtual machine",
+			result:  []synology.Snapshot{},
+			status:  http.StatusOK,
+			handle:  s.listSnapshots,
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/v1/vms/{name}/snapshots",
+			id:      "createSnapshot",
+			summary: "Take a snapshot of a virtual machine",
+			body:    synology.SnapshotOptions{},
+			result:  Message{},
+			status:  http.StatusCreated,
+			handle:  s.createSnapshot,
+
+			optionalBody: true,
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/v1/vms/{name}/snapshots/{snapshot}/revert",
+			id:      "revertSnapshot",
+			summary: "Revert a virtual machine to a snapshot",
+			result:  Message{},
+			status:  http.StatusOK,
+			handle:  s.revertSnapshot,
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/v1/vms/{name}/snapshots/{snapshot}",
+			id:      "deleteSnapshot",
+			summary: "Delete a snapshot",
+			result:  Message{},
+			status:  http.StatusOK,
+			handle:  s.deleteSnapshot,
+		},
+	}
+}
+
+// vmName returns the validated {name} path parameter
+func (r *request) vmName() (string, error) {
+	name := r.params["name"]
+	if err := synology.ValidateVMName(name); err != nil {
+		return "", badRequest(err)
+	}
+	return name, nil
+}
+
+// snapshotName returns the validated {snapshot} path parameter
+func (r *request) snapshotName() (string, error) {
+	name := r.params["snapshot"]
+	if err := synology.ValidateSnapshotName(name); err != nil {
+		return "", badRequest(err)
+	}
+	return name, nil
+}
+
+// validState reports whether state is one of the normalised states
+func validState(state synology.VMState) bool {
+	for _, s := range synology.VMStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotManager returns the manager's snapshot support, if it has any
+func (s *Server) snapshotManager() (synology.SnapshotManager, error) {
+	sm, ok := s.manager.(synology.SnapshotManager)
+	if !ok {
+		return nil, &httpError{
+			status: http.StatusNotImplemented,
+			err:    fmt.Errorf("snapshots are not supported by the configured backend; use the virsh or synowebapi backend"),
+		}
+	}
+	return sm, nil
+}
+
+func (s *Server) listVMs(r *request) (interface{}, error) {
+	var want synology.VMState
+	if state := r.URL.Query().Get("state"); state != "" {
+		if want = synology.ParseVMState(state); !validState(want) {
+			names := make([]string, len(synology.VMStates))
+			for i, v := range synology.VMStates {
+				names[i] = string(v)
+			}
+			return nil, badRequest(fmt.Errorf("invalid state %q: must be one of %s", state, strings.Join(names, ", ")))
+		}
+	}
+
+	vms, err := s.manager.ListVMs(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	if vms == nil {
+		vms = []synology.VM{}
+	}
+
+	if want == "" {
+		return vms, nil
+	}
+	filtered := []synology.VM{}
+	for _, vm := range vms {
+		if vm.Status == want {
+			filtered = append(filtered, vm)
+		}
+	}
+	return filtered, nil
+}
+
+func (s *Server) createVM(r *request) (interface{}, error) {
+	var config synology.VMConfig
+	if err := r.decode(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, badRequest(err)
+	}
+	defer s.lockVM(config.Name)()
+
+	if err := s.manager.CreateVM(r.Context(), config); err != nil {
+		return nil, err
+	}
+	return Message{Message: fmt.Sprintf("VM %s created", config.Name)}, nil
+}
+
+func (s *Server) getVM(r *request) (interface{}, error) {
+	name, err := r.vmName()
+	if err != nil {
+		return nil, err
+	}
+	detail, err := r.boolQuery("detail")
+	if err != nil {
+		return nil, err
+	}
+
+	vm, err := s.manager.GetVMStatus(r.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	if detail {
+		inspector, ok := s.manager.(synology.DomainInspector)
+		if !ok {
+			return nil, &httpError{
+				status: http.StatusNotImplemented,
+				err:    fmt.Errorf("VM definitions are not supported by the configured backend; use the virsh or synowebapi backend"),
+			}
+		}
+		if vm.Domain, err = inspector.GetDomain(r.Context(), name); err != nil {
+			return nil, err
+		}
+	}
+	return vm, nil
+}
+
+func (s *Server) deleteVM(r *request) (interface{}, error) {
+	name, err := r.vmName()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.manager.DeleteVM(r.Context(), name); err != nil {
+		return nil, err
+	}
+	return Message{Message: fmt.Sprintf("VM %s deleted", name)}, nil
+}
+
+func (s *Server) startVM(r *request) (interface{}, error) {
+	name, err := r.vmName()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.manager.StartVM(r.Context(), name); err != nil {
+		return nil, err
+	}
+	return Message{Message: fmt.Sprintf("VM %s started", name)}, nil
+}
+
+func (s *Server) stopVM(r *request) (interface{}, error) {
+	name, err := r.vmName()
+	if err != nil {
+		return nil, err
+	}
+	force, err := r.boolQuery("force")
+	if err != nil {
+		return nil, err
+	}
+
+	if force {
+		if err := s.manager.PowerOffVM(r.Context(), name); err != nil {
+			return nil, err
+		}
+		return Message{Message: fmt.Sprintf("VM %s powered off", name)}, nil
+	}
+
+	if err := s.manager.StopVM(r.Context(), name); err != nil {
+		return nil, err
+	}
+	return Message{Message: fmt.Sprintf("Shutdown requested for VM %s", name)}, nil
+}
+
+func (s *Server) listSnapshots(r *request) (interface{}, error) {
+	name, err := r.vmName()
+	if err != nil {
+		return nil, err
+	}
+	sm, err := s.snapshotManager()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := sm.ListSnapshots(r.Context(), name)
+	if err != nil {
+		return nil, err
+	}
+	if snapshots == nil {
+		snapshots = []synology.Snapshot{}
+	}
+	return snapshots, nil
+}
+
+func (s *Server) createSnapshot(r *request) (interface{}, error) {
+	name, err := r.vmName()
+	if err != nil {
+		return nil, err
+	}
+	sm, err := s.snapshotManager()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts synology.SnapshotOptions
+	if err := r.decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Name != "" {
+		if err := synology.ValidateSnapshotName(opts.Name); err != nil {
+			return nil, badRequest(err)
+		}
+	}
+
+	if err := sm.CreateSnapshot(r.Context(), name, opts); err != nil {
+		return nil, err
+	}
+	return Message{Message: fmt.Sprintf("Snapshot of VM %s created", name)}, nil
+}
+
+func (s *Server) revertSnapshot(r *request) (interface{}, error) {
+	name, err := r.vmName()
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := r.snapshotName()
+	if err != nil {
+		return nil, err
+	}
+	sm, err := s.snapshotManager()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sm.RevertSnapshot(r.Context(), name, snapshot); err != nil {
+		return nil, err
+	}
+	return Message{Message: fmt.Sprintf("VM %s reverted to snapshot %s", name, snapshot)}, nil
+}
+
+func (s *Server) deleteSnapshot(r *request) (interface{}, error) {
+	name, err := r.vmName()
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := r.snapshotName()
+	if err != nil {
+		return nil, err
+	}
+	sm, err := s.snapshotManager()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sm.DeleteSnapshot(r.Context(), name, snapshot); err != nil {
+		return nil, err
+	}
+	return Message{Message: fmt.Sprintf("Snapshot %s deleted", snapshot)}, nil
+}
@@ -0,0 +1,302 @@
+// Package server exposes a VM manager as a JSON REST API. The same route
+// table dispatches requests and generates the OpenAPI document.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+)
+
+// Server serves the REST API for a VM manager
+type Server struct {
+	manager synology.VMManager
+	token   string
+	version string
+	routes  []route
+
+	// locks serialises requests for the same VM, so that e.g. a start and
+	// a stop do not interleave; requests for different VMs run concurrently
+	locksMu sync.Mutex
+	locks   map[string]*vmLock
+}
+
+// vmLock is the lock of one VM, dropped once no request holds or waits
+// for it
+type vmLock struct {
+	mu   sync.Mutex
+	refs int // guarded by Server.locksMu
+}
+
+// maxBodySize bounds request bodies, which are small JSON objects
+const maxBodySize = 1 << 20
+
+// Options configures a Server
+type Options struct {
+	// Token, if set, must be sent by clients as "Authorization: Bearer <token>"
+	Token string
+	// Version is reported in the OpenAPI document
+	Version string
+}
+
+// New creates a Server for manager
+func New(manager synology.VMManager, opts Options) *Server {
+	s := &Server{
+		manager: manager,
+		token:   opts.Token,
+		version: opts.Version,
+		locks:   make(map[string]*vmLock),
+	}
+	s.routes = s.routeTable()
+	return s
+}
+
+// Message is the response of endpoints that return no resource
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Error is the response body of failed requests
+type Error struct {
+	Error string `json:"error"`
+}
+
+// param is a path or query parameter of a route
+type param struct {
+	name        string
+	typ         string // OpenAPI type: string, boolean or integer
+	description string
+}
+
+// route is an API endpoint
+type route struct {
+	method  string
+	path    string // segments in braces are path parameters, e.g. /v1/vms/{name}
+	id      string // OpenAPI operationId
+	summary string
+	query   []param
+	body    interface{} // request body type, nil if none
+	result  interface{} // success response type
+	status  int         // success status code
+	handle  func(r *request) (interface{}, error)
+
+	optionalBody bool // the body may be omitted
+}
+
+// request is an incoming request with its path parameters
+type request struct {
+	*http.Request
+	params map[string]string
+	w      http.ResponseWriter
+}
+
+// decode decodes the JSON request body into v. An empty body leaves v
+// unchanged.
+func (r *request) decode(v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(r.w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &httpError{status: http.StatusRequestEntityTooLarge, err: fmt.Errorf("request body larger than %d bytes", tooLarge.Limit)}
+	case err != nil && !errors.Is(err, io.EOF):
+		return badRequest(fmt.Errorf("invalid request body: %w", err))
+	}
+	return nil
+}
+
+// boolQuery returns a boolean query parameter
+func (r *request) boolQuery(name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, badRequest(fmt.Errorf("invalid value %q for %s", value, name))
+	}
+	return b, nil
+}
+
+// httpError is an error with an HTTP status code
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+func (e *httpError) Unwrap() error { return e.err }
+
+func badRequest(err error) error {
+	return &httpError{status: http.StatusBadRequest, err: err}
+}
+
+// errorStatuses maps the errors shared by every backend to HTTP status
+// codes. Authentication errors concern the server's own login to the NAS,
+// not the client's token, so they are reported as a bad gateway.
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{synology.ErrGuestNotFound, http.StatusNotFound},
+	{synology.ErrInvalidRequest, http.StatusBadRequest},
+	{synology.ErrPermissionDenied, http.StatusForbidden},
+	{synology.ErrInvalidCredentials, http.StatusBadGateway},
+	{synology.ErrAccountDisabled, http.StatusBadGateway},
+	{synology.ErrPasswordExpired, http.StatusBadGateway},
+	{synology.ErrOTPRequired, http.StatusBadGateway},
+	{synology.ErrOTPInvalid, http.StatusBadGateway},
+	{synology.ErrOTPEnforced, http.StatusBadGateway},
+	{synology.ErrSessionExpired, http.StatusBadGateway},
+	{synology.ErrGuestRunning, http.StatusConflict},
+	{synology.ErrGuestStopped, http.StatusConflict},
+	{synology.ErrNameConflict, http.StatusConflict},
+	{synology.ErrAPINotAvailable, http.StatusNotImplemented},
+	{synology.ErrBusy, http.StatusServiceUnavailable},
+}
+
+// errorStatus returns the HTTP status code for an error returned by a handler
+func errorStatus(err error) int {
+	var he *httpError
+	if errors.As(err, &he) {
+		return he.status
+	}
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.err) {
+			return e.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// match reports whether path matches the route's path, returning the path
+// parameters if it does
+func (rt route) match(path string) (map[string]string, bool) {
+	want := strings.Split(strings.Trim(rt.path, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range want {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			if got[i] == "" {
+				return nil, false
+			}
+			params[strings.TrimSuffix(name, "}")] = got[i]
+			continue
+		}
+		if segment != got[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// pathParams returns the names of the route's path parameters
+func (rt route) pathParams() []string {
+	var names []string
+	for _, segment := range strings.Split(rt.path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			names = append(names, strings.TrimSuffix(name, "}"))
+		}
+	}
+	return names
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == openAPIPath {
+		writeJSON(w, http.StatusOK, s.OpenAPI())
+		return
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="syno-vm"`)
+		writeJSON(w, http.StatusUnauthorized, Error{Error: "missing or invalid token"})
+		return
+	}
+
+	var allowed []string
+	for _, rt := range s.routes {
+		params, ok := rt.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		if rt.method != r.Method {
+			allowed = append(allowed, rt.method)
+			continue
+		}
+
+		if name := params["name"]; name != "" {
+			defer s.lockVM(name)()
+		}
+		result, err := rt.handle(&request{Request: r, params: params, w: w})
+		if err != nil {
+			writeJSON(w, errorStatus(err), Error{Error: err.Error()})
+			return
+		}
+		writeJSON(w, rt.status, result)
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeJSON(w, http.StatusMethodNotAllowed, Error{Error: fmt.Sprintf("method %s not allowed", r.Method)})
+		return
+	}
+	writeJSON(w, http.StatusNotFound, Error{Error: fmt.Sprintf("no such endpoint: %s", r.URL.Path)})
+}
+
+// lockVM waits until no other request holds the VM name and returns the
+// function that releases it
+func (s *Server) lockVM(name string) func() {
+	s.locksMu.Lock()
+	l, ok := s.locks[name]
+	if !ok {
+		l = &vmLock{}
+		s.locks[name] = l
+	}
+	l.refs++
+	s.locksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		s.locksMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, name)
+		}
+		s.locksMu.Unlock()
+	}
+}
+
+// authorized checks the request's bearer token
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v) // The client may have gone away
+}
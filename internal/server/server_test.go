@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/syno-vm/internal/synology"
+	"github.com/scttfrdmn/syno-vm/test/mock"
+)
+
+const testToken = "secret"
+
+// do sends a request to a server for m and decodes the JSON response into
+// out, returning the status code
+func do(t *testing.T, m synology.VMManager, method, path, body string, out interface{}) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+
+	New(m, Options{Token: testToken, Version: "test"}).ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: expected JSON response, got Content-Type %q", method, path, ct)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: failed to decode response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := New(mock.NewMockClient(), Options{Token: testToken})
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"no token", "/v1/vms", "", http.StatusUnauthorized},
+		{"wrong token", "/v1/vms", "Bearer wrong", http.StatusUnauthorized},
+		{"wrong scheme", "/v1/vms", "Basic " + testToken, http.StatusUnauthorized},
+		{"valid token", "/v1/vms", "Bearer " + testToken, http.StatusOK},
+		{"openapi without token", "/openapi.json", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestNoTokenConfigured(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/vms", nil)
+	rec := httptest.NewRecorder()
+	New(mock.NewMockClient(), Options{}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 without a configured token, got %d", rec.Code)
+	}
+}
+
+// TestConcurrentRequests sends requests for the same and for different VMs
+// in parallel. Run it with -race.
+func TestConcurrentRequests(t *testing.T) {
+	srv := New(mock.NewMockClient(), Options{Token: testToken})
+	requests := []struct{ method, path string }{
+		{http.MethodPost, "/v1/vms/test-vm-1/start"},
+		{http.MethodPost, "/v1/vms/test-vm-1/stop?force=true"},
+		{http.MethodGet, "/v1/vms/test-vm-1"},
+		{http.MethodGet, "/v1/vms/test-vm-2"},
+		{http.MethodGet, "/v1/vms"},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		rq := requests[i%len(requests)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(rq.method, rq.path, nil)
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s %s: expected 200, got %d", rq.method, rq.path, rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLockVM(t *testing.T) {
+	srv := New(mock.NewMockClient(), Options{})
+	unlock := srv.lockVM("web")
+
+	// Other VMs are not held up
+	done := make(chan struct{})
+	go func() {
+		srv.lockVM("db")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("locking another VM blocked")
+	}
+
+	// The same VM waits for the lock to be released
+	locked := make(chan struct{})
+	go func() {
+		srv.lockVM("web")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("locked a VM that was already locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	srv.locksMu.Lock()
+	defer srv.locksMu.Unlock()
+	if len(srv.locks) != 0 {
+		t.Errorf("expected unused locks to be dropped, got %d", len(srv.locks))
+	}
+}
+
+func TestVMEndpoints(t *testing.T) {
+	m := mock.NewMockClient()
+
+	var vms []synology.VM
+	if code := do(t, m, http.MethodGet, "/v1/vms", "", &vms); code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d", code)
+	}
+	if len(vms) != 2 {
+		t.Fatalf("list: expected 2 VMs, got %d", len(vms))
+	}
+
+	if code := do(t, m, http.MethodGet, "/v1/vms?state=running", "", &vms); code != http.StatusOK {
+		t.Fatalf("list running: expected 200, got %d", code)
+	}
+	if len(vms) != 1 || vms[0].Name != "test-vm-1" {
+		t.Errorf("list running: unexpected VMs %+v", vms)
+	}
+
+	var vm synology.VM
+	if code := do(t, m, http.MethodGet, "/v1/vms/test-vm-2", "", &vm); code != http.StatusOK {
+		t.Fatalf("get: expected 200, got %d", code)
+	}
+	if vm.Name != "test-vm-2" || vm.Status != synology.StateStopped {
+		t.Errorf("get: unexpected VM %+v", vm)
+	}
+
+	var msg Message
+	if code := do(t, m, http.MethodPost, "/v1/vms/test-vm-2/start", "", &msg); code != http.StatusOK {
+		t.Fatalf("start: expected 200, got %d (%s)", code, msg.Message)
+	}
+	if status, _ := m.GetVMStatus(context.Background(), "test-vm-2"); status.Status != synology.StateRunning {
+		t.Errorf("start: VM is %s", status.Status)
+	}
+
+	if code := do(t, m, http.MethodPost, "/v1/vms/test-vm-2/stop?force=true", "", &msg); code != http.StatusOK {
+		t.Fatalf("stop: expected 200, got %d", code)
+	}
+	if status, _ := m.GetVMStatus(context.Background(), "test-vm-2"); status.Status != synology.StateStopped {
+		t.Errorf("stop: VM is %s", status.Status)
+	}
+
+	body := `{"name": "new-vm", "cpu": 2, "memory": 1024, "storage": "/volume1/vm/new-vm.qcow2"}`
+	if code := do(t, m, http.MethodPost, "/v1/vms", body, &msg); code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d (%s)", code, msg.Message)
+	}
+	if _, err := m.GetVMStatus(context.Background(), "new-vm"); err != nil {
+		t.Errorf("create: VM was not created: %v", err)
+	}
+
+	if code := do(t, m, http.MethodDelete, "/v1/vms/new-vm", "", &msg); code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", code)
+	}
+	if _, err := m.GetVMStatus(context.Background(), "new-vm"); err == nil {
+		t.Error("delete: VM still exists")
+	}
+}
+
+func TestSnapshotEndpoints(t *testing.T) {
+	m := mock.NewMockClient()
+
+	var msg Message
+	body := `{"name": "before-upgrade", "description": "pre upgrade"}`
+	if code := do(t, m, http.MethodPost, "/v1/vms/test-vm-1/snapshots", body, &msg); code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d", code)
+	}
+
+	var snapshots []synology.Snapshot
+	if code := do(t, m, http.MethodGet, "/v1/vms/test-vm-1/snapshots", "", &snapshots); code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d", code)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "before-upgrade" {
+		t.Fatalf("list: unexpected snapshots %+v", snapshots)
+	}
+
+	if code := do(t, m, http.MethodPost, "/v1/vms/test-vm-1/snapshots/before-upgrade/revert", "", &msg); code != http.StatusOK {
+		t.Fatalf("revert: expected 200, got %d", code)
+	}
+	if code := do(t, m, http.MethodDelete, "/v1/vms/test-vm-1/snapshots/before-upgrade", "", &msg); code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", code)
+	}
+	if code := do(t, m, http.MethodGet, "/v1/vms/test-vm-1/snapshots", "", &snapshots); code != http.StatusOK || len(snapshots) != 0 {
+		t.Errorf("list after delete: got %d, %+v", code, snapshots)
+	}
+}
+
+// vmOnly hides the optional interfaces of a manager
+type vmOnly struct{ synology.VMManager }
+
+func TestErrors(t *testing.T) {
+	m := mock.NewMockClient()
+	failing := mock.NewMockClient()
+	failing.Fail["StartVM"] = true
+
+	tests := []struct {
+		name    string
+		manager synology.VMManager
+		method  string
+		path    string
+		body    string
+		want    int
+	}{
+		{"unknown endpoint", m, http.MethodGet, "/v1/templates", "", http.StatusNotFound},
+		{"wrong method", m, http.MethodPut, "/v1/vms", "", http.StatusMethodNotAllowed},
+		{"invalid VM name", m, http.MethodPost, "/v1/vms/-rf/start", "", http.StatusBadRequest},
+		{"invalid body", m, http.MethodPost, "/v1/vms", `{"name": "x", "cpus": 2}`, http.StatusBadRequest},
+		{"invalid config", m, http.MethodPost, "/v1/vms", `{"name": "x", "cpu": 0, "memory": 512}`, http.StatusBadRequest},
+		{"invalid query", m, http.MethodPost, "/v1/vms/test-vm-1/stop?force=maybe", "", http.StatusBadRequest},
+		{"unknown state", m, http.MethodGet, "/v1/vms?state=sleeping", "", http.StatusBadRequest},
+		{"body too large", m, http.MethodPost, "/v1/vms", `{"name": "` + strings.Repeat("x", maxBodySize) + `"}`, http.StatusRequestEntityTooLarge},
+		{"missing VM", m, http.MethodPost, "/v1/vms/missing-vm/start", "", http.StatusNotFound},
+		{"backend failure", failing, http.MethodPost, "/v1/vms/test-vm-1/start", "", http.StatusInternalServerError},
+		{"snapshots unsupported", vmOnly{m}, http.MethodGet, "/v1/vms/test-vm-1/snapshots", "", http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp Error
+			if code := do(t, tt.manager, tt.method, tt.path, tt.body, &resp); code != tt.want {
+				t.Errorf("expected %d, got %d (%s)", tt.want, code, resp.Error)
+			}
+			if resp.Error == "" {
+				t.Error("expected an error message")
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("failed to start VM: %w", synology.ErrPermissionDenied), http.StatusForbidden},
+		{synology.ErrInvalidRequest, http.StatusBadRequest},
+		{fmt.Errorf("authentication failed: %w", synology.ErrInvalidCredentials), http.StatusBadGateway},
+		{synology.ErrOTPRequired, http.StatusBadGateway},
+		{synology.ErrBusy, http.StatusServiceUnavailable},
+		{errors.New("ssh: connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
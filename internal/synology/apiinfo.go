@@ -0,0 +1,87 @@
+package synology
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// apiInfo is the discovery API every DSM serves at a fixed path
+const (
+	apiInfo     = "SYNO.API.Info"
+	apiInfoPath = "query.cgi"
+	apiAuth     = "SYNO.API.Auth"
+)
+
+// vmmAPIPrefix is the namespace of the Virtual Machine Manager APIs
+const vmmAPIPrefix = "SYNO.Virtualization."
+
+// APIInfo describes a Web API as reported by SYNO.API.Info
+type APIInfo struct {
+	Path       string `json:"path"`
+	MinVersion int    `json:"minVersion"`
+	MaxVersion int    `json:"maxVersion"`
+}
+
+// APIDirectory holds the APIs a NAS provides, by name. Only the APIs
+// syno-vm uses are kept: SYNO.API.Auth and the SYNO.Virtualization family.
+type APIDirectory map[string]APIInfo
+
+// discovered reports whether an API belongs to the family kept in an
+// APIDirectory, so its absence means DSM lacks it
+func discovered(api string) bool {
+	return api == apiAuth || strings.HasPrefix(api, vmmAPIPrefix)
+}
+
+// Resolve returns the path of an API and the version to call. An empty
+// version selects the highest one DSM supports; an explicit one must be
+// supported. APIs outside the discovered family resolve to entry.cgi and
+// need an explicit version.
+func (d APIDirectory) Resolve(api, version string) (path, resolved string, err error) {
+	info, ok := d[api]
+	if !ok {
+		if discovered(api) {
+			if strings.HasPrefix(api, vmmAPIPrefix) {
+				return "", "", fmt.Errorf("%w: %s (is Virtual Machine Manager installed?)", ErrAPINotAvailable, api)
+			}
+			return "", "", fmt.Errorf("%w: %s", ErrAPINotAvailable, api)
+		}
+		if version == "" {
+			return "", "", fmt.Errorf("no version given for %s, which is not discovered", api)
+		}
+		return "entry.cgi", version, nil
+	}
+
+	if version == "" {
+		return info.Path, strconv.Itoa(info.MaxVersion), nil
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid version %q for %s", version, api)
+	}
+	if v < info.MinVersion || v > info.MaxVersion {
+		return "", "", fmt.Errorf("%s version %d is not supported by this DSM (supported: %d-%d)", api, v, info.MinVersion, info.MaxVersion)
+	}
+	return info.Path, version, nil
+}
+
+// parseAPIDirectory extracts the discovered family from a SYNO.API.Info
+// query response
+func parseAPIDirectory(resp *WebAPIResponse) (APIDirectory, error) {
+	if !resp.Success {
+		return nil, responseError(apiInfo, "query", resp)
+	}
+
+	var all map[string]APIInfo
+	if err := decodeData(resp, &all); err != nil {
+		return nil, err
+	}
+
+	dir := APIDirectory{}
+	for name, info := range all {
+		if discovered(name) {
+			dir[name] = info
+		}
+	}
+	return dir, nil
+}
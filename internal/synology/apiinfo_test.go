@@ -0,0 +1,133 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testAPIs is what SYNO.API.Info reports on a DSM 7 NAS with Virtual
+// Machine Manager installed
+var testAPIs = map[string]APIInfo{
+	"SYNO.API.Auth":                        {Path: "entry.cgi", MinVersion: 1, MaxVersion: 7},
+	"SYNO.API.Info":                        {Path: "query.cgi", MinVersion: 1, MaxVersion: 1},
+	"SYNO.Core.System":                     {Path: "entry.cgi", MinVersion: 1, MaxVersion: 3},
+	"SYNO.Virtualization.API.Guest":        {Path: "entry.cgi", MinVersion: 1, MaxVersion: 1},
+	"SYNO.Virtualization.API.Guest.Action": {Path: "entry.cgi", MinVersion: 1, MaxVersion: 2},
+}
+
+// withAPIInfo answers SYNO.API.Info queries with apis and passes other
+// requests to h
+func withAPIInfo(apis map[string]APIInfo, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/webapi/query.cgi" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		data := map[string]interface{}{}
+		for name, info := range apis {
+			data[name] = info
+		}
+		_ = json.NewEncoder(w).Encode(WebAPIResponse{Success: true, Data: data})
+	})
+}
+
+func TestParseAPIDirectory(t *testing.T) {
+	data := map[string]interface{}{}
+	for name, info := range testAPIs {
+		data[name] = info
+	}
+
+	dir, err := parseAPIDirectory(&WebAPIResponse{Success: true, Data: data})
+	if err != nil {
+		t.Fatalf("parseAPIDirectory() error = %v", err)
+	}
+	if len(dir) != 3 {
+		t.Errorf("kept %d APIs, want SYNO.API.Auth and the VMM APIs: %v", len(dir), dir)
+	}
+	if _, ok := dir["SYNO.Core.System"]; ok {
+		t.Error("kept an API outside the VMM family")
+	}
+
+	if _, err := parseAPIDirectory(&WebAPIResponse{Error: &WebAPIError{Code: 102}}); err == nil {
+		t.Error("expected a failed query to be reported")
+	}
+}
+
+func TestAPIDirectoryResolve(t *testing.T) {
+	dir := APIDirectory{}
+	for name, info := range testAPIs {
+		if discovered(name) {
+			dir[name] = info
+		}
+	}
+
+	tests := []struct {
+		api, version string
+		wantPath     string
+		wantVersion  string
+		wantErr      string
+	}{
+		{apiAuth, "", "entry.cgi", "7", ""},
+		{apiGuestAction, "", "entry.cgi", "2", ""},
+		{apiGuestAction, "1", "entry.cgi", "1", ""},
+		{apiGuestAction, "3", "", "", "not supported"},
+		{apiTemplate, "", "", "", "is Virtual Machine Manager installed"},
+		{"SYNO.Core.System", "3", "entry.cgi", "3", ""},
+		{"SYNO.Core.System", "", "", "", "no version"},
+	}
+
+	for _, tt := range tests {
+		path, version, err := dir.Resolve(tt.api, tt.version)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Resolve(%s, %q) error = %v, want it to contain %q", tt.api, tt.version, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || path != tt.wantPath || version != tt.wantVersion {
+			t.Errorf("Resolve(%s, %q) = %s, %s, %v; want %s, %s", tt.api, tt.version, path, version, err, tt.wantPath, tt.wantVersion)
+		}
+	}
+
+	if _, _, err := dir.Resolve(apiTemplate, ""); !errors.Is(err, ErrAPINotAvailable) {
+		t.Errorf("missing VMM API error = %v, want ErrAPINotAvailable", err)
+	}
+}
+
+func TestWebAPIClientUsesDiscoveredAPIs(t *testing.T) {
+	ctx := context.Background()
+	var requests []string
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+" "+r.FormValue("api")+" v"+r.FormValue("version"))
+		data := map[string]interface{}{}
+		if r.FormValue("method") == "login" {
+			data["sid"] = "sid-1"
+		}
+		_ = json.NewEncoder(w).Encode(WebAPIResponse{Success: true, Data: data})
+	})
+
+	w := newTestWebAPIClient(t, api, TwoFactor{})
+	if _, err := w.CallAPI(ctx, apiGuestAction, "poweron", "", nil); err != nil {
+		t.Fatalf("CallAPI() error = %v", err)
+	}
+	want := []string{
+		"/webapi/entry.cgi " + apiAuth + " v7",
+		"/webapi/entry.cgi " + apiGuestAction + " v2",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+
+	_, err := w.CallAPI(ctx, apiTemplate, "list", "", nil)
+	if !errors.Is(err, ErrAPINotAvailable) {
+		t.Errorf("CallAPI() of a missing API error = %v, want ErrAPINotAvailable", err)
+	}
+	if len(requests) != 2 {
+		t.Errorf("a missing API was called: %v", requests)
+	}
+}
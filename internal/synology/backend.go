@@ -0,0 +1,210 @@
+package synology
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/scttfrdmn/syno-vm/internal/secrets"
+	"github.com/spf13/viper"
+)
+
+// Backend selects how syno-vm talks to Virtual Machine Manager
+type Backend string
+
+const (
+	// BackendVirsh runs libvirt's virsh over SSH
+	BackendVirsh Backend = "virsh"
+	// BackendSynoWebAPI runs the synowebapi tool over SSH
+	BackendSynoWebAPI Backend = "synowebapi"
+	// BackendWebAPI calls the DSM Web API over HTTPS
+	BackendWebAPI Backend = "webapi"
+	// BackendAuto probes the NAS for the first backend that works
+	BackendAuto Backend = "auto"
+)
+
+// Backends lists all valid backend names
+var Backends = []Backend{BackendVirsh, BackendSynoWebAPI, BackendWebAPI, BackendAuto}
+
+// ParseBackend validates a backend name. An empty name selects BackendAuto.
+func ParseBackend(name string) (Backend, error) {
+	if name == "" {
+		return BackendAuto, nil
+	}
+	for _, b := range Backends {
+		if string(b) == name {
+			return b, nil
+		}
+	}
+	return "", fmt.Errorf("unknown backend %q (valid backends: virsh, synowebapi, webapi, auto)", name)
+}
+
+// NewManager creates the VM manager for the configured backend. ctx bounds
+// the probing done for BackendAuto.
+func NewManager(ctx context.Context) (VMManager, error) {
+	backend, err := ParseBackend(viper.GetString("backend"))
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case BackendVirsh:
+		client, err := NewClient()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case BackendSynoWebAPI:
+		client, err := NewClient()
+		if err != nil {
+			return nil, err
+		}
+		return NewSynoWebAPIManager(client), nil
+	case BackendWebAPI:
+		webClient, err := NewWebAPIClientFromConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewVMMClient(webClient), nil
+	default:
+		return probeBackend(ctx)
+	}
+}
+
+// PasswordRef describes where the configuration keeps the Web API password
+func PasswordRef() secrets.Ref {
+	return secrets.Ref{
+		Plain:   viper.GetString("password"),
+		Command: viper.GetString("password_command"),
+		Store:   viper.GetString("password_store"),
+		Account: secrets.Account(viper.GetString("username"), viper.GetString("host")),
+	}
+}
+
+// NewWebAPIClientFromConfig creates a Web API client from the configuration.
+// The password is only looked up in its store when the client has to log
+// in, since a session cached by an earlier invocation may still be valid.
+func NewWebAPIClientFromConfig() (*WebAPIClient, error) {
+	host := viper.GetString("host")
+	username := viper.GetString("username")
+
+	if host == "" {
+		return nil, fmt.Errorf("host not configured. Run 'syno-vm config set --host <hostname>'")
+	}
+	if username == "" {
+		return nil, fmt.Errorf("username not configured. Run 'syno-vm config set --username <username>'")
+	}
+	ref := PasswordRef()
+	if ref.Source() == secrets.SourceNone {
+		return nil, fmt.Errorf("password not configured. Run 'syno-vm config set --password <password>'")
+	}
+
+	client := NewWebAPIClient(host, username, "")
+	client.SetPasswordSource(func(ctx context.Context) (string, error) {
+		password, err := ref.Lookup(ctx)
+		if errors.Is(err, secrets.ErrNotFound) {
+			return "", fmt.Errorf("%w. Run 'syno-vm config set --password <password>'", err)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get password: %w", err)
+		}
+		return password, nil
+	})
+	client.SetTwoFactor(twoFactorFromConfig())
+	if path := viper.GetString("session_file"); path != "" {
+		if err := client.SetSessionCache(NewSessionCache(path)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring cached session: %v\n", err)
+		}
+	}
+	return client, nil
+}
+
+// OTPSecretRef describes where the TOTP secret used for 2-step verification
+// is kept: in the password store, or in clear text next to the password
+func OTPSecretRef() secrets.Ref {
+	return secrets.Ref{
+		Plain:   viper.GetString("otp_secret"),
+		Store:   viper.GetString("password_store"),
+		Account: OTPSecretAccount(viper.GetString("username"), viper.GetString("host")),
+	}
+}
+
+// OTPSecretAccount names the TOTP secret of a user in the password store
+func OTPSecretAccount(username, host string) string {
+	return secrets.Account(username, host) + "/otp"
+}
+
+// twoFactorFromConfig answers 2-step verification with --otp-code, the
+// stored TOTP secret or a prompt, and remembers device tokens
+func twoFactorFromConfig() TwoFactor {
+	tf := TwoFactor{
+		Code: viper.GetString("otp_code"),
+		Secret: func(ctx context.Context) (string, error) {
+			secret, err := OTPSecretRef().Lookup(ctx)
+			if errors.Is(err, secrets.ErrNotFound) {
+				return "", nil
+			}
+			return secret, err
+		},
+		Prompt:     PromptOTP,
+		DeviceName: "syno-vm",
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		tf.DeviceName = "syno-vm on " + hostname
+	}
+	if path, err := DefaultDeviceTokensPath(); err == nil {
+		tf.Devices = NewDeviceTokens(path)
+	}
+	return tf
+}
+
+// probeBackend picks the most capable backend that works on the target NAS.
+// The VMM APIs are preferred over virsh since they see guests the way the
+// VMM UI does; the HTTPS Web API is only tried when a password is configured.
+func probeBackend(ctx context.Context) (VMManager, error) {
+	var failures []string
+
+	if PasswordRef().Source() != secrets.SourceNone {
+		webClient, err := NewWebAPIClientFromConfig()
+		if err == nil {
+			err = webClient.EnsureLogin(ctx)
+		}
+		if err == nil {
+			logBackend(BackendWebAPI)
+			return NewVMMClient(webClient), nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", BackendWebAPI, err))
+	}
+
+	client, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	vmm := NewSynoWebAPIManager(client)
+	if _, err := vmm.ListVMs(ctx); err != nil {
+		failures = append(failures, fmt.Sprintf("%s: %v", BackendSynoWebAPI, err))
+	} else {
+		logBackend(BackendSynoWebAPI)
+		return vmm, nil
+	}
+
+	if _, err := client.executeVirshCommand(ctx, "version"); err != nil {
+		failures = append(failures, fmt.Sprintf("%s: %v", BackendVirsh, err))
+	} else {
+		logBackend(BackendVirsh)
+		return client, nil
+	}
+
+	_ = client.Disconnect()
+	return nil, fmt.Errorf("no usable backend found:\n  %s", strings.Join(failures, "\n  "))
+}
+
+// logBackend reports the probed backend in verbose mode
+func logBackend(backend Backend) {
+	if viper.GetBool("verbose") {
+		fmt.Fprintf(os.Stderr, "Using %s backend\n", backend)
+	}
+}
@@ -2,7 +2,12 @@ package synology
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/viper"
@@ -11,37 +16,67 @@ import (
 
 // Client represents a Synology VMM client
 type Client struct {
-	host       string
-	username   string
-	port       int
-	keyfile    string
-	timeout    time.Duration
-	sshClient  *ssh.Client
+	host        string
+	username    string
+	port        int
+	keyfile     string
+	timeout     time.Duration
+	keepalive   time.Duration
+	controlPath string // control socket of a running control master, if any
+
+	mu   sync.Mutex
+	conn *sharedConn
+
+	insecureSkipHostKeyCheck bool
+	hostKeyPrompt            HostKeyPrompt
 }
 
 // VM represents a virtual machine
 type VM struct {
-	Name      string `json:"name"`
-	Status    string `json:"status"`
-	CPU       int    `json:"cpu"`
-	Memory    int    `json:"memory"`
-	Storage   string `json:"storage"`
-	IPAddress string `json:"ip_address,omitempty"`
+	ID        int     `json:"id,omitempty"` // libvirt domain ID, only set while running
+	Name      string  `json:"name"`
+	Status    VMState `json:"status"`
+	CPU       int     `json:"cpu"`
+	Memory    int     `json:"memory"`
+	Storage   string  `json:"storage"`
+	IPAddress string  `json:"ip_address,omitempty"`
+	Autostart *bool   `json:"autostart,omitempty"` // nil unless the backend lists it; see Domain otherwise
+
+	// Domain is the full VM definition, filled in only when requested
+	Domain *Domain `json:"domain,omitempty"`
 }
 
 // VMConfig represents VM configuration for creation
 type VMConfig struct {
-	Name     string
-	Template string
-	CPU      int
-	Memory   int
-	Storage  string
+	Name     string `json:"name"`
+	Template string `json:"template,omitempty"` // virsh: installation image attached as a CD-ROM; VMM: image to clone the disk from
+	CPU      int    `json:"cpu"`
+	Memory   int    `json:"memory"`              // MB
+	Storage  string `json:"storage,omitempty"`   // virsh: path of the disk image on the NAS; VMM: storage name
+	Network  string `json:"network,omitempty"`   // virsh: host bridge to attach the NIC to; VMM: network name
+	DiskSize int    `json:"disk_size,omitempty"` // VMM: size of the new virtual disk in GB
+	ISO      string `json:"iso,omitempty"`       // VMM: ISO image name to mount
+	Autorun  bool   `json:"autorun,omitempty"`   // start the VM when the NAS boots
+}
+
+// VMUpdate is a change to the definition of an existing VM. Zero values
+// leave the corresponding setting unchanged. CPU and memory changes take
+// effect the next time the VM starts.
+type VMUpdate struct {
+	CPU       int   `json:"cpu,omitempty"`
+	Memory    int   `json:"memory,omitempty"` // MB
+	Autostart *bool `json:"autostart,omitempty"`
+}
+
+// IsZero reports whether the update changes nothing
+func (u VMUpdate) IsZero() bool {
+	return u.CPU == 0 && u.Memory == 0 && u.Autostart == nil
 }
 
 // Validate validates the VM configuration
 func (c VMConfig) Validate() error {
-	if c.Name == "" {
-		return fmt.Errorf("VM name is required")
+	if err := ValidateVMName(c.Name); err != nil {
+		return err
 	}
 	if c.CPU <= 0 {
 		return fmt.Errorf("CPU must be greater than 0")
@@ -79,6 +114,7 @@ func NewClient() (*Client, error) {
 	port := viper.GetInt("port")
 	keyfile := viper.GetString("keyfile")
 	timeout := viper.GetInt("timeout")
+	keepalive := viper.GetInt("keepalive_interval")
 
 	if host == "" {
 		return nil, fmt.Errorf("host not configured. Run 'syno-vm config set --host <hostname>'")
@@ -89,26 +125,44 @@ func NewClient() (*Client, error) {
 	}
 
 	client := &Client{
-		host:     host,
-		username: username,
-		port:     port,
-		keyfile:  keyfile,
-		timeout:  time.Duration(timeout) * time.Second,
+		host:      host,
+		username:  username,
+		port:      port,
+		keyfile:   keyfile,
+		timeout:   time.Duration(timeout) * time.Second,
+		keepalive: time.Duration(keepalive) * time.Second,
+
+		insecureSkipHostKeyCheck: viper.GetBool("insecure_skip_host_key_check"),
+	}
+
+	// Commands go through a running control master when there is one
+	if path, err := ControlPath(username, host, port); err == nil {
+		client.controlPath = path
 	}
 
 	return client, nil
 }
 
-// Connect establishes an SSH connection to the Synology NAS
-func (c *Client) Connect() error {
-	if c.sshClient != nil {
-		return nil // Already connected
+// Connect establishes an SSH connection to the Synology NAS, or reuses the
+// one another Client for the same user and host already has. Cancelling ctx
+// aborts the dial and handshake.
+func (c *Client) Connect(ctx context.Context) error {
+	_, _, err := c.connection(ctx)
+	return err
+}
+
+// dial opens a new SSH connection
+func (c *Client) dial(ctx context.Context) (*ssh.Client, error) {
+	hostKeyCallback, err := c.hostKeyCallback()
+	if err != nil {
+		return nil, err
 	}
 
 	config := &ssh.ClientConfig{
-		User:            c.username,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         c.timeout,
+		User:              c.username,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: c.hostKeyAlgorithms(),
+		Timeout:           c.timeout,
 	}
 
 	// Configure authentication methods
@@ -127,101 +181,283 @@ func (c *Client) Connect() error {
 	}
 
 	if len(authMethods) == 0 {
-		return fmt.Errorf("no SSH authentication methods available. Please ensure ssh-agent is running or configure a keyfile")
+		return nil, fmt.Errorf("no SSH authentication methods available. Please ensure ssh-agent is running or configure a keyfile")
 	}
 
 	config.Auth = authMethods
 
 	address := fmt.Sprintf("%s:%d", c.host, c.port)
-	client, err := ssh.Dial("tcp", address, config)
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
-		return fmt.Errorf("failed to connect to SSH server: %w", err)
+		return nil, fmt.Errorf("failed to connect to SSH server: %w", err)
 	}
 
-	c.sshClient = client
-	return nil
+	// Closing the connection unblocks a handshake stuck on a cancelled context
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if !stop() {
+		if err == nil {
+			_ = sshConn.Close()
+		}
+		return nil, fmt.Errorf("failed to connect to SSH server: %w", ctx.Err())
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
 }
 
-// Disconnect closes the SSH connection
+// SetHostKeyPrompt sets the function asked to confirm unknown host keys. By
+// default the user is prompted on the terminal.
+func (c *Client) SetHostKeyPrompt(prompt HostKeyPrompt) {
+	c.hostKeyPrompt = prompt
+}
+
+// Disconnect releases the SSH connection. It is closed once no other Client
+// shares it.
 func (c *Client) Disconnect() error {
-	if c.sshClient != nil {
-		return c.sshClient.Close()
+	c.mu.Lock()
+	sc := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if sc == nil {
+		return nil
 	}
-	return nil
+	return releaseConn(sc)
+}
+
+// Close implements io.Closer by calling Disconnect
+func (c *Client) Close() error {
+	return c.Disconnect()
 }
 
 // ExecuteCommand executes a command on the Synology NAS via SSH
-func (c *Client) ExecuteCommand(command string) (string, error) {
-	if err := c.Connect(); err != nil {
-		return "", err
+func (c *Client) ExecuteCommand(ctx context.Context, command string) (string, error) {
+	return c.runCommand(ctx, command, nil)
+}
+
+// ExecuteCommandWithInput executes a command on the Synology NAS via SSH,
+// feeding input to its standard input
+func (c *Client) ExecuteCommandWithInput(ctx context.Context, command string, input []byte) (string, error) {
+	if input == nil {
+		input = []byte{}
+	}
+	return c.runCommand(ctx, command, input)
+}
+
+// runCommand runs a command in a new SSH session, or through the control
+// master if one is running. stdin, if not nil, is fed to the command. If ctx
+// is cancelled before the command finishes, the remote process is signalled
+// and the session closed.
+func (c *Client) runCommand(ctx context.Context, command string, stdin []byte) (string, error) {
+	if c.controlPath != "" {
+		if out, handled, err := execViaControl(ctx, c.controlPath, command, stdin); handled {
+			return out, err
+		}
 	}
 
-	session, err := c.sshClient.NewSession()
+	session, err := c.newSession(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to create SSH session: %w", err)
+		return "", err
 	}
 	defer func() { _ = session.Close() }() // Ensure session cleanup
 
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
+	if stdin != nil {
+		session.Stdin = bytes.NewReader(stdin)
+	}
 	session.Stdout = &stdout
 	session.Stderr = &stderr
 
-	if err := session.Run(command); err != nil {
-		return "", fmt.Errorf("command failed: %s, stderr: %s", err, stderr.String())
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", fmt.Errorf("command failed: %s, stderr: %s", err, stderr.String())
+		}
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGTERM)
+		_ = session.Close()
+		return "", fmt.Errorf("command interrupted: %w", ctx.Err())
 	}
 
 	return stdout.String(), nil
 }
 
-
-// ListVMs lists all virtual machines using virsh
-func (c *Client) ListVMs() ([]VM, error) {
-	// Use virsh to list all VMs
-	output, err := c.ExecuteCommand("/usr/local/bin/virsh list --all")
+// ListVMs lists all virtual machines using virsh. The domain list and the
+// CPU, memory and state of every domain are fetched in a single round trip.
+func (c *Client) ListVMs(ctx context.Context) ([]VM, error) {
+	// domstats is best effort: without it VMs are listed without resources
+	script := fmt.Sprintf("%s || exit; echo %s; %s 2>/dev/null || true",
+		virshCommand("list", "--all"),
+		domStatsSeparator,
+		virshCommand("domstats", "--state", "--vcpu", "--balloon"),
+	)
+
+	output, err := c.ExecuteCommand(ctx, script)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list VMs: %w", err)
 	}
 
-	return parseVirshList(output)
+	list, stats, _ := strings.Cut(output, domStatsSeparator+"\n")
+	vms, err := parseVirshList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	applyDomStats(vms, parseDomStats(stats))
+	return vms, nil
 }
 
 // StartVM starts a virtual machine using virsh
-func (c *Client) StartVM(vmName string) error {
-	return c.executeVirshCommand(fmt.Sprintf("start %s", vmName))
+func (c *Client) StartVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "start", vmName)
+	return err
 }
 
 // StopVM stops a virtual machine using virsh
-func (c *Client) StopVM(vmName string) error {
-	return c.executeVirshCommand(fmt.Sprintf("shutdown %s", vmName))
+func (c *Client) StopVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "shutdown", vmName)
+	return err
+}
+
+// PowerOffVM forcibly powers off a virtual machine using virsh destroy
+func (c *Client) PowerOffVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "destroy", vmName)
+	return err
 }
 
 // RestartVM restarts a virtual machine using virsh
-func (c *Client) RestartVM(vmName string) error {
-	return c.executeVirshCommand(fmt.Sprintf("reboot %s", vmName))
+func (c *Client) RestartVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "reboot", vmName)
+	return err
+}
+
+// ResetVM hard-resets a virtual machine using virsh reset
+func (c *Client) ResetVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "reset", vmName)
+	return err
+}
+
+// PauseVM suspends a virtual machine in memory using virsh suspend
+func (c *Client) PauseVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "suspend", vmName)
+	return err
+}
+
+// ResumeVM resumes a paused virtual machine using virsh resume
+func (c *Client) ResumeVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "resume", vmName)
+	return err
+}
+
+// SaveVM saves a virtual machine's state to disk using virsh managedsave
+func (c *Client) SaveVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "managedsave", vmName)
+	return err
+}
+
+// RestoreVM restores a virtual machine saved with SaveVM. libvirt resumes
+// from the managed save image whenever a domain that has one is started.
+func (c *Client) RestoreVM(ctx context.Context, vmName string) error {
+	_, err := c.domainCommand(ctx, "start", vmName)
+	return err
 }
 
 // GetVMStatus gets the status of a specific virtual machine using virsh
-func (c *Client) GetVMStatus(vmName string) (*VM, error) {
-	return c.getVMInfo(vmName)
+func (c *Client) GetVMStatus(ctx context.Context, vmName string) (*VM, error) {
+	return c.getVMInfo(ctx, vmName)
+}
+
+// CreateVM creates a new virtual machine by defining generated domain XML
+func (c *Client) CreateVM(ctx context.Context, config VMConfig) error {
+	domainXML, err := BuildDomainXML(config)
+	if err != nil {
+		return err
+	}
+
+	// Upload the XML to a temporary file, define it, and always clean up
+	cmd := fmt.Sprintf(`f=$(mktemp /tmp/syno-vm-XXXXXX) && cat > "$f" && %s define "$f"; rc=$?; rm -f "$f"`, ShellQuote(virshPath))
+	if config.Autorun {
+		cmd += fmt.Sprintf(`; [ $rc -eq 0 ] && { %s; rc=$?; }`, virshCommand("autostart", config.Name))
+	}
+	cmd += "; exit $rc"
+	if _, err := c.ExecuteCommandWithInput(ctx, cmd, domainXML); err != nil {
+		return fmt.Errorf("failed to define VM: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateVM changes the vCPUs, memory and autostart of a VM's persistent
+// definition in a single round trip
+func (c *Client) UpdateVM(ctx context.Context, vmName string, update VMUpdate) error {
+	if err := ValidateVMName(vmName); err != nil {
+		return err
+	}
+	if update.CPU < 0 || update.Memory < 0 {
+		return fmt.Errorf("CPU and memory must not be negative")
+	}
+	if update.IsZero() {
+		return nil
+	}
+
+	if _, err := c.ExecuteCommand(ctx, strings.Join(updateCommands(vmName, update), " && ")); err != nil {
+		return fmt.Errorf("failed to update VM: %w", err)
+	}
+	return nil
 }
 
-// CreateVM creates a new virtual machine using virsh
-func (c *Client) CreateVM(config VMConfig) error {
-	// VM creation via virsh requires XML configuration
-	// This is a complex operation that would need a proper XML template
-	// For now, return an error indicating this needs VMM GUI or more complex implementation
-	return fmt.Errorf("VM creation via virsh requires XML configuration - please use VMM interface for VM creation")
+// updateCommands returns the virsh commands that apply update to a VM.
+// Lowering a maximum also lowers the current value, so maximums go first.
+func updateCommands(vmName string, update VMUpdate) []string {
+	var commands []string
+	if update.CPU > 0 {
+		cpus := strconv.Itoa(update.CPU)
+		commands = append(commands,
+			virshCommand("setvcpus", vmName, cpus, "--config", "--maximum"),
+			virshCommand("setvcpus", vmName, cpus, "--config"),
+		)
+	}
+	if update.Memory > 0 {
+		memory := strconv.Itoa(update.Memory) + "MiB"
+		commands = append(commands,
+			virshCommand("setmaxmem", vmName, memory, "--config"),
+			virshCommand("setmem", vmName, memory, "--config"),
+		)
+	}
+	if update.Autostart != nil {
+		if *update.Autostart {
+			commands = append(commands, virshCommand("autostart", vmName))
+		} else {
+			commands = append(commands, virshCommand("autostart", "--disable", vmName))
+		}
+	}
+
+	return commands
+}
+
+// PlanCreate returns the domain XML CreateVM would define
+func (c *Client) PlanCreate(ctx context.Context, config VMConfig) ([]byte, error) {
+	return BuildDomainXML(config)
 }
 
 // DeleteVM deletes a virtual machine using virsh
-func (c *Client) DeleteVM(vmName string) error {
+func (c *Client) DeleteVM(ctx context.Context, vmName string) error {
 	// First undefine the domain (this removes it completely)
-	return c.executeVirshCommand(fmt.Sprintf("undefine %s", vmName))
+	_, err := c.domainCommand(ctx, "undefine", vmName)
+	return err
 }
 
 // ListTemplates lists available VM templates
-func (c *Client) ListTemplates() ([]Template, error) {
+func (c *Client) ListTemplates(ctx context.Context) ([]Template, error) {
 	// VMM templates are typically stored as VM snapshots or images
 	// For now, we'll return an empty list since template management
 	// requires more complex VMM-specific operations
@@ -236,14 +472,14 @@ func (c *Client) ListTemplates() ([]Template, error) {
 }
 
 // CreateTemplate creates a new VM template
-func (c *Client) CreateTemplate(templateName, vmName string) error {
+func (c *Client) CreateTemplate(ctx context.Context, templateName, vmName string) error {
 	// Template creation in VMM typically requires the VMM interface
 	// This would involve creating snapshots or exporting VM configurations
 	return fmt.Errorf("template creation requires VMM interface - not implemented via virsh")
 }
 
 // DeleteTemplate deletes a VM template
-func (c *Client) DeleteTemplate(templateName string) error {
+func (c *Client) DeleteTemplate(ctx context.Context, templateName string) error {
 	// Template deletion in VMM typically requires the VMM interface
 	return fmt.Errorf("template deletion requires VMM interface - not implemented via virsh")
-}
\ No newline at end of file
+}
@@ -129,18 +129,6 @@ func TestBuildAPICommand(t *testing.T) {
 	}
 }
 
-
-// Helper function to build API command (this would be extracted to the main client code)
-func buildAPICommand(api, method, version string, params map[string]string) string {
-	cmd := "synowebapi --exec api=" + api + " method=" + method + " version=" + version
-
-	for key, value := range params {
-		cmd += " " + key + "=" + value
-	}
-
-	return cmd
-}
-
 func TestVMConfig_Validate(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -192,4 +180,23 @@ func TestVMConfig_Validate(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestUpdateCommands(t *testing.T) {
+	disable := false
+	got := updateCommands("web 01", VMUpdate{CPU: 4, Memory: 2048, Autostart: &disable})
+	want := []string{
+		"/usr/local/bin/virsh setvcpus 'web 01' 4 --config --maximum",
+		"/usr/local/bin/virsh setvcpus 'web 01' 4 --config",
+		"/usr/local/bin/virsh setmaxmem 'web 01' 2048MiB --config",
+		"/usr/local/bin/virsh setmem 'web 01' 2048MiB --config",
+		"/usr/local/bin/virsh autostart --disable 'web 01'",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if got := updateCommands("web", VMUpdate{Memory: 512}); len(got) != 2 {
+		t.Errorf("expected only memory commands, got %v", got)
+	}
+}
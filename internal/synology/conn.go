@@ -0,0 +1,188 @@
+package synology
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sharedConn is an SSH connection shared by every Client for the same
+// user@host:port. Sessions are multiplexed over it concurrently. A keepalive
+// notices when the connection drops, and the next command dials again.
+type sharedConn struct {
+	key  string
+	refs int // guarded by connsMu
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+var (
+	connsMu sync.Mutex
+	conns   = make(map[string]*sharedConn)
+)
+
+// acquireConn returns the shared connection for key, creating it if needed.
+// Each call must be paired with releaseConn.
+func acquireConn(key string) *sharedConn {
+	connsMu.Lock()
+	defer connsMu.Unlock()
+
+	sc, ok := conns[key]
+	if !ok {
+		sc = &sharedConn{key: key}
+		conns[key] = sc
+	}
+	sc.refs++
+	return sc
+}
+
+// releaseConn gives up a reference to sc and closes the connection once no
+// Client uses it any more
+func releaseConn(sc *sharedConn) error {
+	connsMu.Lock()
+	sc.refs--
+	last := sc.refs == 0
+	if last {
+		delete(conns, sc.key)
+	}
+	connsMu.Unlock()
+
+	if !last {
+		return nil
+	}
+	return sc.close()
+}
+
+// get returns the live SSH client, calling dial to connect if there is none.
+// Concurrent callers wait for a single dial.
+func (sc *sharedConn) get(ctx context.Context, dial func(context.Context) (*ssh.Client, error), keepalive time.Duration) (*ssh.Client, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.client != nil {
+		return sc.client, nil
+	}
+
+	client, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sc.client = client
+
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+		sc.drop(client)
+	}()
+	if keepalive > 0 {
+		go sc.keepalive(client, keepalive, closed)
+	}
+
+	return client, nil
+}
+
+// drop forgets client if it is still the current connection and closes it
+func (sc *sharedConn) drop(client *ssh.Client) {
+	sc.mu.Lock()
+	if sc.client == client {
+		sc.client = nil
+	}
+	sc.mu.Unlock()
+
+	_ = client.Close()
+}
+
+// close closes the current connection, if any
+func (sc *sharedConn) close() error {
+	sc.mu.Lock()
+	client := sc.client
+	sc.client = nil
+	sc.mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	return client.Close()
+}
+
+// keepalive sends an OpenSSH keepalive request every interval and drops the
+// connection if one fails or gets no reply within the interval
+func (sc *sharedConn) keepalive(client *ssh.Client, interval time.Duration, closed <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			// Servers that do not know the request still reply, with false
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		select {
+		case err := <-reply:
+			if err == nil {
+				continue
+			}
+		case <-time.After(interval):
+		case <-closed:
+			return
+		}
+
+		sc.drop(client)
+		return
+	}
+}
+
+// connKey identifies the SSH connection a Client uses
+func (c *Client) connKey() string {
+	return fmt.Sprintf("%s@%s:%d", c.username, c.host, c.port)
+}
+
+// connection returns the Client's SSH connection, connecting if needed
+func (c *Client) connection(ctx context.Context) (*sharedConn, *ssh.Client, error) {
+	c.mu.Lock()
+	if c.conn == nil {
+		c.conn = acquireConn(c.connKey())
+	}
+	sc := c.conn
+	c.mu.Unlock()
+
+	client, err := sc.get(ctx, c.dial, c.keepalive)
+	return sc, client, err
+}
+
+// newSession opens a session on the shared connection. If the connection
+// has dropped since it was last used, it reconnects once.
+func (c *Client) newSession(ctx context.Context) (*ssh.Session, error) {
+	sc, client, err := c.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	sc.drop(client)
+	if _, client, err = c.connection(ctx); err != nil {
+		return nil, err
+	}
+	session, err = client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	return session, nil
+}
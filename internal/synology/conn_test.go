@@ -0,0 +1,231 @@
+package synology
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer is an SSH server that answers every exec request with
+// "ran: <command>" and counts the connections it accepts
+type testSSHServer struct {
+	port int
+
+	mu    sync.Mutex
+	dials int
+	conns []*ssh.ServerConn
+}
+
+func newTestSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("failed to create host key signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &testSSHServer{port: ln.Addr().(*net.TCPAddr).Port}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	t.Cleanup(s.dropAll)
+
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.dials++
+	s.conns = append(s.conns, sconn)
+	s.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer func() { _ = channel.Close() }()
+			for req := range requests {
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				_ = req.Reply(true, nil)
+				fmt.Fprintf(channel, "ran: %s\n", payload.Command)
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		}()
+	}
+}
+
+// dropAll closes every connection from the server side
+func (s *testSSHServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testSSHServer) dialCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+// newTestClient returns a Client for the test server authenticating with a
+// freshly generated key
+func newTestClient(t *testing.T, s *testSSHServer) *Client {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	keyfile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyfile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	client := &Client{
+		host:                     "127.0.0.1",
+		port:                     s.port,
+		username:                 "admin",
+		keyfile:                  keyfile,
+		timeout:                  5 * time.Second,
+		insecureSkipHostKeyCheck: true,
+	}
+	t.Cleanup(func() { _ = client.Disconnect() })
+	return client
+}
+
+func TestClientsShareConnection(t *testing.T) {
+	server := newTestSSHServer(t)
+	first := newTestClient(t, server)
+	second := &Client{
+		host:                     first.host,
+		port:                     first.port,
+		username:                 first.username,
+		keyfile:                  first.keyfile,
+		timeout:                  first.timeout,
+		insecureSkipHostKeyCheck: true,
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		client := first
+		if i%2 == 1 {
+			client = second
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			out, err := client.ExecuteCommand(ctx, fmt.Sprintf("echo %d", i))
+			if err == nil && out != fmt.Sprintf("ran: echo %d\n", i) {
+				err = fmt.Errorf("unexpected output %q", out)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := server.dialCount(); got != 1 {
+		t.Errorf("expected 1 SSH connection, got %d", got)
+	}
+
+	if err := first.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+	if _, err := second.ExecuteCommand(ctx, "true"); err != nil {
+		t.Fatalf("connection closed while still in use: %v", err)
+	}
+	if err := second.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+
+	connsMu.Lock()
+	defer connsMu.Unlock()
+	if len(conns) != 0 {
+		t.Errorf("expected no shared connections after Disconnect, got %d", len(conns))
+	}
+}
+
+func TestClientReconnectsAfterDrop(t *testing.T) {
+	server := newTestSSHServer(t)
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	if _, err := client.ExecuteCommand(ctx, "true"); err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+
+	server.dropAll()
+
+	out, err := client.ExecuteCommand(ctx, "uptime")
+	if err != nil {
+		t.Fatalf("ExecuteCommand after drop failed: %v", err)
+	}
+	if out != "ran: uptime\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	if got := server.dialCount(); got != 2 {
+		t.Errorf("expected 2 SSH connections, got %d", got)
+	}
+}
@@ -0,0 +1,297 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A control master keeps an SSH connection open in a background process and
+// runs commands for other syno-vm processes over a unix socket, much like
+// OpenSSH's ControlMaster. Each socket connection carries one JSON request
+// and one JSON response; closing the connection early cancels the command.
+
+// Control socket operations
+const (
+	controlExec = "exec"
+	controlPing = "ping"
+	controlExit = "exit"
+)
+
+type controlRequest struct {
+	Op      string `json:"op"`
+	Command string `json:"command,omitempty"`
+	Stdin   []byte `json:"stdin,omitempty"`
+}
+
+type controlResponse struct {
+	Stdout string         `json:"stdout,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Status *ControlStatus `json:"status,omitempty"`
+}
+
+// ControlStatus describes a running control master
+type ControlStatus struct {
+	Target  string    `json:"target"` // user@host:port
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// ControlPath returns the control socket path for user@host:port,
+// ~/.syno-vm/control/<user>@<host>-<port>.sock
+func ControlPath(username, host string, port int) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	name := fmt.Sprintf("%s@%s-%d.sock", username, host, port)
+	return filepath.Join(home, ".syno-vm", "control", name), nil
+}
+
+// ControlPath returns the path of the Client's control socket
+func (c *Client) ControlPath() string {
+	return c.controlPath
+}
+
+// ServeControl connects and serves commands on the Client's control socket
+// until ctx is cancelled, a client asks it to exit, or it has been idle for
+// idle (never, if idle is 0). The Client itself stops using the socket.
+func (c *Client) ServeControl(ctx context.Context, idle time.Duration) error {
+	path := c.controlPath
+	if path == "" {
+		return fmt.Errorf("no control socket path")
+	}
+	c.controlPath = ""
+
+	if err := c.Connect(ctx); err != nil {
+		return err
+	}
+
+	ln, err := listenControl(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(path) }()
+
+	status := ControlStatus{
+		Target:  c.connKey(),
+		PID:     os.Getpid(),
+		Started: time.Now(),
+	}
+	return serveControl(ctx, ln, c.runCommand, status, idle)
+}
+
+// listenControl listens on a control socket, replacing a stale socket file
+// left behind by a master that died
+func listenControl(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create control directory: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("a control master is already running on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to set control socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+// serveControl accepts control requests on ln and runs exec requests with
+// run. It returns once ctx is done, an exit request arrives, or no request
+// has been active for idle.
+func serveControl(ctx context.Context, ln net.Listener, run func(ctx context.Context, command string, stdin []byte) (string, error), status ControlStatus, idle time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		active   int
+		lastUsed = time.Now()
+	)
+	track := func(delta int) {
+		mu.Lock()
+		active += delta
+		lastUsed = time.Now()
+		mu.Unlock()
+	}
+
+	if idle > 0 {
+		check := idle / 4
+		if check > time.Second {
+			check = time.Second
+		}
+		go func() {
+			ticker := time.NewTicker(check)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				mu.Lock()
+				expired := active == 0 && time.Since(lastUsed) >= idle
+				mu.Unlock()
+				if expired {
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept control connection: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			track(1)
+			defer track(-1)
+			handleControl(ctx, conn, run, status, cancel)
+		}()
+	}
+}
+
+// handleControl serves a single control request
+func handleControl(ctx context.Context, conn net.Conn, run func(ctx context.Context, command string, stdin []byte) (string, error), status ControlStatus, exit context.CancelFunc) {
+	defer func() { _ = conn.Close() }()
+
+	var req controlRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	var resp controlResponse
+	switch req.Op {
+	case controlPing:
+		resp.Status = &status
+	case controlExit:
+		resp.Status = &status
+		defer exit()
+	case controlExec:
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		// The client closes its end if it gives up on the command
+		go func() {
+			_, _ = conn.Read(make([]byte, 1))
+			cancel()
+		}()
+
+		out, err := run(ctx, req.Command, req.Stdin)
+		resp.Stdout = out
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	default:
+		resp.Error = fmt.Sprintf("unknown control operation %q", req.Op)
+	}
+
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+// callControl sends a request to the control master on path. It fails with
+// errControlUnavailable if no master is listening.
+func callControl(ctx context.Context, path string, req controlRequest) (*controlResponse, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errControlUnavailable, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Closing the connection tells the master to cancel the command
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("%w: %v", errControlUnavailable, err)
+	}
+
+	var resp controlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("command interrupted: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("control master connection lost: %w", err)
+	}
+	return &resp, nil
+}
+
+// errControlUnavailable means no control master is listening on the socket
+var errControlUnavailable = errors.New("control master not available")
+
+// execViaControl runs a command through the control master on path. handled
+// is false if no master is running, in which case the caller should run the
+// command itself.
+func execViaControl(ctx context.Context, path, command string, stdin []byte) (out string, handled bool, err error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", false, nil
+	}
+
+	resp, err := callControl(ctx, path, controlRequest{Op: controlExec, Command: command, Stdin: stdin})
+	if errors.Is(err, errControlUnavailable) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", true, err
+	}
+	if resp.Error != "" {
+		return resp.Stdout, true, errors.New(resp.Error)
+	}
+	return resp.Stdout, true, nil
+}
+
+// PingControl returns the status of the control master on path
+func PingControl(ctx context.Context, path string) (*ControlStatus, error) {
+	return controlStatus(ctx, path, controlPing)
+}
+
+// StopControl asks the control master on path to exit
+func StopControl(ctx context.Context, path string) (*ControlStatus, error) {
+	return controlStatus(ctx, path, controlExit)
+}
+
+func controlStatus(ctx context.Context, path, op string) (*ControlStatus, error) {
+	resp, err := callControl(ctx, path, controlRequest{Op: op})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Status, nil
+}
@@ -0,0 +1,211 @@
+package synology
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startControl serves a control socket in a temporary directory with run
+// and returns its path and a channel receiving serveControl's result
+func startControl(t *testing.T, run func(context.Context, string, []byte) (string, error), idle time.Duration) (string, <-chan error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "control", "test.sock")
+	ln, err := listenControl(path)
+	if err != nil {
+		t.Fatalf("listenControl failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		done <- serveControl(ctx, ln, run, ControlStatus{Target: "admin@nas:22", PID: 42}, idle)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+
+	return path, done
+}
+
+func TestControlExec(t *testing.T) {
+	path, _ := startControl(t, func(_ context.Context, command string, stdin []byte) (string, error) {
+		if command == "false" {
+			return "", fmt.Errorf("command failed: exit status 1")
+		}
+		return command + ":" + string(stdin), nil
+	}, 0)
+	ctx := context.Background()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("control socket missing: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected socket mode 0600, got %o", perm)
+	}
+
+	out, handled, err := execViaControl(ctx, path, "cat", []byte("input"))
+	if !handled || err != nil {
+		t.Fatalf("execViaControl = %v, %v", handled, err)
+	}
+	if out != "cat:input" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	_, handled, err = execViaControl(ctx, path, "false", nil)
+	if !handled || err == nil || !strings.Contains(err.Error(), "exit status 1") {
+		t.Errorf("expected the remote error, got handled=%v err=%v", handled, err)
+	}
+
+	status, err := PingControl(ctx, path)
+	if err != nil {
+		t.Fatalf("PingControl failed: %v", err)
+	}
+	if status.Target != "admin@nas:22" || status.PID != 42 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if _, err := listenControl(path); err == nil {
+		t.Error("expected a second master on the same socket to be refused")
+	}
+}
+
+func TestControlStop(t *testing.T) {
+	path, done := startControl(t, func(context.Context, string, []byte) (string, error) { return "", nil }, 0)
+
+	if _, err := StopControl(context.Background(), path); err != nil {
+		t.Fatalf("StopControl failed: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serveControl returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("control master did not exit")
+	}
+}
+
+func TestControlIdleExit(t *testing.T) {
+	_, done := startControl(t, func(context.Context, string, []byte) (string, error) { return "", nil }, 50*time.Millisecond)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serveControl returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("control master did not exit when idle")
+	}
+}
+
+func TestControlCancelsCommand(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	path, _ := startControl(t, func(ctx context.Context, _ string, _ []byte) (string, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	}, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, handled, err := execViaControl(ctx, path, "sleep 60", nil)
+	if !handled || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled command, got handled=%v err=%v", handled, err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not cancelled on the master")
+	}
+}
+
+func TestExecViaControlFallsBack(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	if _, handled, _ := execViaControl(ctx, filepath.Join(dir, "missing.sock"), "true", nil); handled {
+		t.Error("expected no master without a socket")
+	}
+
+	stale := filepath.Join(dir, "stale.sock")
+	if err := os.WriteFile(stale, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, handled, _ := execViaControl(ctx, stale, "true", nil); handled {
+		t.Error("expected no master behind a stale socket")
+	}
+
+	ln, err := listenControl(stale)
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced: %v", err)
+	}
+	_ = ln.Close()
+}
+
+func TestClientUsesControlMaster(t *testing.T) {
+	server := newTestSSHServer(t)
+	master := newTestClient(t, server)
+	path := filepath.Join(t.TempDir(), "master.sock")
+	master.controlPath = path
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		done <- master.ServeControl(ctx, 0)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+
+	for {
+		if _, err := PingControl(ctx, path); err == nil {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("ServeControl failed: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	client := newTestClient(t, server)
+	client.controlPath = path
+	for i := 0; i < 3; i++ {
+		out, err := client.ExecuteCommand(ctx, "hostname")
+		if err != nil {
+			t.Fatalf("ExecuteCommand failed: %v", err)
+		}
+		if out != "ran: hostname\n" {
+			t.Errorf("unexpected output %q", out)
+		}
+	}
+
+	if client.conn != nil {
+		t.Error("expected the client not to open its own connection")
+	}
+	if got := server.dialCount(); got != 1 {
+		t.Errorf("expected 1 SSH connection, got %d", got)
+	}
+}
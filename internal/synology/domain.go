@@ -0,0 +1,275 @@
+package synology
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Domain is the full definition of a virtual machine as parsed from
+// 'virsh dumpxml'
+type Domain struct {
+	Name      string           `json:"name"`
+	UUID      string           `json:"uuid"`
+	Type      string           `json:"type"`   // hypervisor, e.g. kvm
+	Memory    int              `json:"memory"` // MB
+	CPU       DomainCPU        `json:"cpu"`
+	Firmware  string           `json:"firmware"` // bios or efi
+	Machine   string           `json:"machine,omitempty"`
+	Autostart bool             `json:"autostart"` // started when the NAS boots
+	BootOrder []string         `json:"boot_order,omitempty"`
+	Disks     []DomainDisk     `json:"disks"`
+	NICs      []DomainNIC      `json:"nics"`
+	Graphics  []DomainGraphics `json:"graphics,omitempty"`
+}
+
+// DomainCPU is the virtual CPU configuration of a domain
+type DomainCPU struct {
+	VCPUs   int    `json:"vcpus"`
+	Mode    string `json:"mode,omitempty"`
+	Sockets int    `json:"sockets,omitempty"`
+	Cores   int    `json:"cores,omitempty"`
+	Threads int    `json:"threads,omitempty"`
+}
+
+// DomainDisk is a disk or CD-ROM attached to a domain
+type DomainDisk struct {
+	Device   string `json:"device"` // disk, cdrom, ...
+	Target   string `json:"target"` // e.g. vda
+	Bus      string `json:"bus"`
+	Format   string `json:"format,omitempty"`
+	Source   string `json:"source,omitempty"` // image file or block device on the NAS
+	ReadOnly bool   `json:"read_only,omitempty"`
+	Capacity uint64 `json:"capacity,omitempty"` // bytes, as seen by the guest
+	Physical uint64 `json:"physical,omitempty"` // bytes used on the NAS
+}
+
+// DomainNIC is a network interface of a domain
+type DomainNIC struct {
+	MAC    string `json:"mac"`
+	Type   string `json:"type"`             // bridge, network, ...
+	Source string `json:"source,omitempty"` // bridge or network name
+	Model  string `json:"model,omitempty"`
+	Target string `json:"target,omitempty"` // host-side device, while running
+}
+
+// DomainGraphics is a graphical console of a domain
+type DomainGraphics struct {
+	Type   string `json:"type"`
+	Port   int    `json:"port,omitempty"` // -1 until assigned
+	Listen string `json:"listen,omitempty"`
+}
+
+// primaryDisk returns the source of the first disk that is not a CD-ROM
+func (d *Domain) primaryDisk() string {
+	for _, disk := range d.Disks {
+		if disk.Device == "disk" {
+			return disk.Source
+		}
+	}
+	return ""
+}
+
+// GetDomain returns the full definition of a VM, including disk sizes and
+// autostart, in a single round trip
+func (c *Client) GetDomain(ctx context.Context, vmName string) (*Domain, error) {
+	if err := ValidateVMName(vmName); err != nil {
+		return nil, err
+	}
+
+	// Disk sizes are best effort: domblkinfo --all needs libvirt 4.5
+	script := fmt.Sprintf("%s || exit; echo %s; %s 2>/dev/null; echo %s; %s 2>/dev/null || true",
+		virshCommand("dumpxml", vmName),
+		blkInfoSeparator,
+		virshCommand("domblkinfo", vmName, "--all"),
+		domInfoSeparator,
+		virshCommand("dominfo", vmName),
+	)
+
+	output, err := c.ExecuteCommand(ctx, script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM definition: %w", err)
+	}
+
+	definition, rest, _ := strings.Cut(output, blkInfoSeparator+"\n")
+	blkInfo, domInfo, _ := strings.Cut(rest, domInfoSeparator+"\n")
+	domain, err := ParseDomainXML([]byte(definition))
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := parseDomBlkInfo(blkInfo)
+	for i, disk := range domain.Disks {
+		if size, ok := sizes[disk.Target]; ok {
+			domain.Disks[i].Capacity = size[0]
+			domain.Disks[i].Physical = size[1]
+		}
+	}
+	domain.Autostart = parseDomInfo(domInfo)["Autostart"] == "enable"
+
+	return domain, nil
+}
+
+// Separators between the outputs combined in GetDomain
+const (
+	blkInfoSeparator = "--- domblkinfo ---"
+	domInfoSeparator = "--- dominfo ---"
+)
+
+// ParseDomainXML parses a libvirt domain definition
+func ParseDomainXML(data []byte) (*Domain, error) {
+	var x domainXML
+	if err := xml.Unmarshal(data, &x); err != nil {
+		return nil, fmt.Errorf("failed to parse domain XML: %w", err)
+	}
+
+	domain := &Domain{
+		Name:     x.Name,
+		UUID:     x.UUID,
+		Type:     x.Type,
+		Memory:   memoryMB(x.Memory),
+		CPU:      DomainCPU{VCPUs: x.VCPU.Value},
+		Firmware: "bios",
+		Machine:  x.OS.Type.Machine,
+		Disks:    []DomainDisk{},
+		NICs:     []DomainNIC{},
+	}
+
+	if x.OS.Firmware == "efi" || x.OS.Loader != nil && x.OS.Loader.Type == "pflash" {
+		domain.Firmware = "efi"
+	}
+
+	if x.CPU != nil {
+		domain.CPU.Mode = x.CPU.Mode
+		if t := x.CPU.Topology; t != nil {
+			domain.CPU.Sockets, domain.CPU.Cores, domain.CPU.Threads = t.Sockets, t.Cores, t.Threads
+		}
+	}
+
+	// Devices may carry their own boot order instead of <os><boot dev=.../>
+	type bootEntry struct {
+		order  int
+		device string
+	}
+	var perDevice []bootEntry
+
+	for _, d := range x.Devices.Disks {
+		disk := DomainDisk{
+			Device:   d.Device,
+			Target:   d.Target.Dev,
+			Bus:      d.Target.Bus,
+			ReadOnly: d.ReadOnly != nil,
+		}
+		if d.Driver != nil {
+			disk.Format = d.Driver.Type
+		}
+		if d.Source != nil {
+			disk.Source = d.Source.File
+			if disk.Source == "" {
+				disk.Source = d.Source.Dev
+			}
+		}
+		if d.Boot != nil {
+			perDevice = append(perDevice, bootEntry{d.Boot.Order, disk.Target})
+		}
+		domain.Disks = append(domain.Disks, disk)
+	}
+
+	for _, iface := range x.Devices.Interfaces {
+		nic := DomainNIC{Type: iface.Type}
+		if iface.MAC != nil {
+			nic.MAC = iface.MAC.Address
+		}
+		if iface.Source != nil {
+			nic.Source = iface.Source.Bridge
+			if nic.Source == "" {
+				nic.Source = iface.Source.Network
+			}
+		}
+		if iface.Model != nil {
+			nic.Model = iface.Model.Type
+		}
+		if iface.Target != nil {
+			nic.Target = iface.Target.Dev
+		}
+		if iface.Boot != nil {
+			perDevice = append(perDevice, bootEntry{iface.Boot.Order, nic.MAC})
+		}
+		domain.NICs = append(domain.NICs, nic)
+	}
+
+	for _, g := range x.Devices.Graphics {
+		graphics := DomainGraphics{Type: g.Type, Listen: g.Listen}
+		if port, err := strconv.Atoi(g.Port); err == nil {
+			graphics.Port = port
+		}
+		domain.Graphics = append(domain.Graphics, graphics)
+	}
+
+	for _, b := range x.OS.Boot {
+		domain.BootOrder = append(domain.BootOrder, b.Dev)
+	}
+	if len(domain.BootOrder) == 0 {
+		sort.Slice(perDevice, func(i, j int) bool { return perDevice[i].order < perDevice[j].order })
+		for _, b := range perDevice {
+			domain.BootOrder = append(domain.BootOrder, b.device)
+		}
+	}
+
+	return domain, nil
+}
+
+// memoryMB converts a libvirt memory element to MB. libvirt defaults to KiB.
+func memoryMB(m memoryXML) int {
+	switch strings.ToLower(m.Unit) {
+	case "b", "bytes":
+		return int(m.Value / (1024 * 1024))
+	case "m", "mib":
+		return int(m.Value)
+	case "g", "gib":
+		return int(m.Value * 1024)
+	case "t", "tib":
+		return int(m.Value * 1024 * 1024)
+	default: // "", "k", "KiB"
+		return int(m.Value / 1024)
+	}
+}
+
+// parseDomBlkInfo parses 'virsh domblkinfo --all' output into the capacity
+// and physical size in bytes of each target
+func parseDomBlkInfo(output string) map[string][2]uint64 {
+	sizes := make(map[string][2]uint64)
+
+	for _, line := range strings.Split(output, "\n") {
+		// Rows look like " vda  21474836480  1074266112  21478375424"
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		capacity, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue // header, or "-" for an empty CD-ROM
+		}
+		physical, _ := strconv.ParseUint(fields[3], 10, 64)
+		sizes[fields[0]] = [2]uint64{capacity, physical}
+	}
+
+	return sizes
+}
+
+// parseDomInfo parses 'virsh dominfo' output into its fields:
+//
+//	Name:           web-01
+//	Autostart:      enable
+func parseDomInfo(output string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
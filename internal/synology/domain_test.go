@@ -0,0 +1,139 @@
+package synology
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testDumpXML = `<domain type='kvm' id='3'>
+  <name>web-01</name>
+  <uuid>6b1e6f3c-1d2a-4f43-9d7e-0b1c2d3e4f50</uuid>
+  <memory unit='KiB'>4194304</memory>
+  <currentMemory unit='KiB'>4194304</currentMemory>
+  <vcpu placement='static'>4</vcpu>
+  <os>
+    <type arch='x86_64' machine='pc-i440fx-2.12'>hvm</type>
+    <loader readonly='yes' type='pflash'>/usr/share/OVMF/OVMF_CODE.fd</loader>
+  </os>
+  <cpu mode='host-passthrough'>
+    <topology sockets='1' cores='2' threads='2'/>
+  </cpu>
+  <devices>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='/volume1/vms/web-01.qcow2'/>
+      <target dev='vda' bus='virtio'/>
+      <boot order='2'/>
+    </disk>
+    <disk type='file' device='cdrom'>
+      <driver name='qemu' type='raw'/>
+      <target dev='sda' bus='sata'/>
+      <readonly/>
+    </disk>
+    <disk type='block' device='disk'>
+      <driver name='qemu' type='raw'/>
+      <source dev='/dev/vg1/data'/>
+      <target dev='vdb' bus='virtio'/>
+    </disk>
+    <interface type='bridge'>
+      <mac address='52:54:00:12:34:56'/>
+      <source bridge='ovs_eth0'/>
+      <target dev='vnet0'/>
+      <model type='virtio'/>
+      <boot order='1'/>
+    </interface>
+    <graphics type='vnc' port='5900' autoport='yes' listen='0.0.0.0'/>
+  </devices>
+</domain>
+`
+
+func TestParseDomainXML(t *testing.T) {
+	domain, err := ParseDomainXML([]byte(testDumpXML))
+	if err != nil {
+		t.Fatalf("ParseDomainXML() error = %v", err)
+	}
+
+	if domain.Name != "web-01" || domain.UUID != "6b1e6f3c-1d2a-4f43-9d7e-0b1c2d3e4f50" || domain.Type != "kvm" {
+		t.Errorf("unexpected identity: %+v", domain)
+	}
+	if domain.Memory != 4096 {
+		t.Errorf("expected 4096 MB, got %d", domain.Memory)
+	}
+	if domain.Firmware != "efi" || domain.Machine != "pc-i440fx-2.12" {
+		t.Errorf("unexpected firmware %s / machine %s", domain.Firmware, domain.Machine)
+	}
+	if want := (DomainCPU{VCPUs: 4, Mode: "host-passthrough", Sockets: 1, Cores: 2, Threads: 2}); domain.CPU != want {
+		t.Errorf("CPU = %+v, want %+v", domain.CPU, want)
+	}
+	if want := []string{"52:54:00:12:34:56", "vda"}; !reflect.DeepEqual(domain.BootOrder, want) {
+		t.Errorf("BootOrder = %v, want %v", domain.BootOrder, want)
+	}
+
+	wantDisks := []DomainDisk{
+		{Device: "disk", Target: "vda", Bus: "virtio", Format: "qcow2", Source: "/volume1/vms/web-01.qcow2"},
+		{Device: "cdrom", Target: "sda", Bus: "sata", Format: "raw", ReadOnly: true},
+		{Device: "disk", Target: "vdb", Bus: "virtio", Format: "raw", Source: "/dev/vg1/data"},
+	}
+	if !reflect.DeepEqual(domain.Disks, wantDisks) {
+		t.Errorf("Disks = %+v, want %+v", domain.Disks, wantDisks)
+	}
+
+	wantNICs := []DomainNIC{{MAC: "52:54:00:12:34:56", Type: "bridge", Source: "ovs_eth0", Model: "virtio", Target: "vnet0"}}
+	if !reflect.DeepEqual(domain.NICs, wantNICs) {
+		t.Errorf("NICs = %+v, want %+v", domain.NICs, wantNICs)
+	}
+
+	if len(domain.Graphics) != 1 || domain.Graphics[0].Port != 5900 {
+		t.Errorf("unexpected graphics: %+v", domain.Graphics)
+	}
+
+	if got := domain.primaryDisk(); got != "/volume1/vms/web-01.qcow2" {
+		t.Errorf("primaryDisk() = %s", got)
+	}
+}
+
+func TestParseDomainXML_Generated(t *testing.T) {
+	out, err := BuildDomainXML(VMConfig{Name: "db", CPU: 2, Memory: 2048, Storage: "/volume1/vms/db.img", Template: "/volume1/iso/debian.iso"})
+	if err != nil {
+		t.Fatalf("BuildDomainXML() error = %v", err)
+	}
+
+	domain, err := ParseDomainXML(out)
+	if err != nil {
+		t.Fatalf("ParseDomainXML() error = %v", err)
+	}
+	if domain.Memory != 2048 || domain.Firmware != "bios" || !reflect.DeepEqual(domain.BootOrder, []string{"cdrom", "hd"}) {
+		t.Errorf("unexpected round trip: %+v", domain)
+	}
+}
+
+func TestParseDomBlkInfo(t *testing.T) {
+	output := ` Target   Capacity      Allocation    Physical
+-----------------------------------------------------
+ vda      21474836480   1074266112    21478375424
+ sda      -             -             -
+`
+
+	sizes := parseDomBlkInfo(output)
+	if len(sizes) != 1 {
+		t.Fatalf("expected 1 disk, got %v", sizes)
+	}
+	if sizes["vda"] != [2]uint64{21474836480, 21478375424} {
+		t.Errorf("unexpected vda sizes: %v", sizes["vda"])
+	}
+}
+
+func TestParseDomInfo(t *testing.T) {
+	output := `Id:             3
+Name:           web-01
+State:          running
+Max memory:     4194304 KiB
+Autostart:      enable
+Security label: none (enforcing)
+`
+
+	fields := parseDomInfo(output)
+	if fields["Autostart"] != "enable" || fields["Max memory"] != "4194304 KiB" || fields["Security label"] != "none (enforcing)" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
@@ -0,0 +1,243 @@
+package synology
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// The types below mirror the subset of the libvirt domain XML schema that
+// syno-vm generates or reads back from 'virsh dumpxml'. See
+// https://libvirt.org/formatdomain.html.
+
+type domainXML struct {
+	XMLName       xml.Name         `xml:"domain"`
+	Type          string           `xml:"type,attr"`
+	Name          string           `xml:"name"`
+	UUID          string           `xml:"uuid,omitempty"`
+	Description   string           `xml:"description,omitempty"`
+	Memory        memoryXML        `xml:"memory"`
+	CurrentMemory memoryXML        `xml:"currentMemory"`
+	VCPU          vcpuXML          `xml:"vcpu"`
+	OS            domainOSXML      `xml:"os"`
+	Features      *featuresXML     `xml:"features,omitempty"`
+	CPU           *domainCPUXML    `xml:"cpu,omitempty"`
+	OnPoweroff    string           `xml:"on_poweroff,omitempty"`
+	OnReboot      string           `xml:"on_reboot,omitempty"`
+	OnCrash       string           `xml:"on_crash,omitempty"`
+	Devices       domainDevicesXML `xml:"devices"`
+}
+
+type memoryXML struct {
+	Unit  string `xml:"unit,attr,omitempty"`
+	Value uint64 `xml:",chardata"`
+}
+
+type vcpuXML struct {
+	Placement string `xml:"placement,attr,omitempty"`
+	Value     int    `xml:",chardata"`
+}
+
+type domainOSXML struct {
+	Firmware string     `xml:"firmware,attr,omitempty"`
+	Type     osTypeXML  `xml:"type"`
+	Loader   *loaderXML `xml:"loader"`
+	Boot     []bootXML  `xml:"boot"`
+}
+
+type loaderXML struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type osTypeXML struct {
+	Arch    string `xml:"arch,attr,omitempty"`
+	Machine string `xml:"machine,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+type bootXML struct {
+	Dev string `xml:"dev,attr"`
+}
+
+type featuresXML struct {
+	ACPI *struct{} `xml:"acpi"`
+	APIC *struct{} `xml:"apic"`
+}
+
+type domainCPUXML struct {
+	Mode     string          `xml:"mode,attr,omitempty"`
+	Topology *cpuTopologyXML `xml:"topology"`
+}
+
+type cpuTopologyXML struct {
+	Sockets int `xml:"sockets,attr"`
+	Cores   int `xml:"cores,attr"`
+	Threads int `xml:"threads,attr"`
+}
+
+// bootOrderXML is the per-device <boot order='n'/> element
+type bootOrderXML struct {
+	Order int `xml:"order,attr"`
+}
+
+type domainDevicesXML struct {
+	Disks      []diskXML      `xml:"disk"`
+	Interfaces []interfaceXML `xml:"interface"`
+	Graphics   []graphicsXML  `xml:"graphics"`
+	Inputs     []inputXML     `xml:"input"`
+	Consoles   []consoleXML   `xml:"console"`
+}
+
+type diskXML struct {
+	Type     string         `xml:"type,attr"`
+	Device   string         `xml:"device,attr"`
+	Driver   *diskDriverXML `xml:"driver"`
+	Source   *diskSourceXML `xml:"source"`
+	Target   diskTargetXML  `xml:"target"`
+	Boot     *bootOrderXML  `xml:"boot"`
+	ReadOnly *struct{}      `xml:"readonly"`
+}
+
+type diskDriverXML struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type diskSourceXML struct {
+	File string `xml:"file,attr,omitempty"`
+	Dev  string `xml:"dev,attr,omitempty"`
+}
+
+type diskTargetXML struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr"`
+}
+
+type interfaceXML struct {
+	Type   string              `xml:"type,attr"`
+	MAC    *macXML             `xml:"mac"`
+	Source *interfaceSourceXML `xml:"source"`
+	Target *interfaceTargetXML `xml:"target"`
+	Model  *interfaceModelXML  `xml:"model"`
+	Boot   *bootOrderXML       `xml:"boot"`
+}
+
+type macXML struct {
+	Address string `xml:"address,attr"`
+}
+
+type interfaceSourceXML struct {
+	Bridge  string `xml:"bridge,attr,omitempty"`
+	Network string `xml:"network,attr,omitempty"`
+}
+
+type interfaceTargetXML struct {
+	Dev string `xml:"dev,attr"`
+}
+
+type interfaceModelXML struct {
+	Type string `xml:"type,attr"`
+}
+
+type graphicsXML struct {
+	Type     string `xml:"type,attr"`
+	Port     string `xml:"port,attr,omitempty"`
+	AutoPort string `xml:"autoport,attr,omitempty"`
+	Listen   string `xml:"listen,attr,omitempty"`
+}
+
+type inputXML struct {
+	Type string `xml:"type,attr"`
+	Bus  string `xml:"bus,attr"`
+}
+
+type consoleXML struct {
+	Type string `xml:"type,attr"`
+}
+
+// BuildDomainXML renders a libvirt domain definition for config. The VM gets
+// a virtio disk backed by config.Storage, a SATA CD-ROM with config.Template
+// as installation medium, and a virtio NIC on the config.Network bridge; each
+// is omitted when the corresponding field is empty.
+func BuildDomainXML(config VMConfig) ([]byte, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	domain := domainXML{
+		Type:          "kvm",
+		Name:          config.Name,
+		Memory:        memoryXML{Unit: "MiB", Value: uint64(config.Memory)},
+		CurrentMemory: memoryXML{Unit: "MiB", Value: uint64(config.Memory)},
+		VCPU:          vcpuXML{Placement: "static", Value: config.CPU},
+		OS: domainOSXML{
+			Type: osTypeXML{Arch: "x86_64", Machine: "pc", Value: "hvm"},
+		},
+		Features:   &featuresXML{ACPI: &struct{}{}, APIC: &struct{}{}},
+		CPU:        &domainCPUXML{Mode: "host-passthrough"},
+		OnPoweroff: "destroy",
+		OnReboot:   "restart",
+		OnCrash:    "destroy",
+		Devices: domainDevicesXML{
+			Graphics: []graphicsXML{{Type: "vnc", Port: "-1", AutoPort: "yes", Listen: "0.0.0.0"}},
+			Inputs:   []inputXML{{Type: "tablet", Bus: "usb"}},
+			Consoles: []consoleXML{{Type: "pty"}},
+		},
+	}
+
+	if config.Storage != "" {
+		if !path.IsAbs(config.Storage) {
+			return nil, fmt.Errorf("storage must be an absolute disk image path on the NAS, got %q", config.Storage)
+		}
+		domain.Devices.Disks = append(domain.Devices.Disks, diskXML{
+			Type:   "file",
+			Device: "disk",
+			Driver: &diskDriverXML{Name: "qemu", Type: diskFormat(config.Storage)},
+			Source: &diskSourceXML{File: config.Storage},
+			Target: diskTargetXML{Dev: "vda", Bus: "virtio"},
+		})
+	}
+
+	if config.Template != "" {
+		if !path.IsAbs(config.Template) {
+			return nil, fmt.Errorf("template must be an absolute image path on the NAS, got %q", config.Template)
+		}
+		domain.Devices.Disks = append(domain.Devices.Disks, diskXML{
+			Type:     "file",
+			Device:   "cdrom",
+			Driver:   &diskDriverXML{Name: "qemu", Type: "raw"},
+			Source:   &diskSourceXML{File: config.Template},
+			Target:   diskTargetXML{Dev: "sda", Bus: "sata"},
+			ReadOnly: &struct{}{},
+		})
+		domain.OS.Boot = append(domain.OS.Boot, bootXML{Dev: "cdrom"})
+	}
+	domain.OS.Boot = append(domain.OS.Boot, bootXML{Dev: "hd"})
+
+	if config.Network != "" {
+		domain.Devices.Interfaces = append(domain.Devices.Interfaces, interfaceXML{
+			Type:   "bridge",
+			Source: &interfaceSourceXML{Bridge: config.Network},
+			Model:  &interfaceModelXML{Type: "virtio"},
+		})
+	}
+
+	out, err := xml.MarshalIndent(domain, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to render domain XML: %w", err)
+	}
+
+	return append(out, '\n'), nil
+}
+
+// diskFormat guesses the qemu disk format from an image file name
+func diskFormat(file string) string {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".img", ".raw":
+		return "raw"
+	default:
+		return "qcow2"
+	}
+}
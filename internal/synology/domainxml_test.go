@@ -0,0 +1,107 @@
+package synology
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestBuildDomainXML(t *testing.T) {
+	config := VMConfig{
+		Name:     "web-01",
+		Template: "/volume1/iso/ubuntu-22.04.iso",
+		CPU:      4,
+		Memory:   4096,
+		Storage:  "/volume1/vms/web-01.qcow2",
+		Network:  "ovs_eth0",
+	}
+
+	out, err := BuildDomainXML(config)
+	if err != nil {
+		t.Fatalf("BuildDomainXML() error = %v", err)
+	}
+
+	var domain domainXML
+	if err := xml.Unmarshal(out, &domain); err != nil {
+		t.Fatalf("generated XML does not parse: %v\n%s", err, out)
+	}
+
+	if domain.Name != "web-01" {
+		t.Errorf("expected name web-01, got %s", domain.Name)
+	}
+	if domain.Memory.Value != 4096 || domain.Memory.Unit != "MiB" {
+		t.Errorf("expected 4096 MiB memory, got %d %s", domain.Memory.Value, domain.Memory.Unit)
+	}
+	if domain.VCPU.Value != 4 {
+		t.Errorf("expected 4 vCPUs, got %d", domain.VCPU.Value)
+	}
+
+	if len(domain.Devices.Disks) != 2 {
+		t.Fatalf("expected disk and CD-ROM, got %d disks", len(domain.Devices.Disks))
+	}
+	disk := domain.Devices.Disks[0]
+	if disk.Device != "disk" || disk.Source.File != config.Storage || disk.Driver.Type != "qcow2" {
+		t.Errorf("unexpected disk: %+v", disk)
+	}
+	cdrom := domain.Devices.Disks[1]
+	if cdrom.Device != "cdrom" || cdrom.Source.File != config.Template || cdrom.ReadOnly == nil {
+		t.Errorf("unexpected CD-ROM: %+v", cdrom)
+	}
+
+	if len(domain.OS.Boot) != 2 || domain.OS.Boot[0].Dev != "cdrom" || domain.OS.Boot[1].Dev != "hd" {
+		t.Errorf("expected boot order cdrom, hd; got %+v", domain.OS.Boot)
+	}
+
+	if len(domain.Devices.Interfaces) != 1 || domain.Devices.Interfaces[0].Source.Bridge != "ovs_eth0" {
+		t.Errorf("unexpected interfaces: %+v", domain.Devices.Interfaces)
+	}
+}
+
+func TestBuildDomainXML_Minimal(t *testing.T) {
+	out, err := BuildDomainXML(VMConfig{Name: "bare", CPU: 1, Memory: 512})
+	if err != nil {
+		t.Fatalf("BuildDomainXML() error = %v", err)
+	}
+
+	s := string(out)
+	if strings.Contains(s, "<disk") || strings.Contains(s, "<interface") {
+		t.Errorf("expected no disks or interfaces:\n%s", s)
+	}
+	if !strings.Contains(s, `<boot dev="hd"></boot>`) {
+		t.Errorf("expected hd boot device:\n%s", s)
+	}
+}
+
+func TestBuildDomainXML_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config VMConfig
+	}{
+		{"invalid config", VMConfig{Name: "x", CPU: 0, Memory: 512}},
+		{"relative storage", VMConfig{Name: "x", CPU: 1, Memory: 512, Storage: "disk.qcow2"}},
+		{"relative template", VMConfig{Name: "x", CPU: 1, Memory: 512, Template: "ubuntu.iso"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := BuildDomainXML(tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestDiskFormat(t *testing.T) {
+	tests := map[string]string{
+		"/volume1/vm/a.qcow2": "qcow2",
+		"/volume1/vm/a.img":   "raw",
+		"/volume1/vm/a.RAW":   "raw",
+		"/volume1/vm/a":       "qcow2",
+	}
+
+	for file, want := range tests {
+		if got := diskFormat(file); got != want {
+			t.Errorf("diskFormat(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package synology
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors shared by every backend. Failures reported by DSM or virsh wrap one
+// of them where it applies, so callers can test for them with errors.Is.
+var (
+	ErrAPINotAvailable       = errors.New("API not available on this DSM")
+	ErrInvalidRequest        = errors.New("invalid request")
+	ErrPermissionDenied      = errors.New("permission denied")
+	ErrSessionExpired        = errors.New("session expired")
+	ErrBusy                  = errors.New("NAS is busy")
+	ErrInvalidCredentials    = errors.New("invalid username or password")
+	ErrAccountDisabled       = errors.New("account disabled")
+	ErrPasswordExpired       = errors.New("password expired")
+	ErrOTPRequired           = errors.New("2-step verification code required")
+	ErrOTPInvalid            = errors.New("2-step verification code not accepted")
+	ErrOTPEnforced           = errors.New("2-step verification not set up")
+	ErrGuestNotFound         = errors.New("VM not found")
+	ErrGuestRunning          = errors.New("VM is running")
+	ErrGuestStopped          = errors.New("VM is not running")
+	ErrNameConflict          = errors.New("name already in use")
+	ErrInsufficientResources = errors.New("insufficient resources on the NAS")
+)
+
+// Web API error codes common to every API
+const (
+	errCodeNoPermission   = 105 // also returned for sessions DSM no longer knows
+	errCodeSessionTimeout = 106
+	errCodeDuplicateLogin = 107
+	errCodeSIDNotFound    = 119
+)
+
+// SYNO.API.Auth error codes
+const (
+	errCodeBadCredentials = 400
+	errCodeOTPRequired    = 403 // a 2-step verification code is required
+	errCodeOTPInvalid     = 404 // the 2-step verification code was wrong
+	errCodeOTPEnforced    = 406 // 2-step verification is enforced but not set up
+)
+
+// codeInfo describes a Web API error code
+type codeInfo struct {
+	err     error // the shared error it maps to, if any
+	message string
+}
+
+// commonCodes are the error codes every Web API may return
+var commonCodes = map[int]codeInfo{
+	100:                   {nil, "unknown error"},
+	101:                   {ErrInvalidRequest, "no API, method or version given"},
+	102:                   {ErrAPINotAvailable, "the API does not exist"},
+	103:                   {ErrAPINotAvailable, "the method does not exist"},
+	104:                   {ErrAPINotAvailable, "the version does not support this function"},
+	errCodeNoPermission:   {ErrPermissionDenied, "the session does not have permission"},
+	errCodeSessionTimeout: {ErrSessionExpired, "the session timed out"},
+	errCodeDuplicateLogin: {ErrSessionExpired, "the session was interrupted by another login"},
+	108:                   {nil, "failed to upload the file"},
+	109:                   {ErrBusy, "the network connection is unstable or the system is busy"},
+	110:                   {ErrBusy, "the network connection is unstable or the system is busy"},
+	111:                   {ErrBusy, "the network connection is unstable or the system is busy"},
+	114:                   {ErrInvalidRequest, "missing parameters"},
+	115:                   {ErrPermissionDenied, "not allowed to upload files"},
+	116:                   {ErrPermissionDenied, "not allowed on a demo site"},
+	117:                   {ErrBusy, "the network connection is unstable or the system is busy"},
+	118:                   {ErrBusy, "the system is busy"},
+	errCodeSIDNotFound:    {ErrSessionExpired, "the session is not valid"},
+	120:                   {ErrInvalidRequest, "invalid parameter"},
+}
+
+// authCodes are the error codes of SYNO.API.Auth
+var authCodes = map[int]codeInfo{
+	errCodeBadCredentials: {ErrInvalidCredentials, "no such account or incorrect password"},
+	401:                   {ErrAccountDisabled, "the account is disabled"},
+	402:                   {ErrPermissionDenied, "permission denied"},
+	errCodeOTPRequired:    {ErrOTPRequired, "a 2-step verification code is required"},
+	errCodeOTPInvalid:     {ErrOTPInvalid, "the 2-step verification code was not accepted"},
+	errCodeOTPEnforced:    {ErrOTPEnforced, "2-step verification is enforced but not set up for the account"},
+	407:                   {ErrPermissionDenied, "the IP address is blocked"},
+	408:                   {ErrPasswordExpired, "the password has expired and cannot be changed"},
+	409:                   {ErrPasswordExpired, "the password has expired"},
+	410:                   {ErrPasswordExpired, "the password must be changed"},
+}
+
+// vmmCodes are the error codes of the SYNO.Virtualization APIs
+var vmmCodes = map[int]codeInfo{
+	401: {ErrInvalidRequest, "bad parameter"},
+	402: {nil, "operation failed"},
+	403: {ErrNameConflict, "name conflict"},
+	404: {ErrInsufficientResources, "the number of iSCSI LUNs has reached the system limit"},
+	500: {nil, "the cluster is frozen: more than half of the hosts are offline"},
+	501: {nil, "the cluster is in incompatible mode: upgrade DSM on every host"},
+	600: {nil, "the cluster is not ready"},
+	601: {nil, "the host is offline"},
+	700: {nil, "the storage is not valid"},
+	701: {nil, "failed to assign a host to the VM"},
+	702: {nil, "the VM has no host"},
+	703: {ErrInsufficientResources, "not enough CPU threads to power on the VM"},
+	704: {ErrInsufficientResources, "not enough memory to power on the VM"},
+	705: {ErrGuestRunning, "the VM is running"},
+	706: {ErrNameConflict, "MAC address conflict"},
+	707: {nil, "the image was not found"},
+	708: {ErrGuestStopped, "the VM is powered off"},
+}
+
+// guestCodes override vmmCodes for calls whose only parameter is a guest
+// name, where DSM reports an unknown guest as a bad parameter
+var guestCodes = map[int]codeInfo{
+	401: {ErrGuestNotFound, "no VM with that name"},
+}
+
+// guestCall reports whether method of api acts on one guest by name
+func guestCall(api, method string) bool {
+	switch api {
+	case apiGuestAction:
+		return true
+	case apiGuest:
+		return method == "get" || method == "delete"
+	}
+	return false
+}
+
+// lookupCode describes an error code returned by method of api. Codes from
+// 400 on mean different things for each API family.
+func lookupCode(api, method string, code int) codeInfo {
+	if info, ok := commonCodes[code]; ok {
+		return info
+	}
+	if info, ok := guestCodes[code]; ok && guestCall(api, method) {
+		return info
+	}
+	var family map[int]codeInfo
+	switch {
+	case api == apiAuth:
+		family = authCodes
+	case strings.HasPrefix(api, vmmAPIPrefix):
+		family = vmmCodes
+	}
+	if info, ok := family[code]; ok {
+		return info
+	}
+	return codeInfo{message: "unknown error"}
+}
+
+// WebAPIError is the error code of a failed Web API call. Returned as an
+// error, it wraps the shared error the code maps to, if any.
+type WebAPIError struct {
+	Code int `json:"code"`
+	// API and Method are the call that failed
+	API    string `json:"-"`
+	Method string `json:"-"`
+}
+
+// Error describes the failure and its code
+func (e *WebAPIError) Error() string {
+	return fmt.Sprintf("%s %s failed: %s (error code %d)", e.API, e.Method, lookupCode(e.API, e.Method, e.Code).message, e.Code)
+}
+
+// Unwrap returns the shared error the code maps to
+func (e *WebAPIError) Unwrap() error {
+	return lookupCode(e.API, e.Method, e.Code).err
+}
+
+// responseError returns the error of a failed response to a call of method
+// on api
+func responseError(api, method string, resp *WebAPIResponse) error {
+	code := 0
+	if resp.Error != nil {
+		code = resp.Error.Code
+	}
+	return &WebAPIError{Code: code, API: api, Method: method}
+}
+
+// virshErrors maps libvirt error messages to the shared errors
+var virshErrors = []struct {
+	message string
+	err     error
+}{
+	{"failed to get domain", ErrGuestNotFound},
+	{"Domain not found", ErrGuestNotFound},
+	{"domain is already running", ErrGuestRunning},
+	{"domain is already active", ErrGuestRunning},
+	{"domain is not running", ErrGuestStopped},
+	{"already exists with uuid", ErrNameConflict},
+	{"Permission denied", ErrPermissionDenied},
+}
+
+// virshError wraps a failed virsh command acting on the named domain in the
+// shared error its message maps to
+func virshError(vmName string, err error) error {
+	for _, e := range virshErrors {
+		if strings.Contains(err.Error(), e.message) {
+			return fmt.Errorf("%w: %s: %w", e.err, vmName, err)
+		}
+	}
+	return err
+}
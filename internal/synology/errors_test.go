@@ -0,0 +1,89 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebAPIError(t *testing.T) {
+	tests := []struct {
+		api     string
+		method  string
+		code    int
+		want    error
+		message string
+	}{
+		{apiGuest, "list", errCodeSIDNotFound, ErrSessionExpired, "the session is not valid"},
+		{apiAuth, "login", 102, ErrAPINotAvailable, "the API does not exist"},
+		// Codes from 400 on depend on the API
+		{apiAuth, "login", 401, ErrAccountDisabled, "the account is disabled"},
+		{apiGuest, "list", 401, ErrInvalidRequest, "bad parameter"},
+		{apiAuth, "login", errCodeOTPInvalid, ErrOTPInvalid, "not accepted"},
+		{apiGuestAction, "poweron", 708, ErrGuestStopped, "powered off"},
+		{"SYNO.Core.System", "info", 401, nil, "unknown error"},
+		{apiGuest, "list", 999, nil, "unknown error"},
+		// A bad guest name means there is no such guest
+		{apiGuest, "get", 401, ErrGuestNotFound, "no VM with that name"},
+		{apiGuestAction, "poweron", 401, ErrGuestNotFound, "no VM with that name"},
+	}
+
+	for _, tt := range tests {
+		err := error(&WebAPIError{Code: tt.code, API: tt.api, Method: tt.method})
+		if got := errors.Unwrap(err); got != tt.want {
+			t.Errorf("%s code %d maps to %v, want %v", tt.api, tt.code, got, tt.want)
+		}
+		want := fmt.Sprintf("(error code %d)", tt.code)
+		if msg := err.Error(); !strings.Contains(msg, tt.message) || !strings.Contains(msg, want) || !strings.HasPrefix(msg, tt.api+" "+tt.method+" failed") {
+			t.Errorf("%s code %d message = %q", tt.api, tt.code, msg)
+		}
+	}
+
+	if !sessionExpired(errCodeNoPermission) || !sessionExpired(errCodeDuplicateLogin) || sessionExpired(120) {
+		t.Error("sessionExpired() does not match the session error codes")
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := errCodeBadCredentials
+		if r.FormValue("passwd") == "enforced" {
+			code = errCodeOTPEnforced
+		}
+		_ = json.NewEncoder(w).Encode(WebAPIResponse{Error: &WebAPIError{Code: code}})
+	})
+
+	w := newTestWebAPIClient(t, api, TwoFactor{})
+	_, err := w.CallAPI(context.Background(), apiGuest, "list", "", nil)
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("CallAPI() error = %v, want ErrInvalidCredentials", err)
+	}
+
+	w = newTestWebAPIClient(t, api, TwoFactor{})
+	w.password = "enforced"
+	if err := w.Login(context.Background()); !errors.Is(err, ErrOTPEnforced) || !strings.Contains(err.Error(), "set it up for admin") {
+		t.Errorf("Login() error = %v, want ErrOTPEnforced with a hint", err)
+	}
+}
+
+func TestVirshError(t *testing.T) {
+	failed := errors.New("command failed: Process exited with status 1, stderr: error: failed to get domain 'web'")
+	err := virshError("web", failed)
+	if !errors.Is(err, ErrGuestNotFound) || !errors.Is(err, failed) {
+		t.Errorf("virshError() = %v, want it to wrap ErrGuestNotFound and the command error", err)
+	}
+
+	running := errors.New("command failed: Process exited with status 1, stderr: error: Requested operation is not valid: domain is already running")
+	if err := virshError("web", running); !errors.Is(err, ErrGuestRunning) {
+		t.Errorf("virshError() = %v, want ErrGuestRunning", err)
+	}
+
+	other := errors.New("command failed: connection reset")
+	if err := virshError("web", other); err != other {
+		t.Errorf("virshError() = %v, want the command error unchanged", err)
+	}
+}
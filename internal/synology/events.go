@@ -0,0 +1,231 @@
+package synology
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// EventType is the kind of a VM lifecycle event
+type EventType string
+
+// Lifecycle event types
+const (
+	EventDefined   EventType = "defined"
+	EventUndefined EventType = "undefined"
+	EventStarted   EventType = "started"
+	EventSuspended EventType = "suspended"
+	EventResumed   EventType = "resumed"
+	EventStopped   EventType = "stopped"
+	EventCrashed   EventType = "crashed"
+)
+
+// Event is a lifecycle change of a VM
+type Event struct {
+	Time   time.Time `json:"time"`
+	VM     string    `json:"vm"`
+	Type   EventType `json:"type"`
+	Detail string    `json:"detail,omitempty"` // reason reported by the backend, e.g. booted or destroyed
+}
+
+// EventWatcher is implemented by backends that can push lifecycle events
+// as they happen
+type EventWatcher interface {
+	// WatchEvents calls handle for every event until ctx is cancelled, in
+	// which case it returns nil, or the event stream fails
+	WatchEvents(ctx context.Context, handle func(Event)) error
+}
+
+// Ensure Client implements EventWatcher
+var _ EventWatcher = (*Client)(nil)
+
+// WatchEvents streams lifecycle events from 'virsh event --loop'. The
+// stream needs its own SSH session, so it bypasses the control master.
+func (c *Client) WatchEvents(ctx context.Context, handle func(Event)) error {
+	session, err := c.newSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = session.Close() }()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to read event stream: %w", err)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	if err := session.Start(virshCommand("event", "--all", "--loop", "--event", "lifecycle")); err != nil {
+		return fmt.Errorf("failed to start event stream: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = session.Signal(ssh.SIGTERM)
+		_ = session.Close()
+	})
+	defer stop()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if event, ok := parseVirshEvent(scanner.Text()); ok {
+			event.Time = time.Now()
+			handle(event)
+		}
+	}
+
+	err = session.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("event stream failed: %s, stderr: %s", err, stderr.String())
+	}
+	return fmt.Errorf("event stream ended")
+}
+
+// virshEventTypes maps the lifecycle events printed by 'virsh event' onto
+// EventTypes. Shutdown is left out: it announces a Stopped event.
+var virshEventTypes = map[string]EventType{
+	"Defined":     EventDefined,
+	"Undefined":   EventUndefined,
+	"Started":     EventStarted,
+	"Suspended":   EventSuspended,
+	"PMSuspended": EventSuspended,
+	"Resumed":     EventResumed,
+	"Stopped":     EventStopped,
+	"Crashed":     EventCrashed,
+}
+
+// parseVirshEvent parses a line of 'virsh event --event lifecycle' output,
+// with or without a --timestamp prefix:
+//
+//	event 'lifecycle' for domain 'web-01': Started Booted
+func parseVirshEvent(line string) (Event, bool) {
+	const marker = "event 'lifecycle' for domain "
+
+	i := strings.Index(line, marker)
+	if i < 0 {
+		return Event{}, false
+	}
+	rest := line[i+len(marker):]
+
+	sep := strings.LastIndex(rest, ": ")
+	if sep < 0 {
+		return Event{}, false
+	}
+	name := strings.Trim(rest[:sep], "'")
+	fields := strings.Fields(rest[sep+2:])
+	if name == "" || len(fields) == 0 {
+		return Event{}, false
+	}
+
+	typ, ok := virshEventTypes[fields[0]]
+	if !ok {
+		return Event{}, false
+	}
+	event := Event{VM: name, Type: typ}
+	if len(fields) > 1 {
+		event.Detail = strings.ToLower(strings.Join(fields[1:], " "))
+	}
+	return event, true
+}
+
+// PollEvents lists the VMs of m every interval and calls handle for the
+// changes between consecutive lists, for backends that cannot push events.
+// The first list only sets the baseline. It returns nil once ctx is
+// cancelled.
+func PollEvents(ctx context.Context, m VMManager, interval time.Duration, handle func(Event)) error {
+	var states map[string]VMState
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		vms, err := m.ListVMs(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to list VMs: %w", err)
+		}
+
+		next := make(map[string]VMState, len(vms))
+		for _, vm := range vms {
+			next[vm.Name] = vm.Status
+		}
+		if states != nil {
+			for _, event := range diffStates(states, vms, time.Now()) {
+				handle(event)
+			}
+		}
+		states = next
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// diffStates returns the events that turn the states in prev into vms.
+// VMs that appeared come first, in list order, followed by the VMs that
+// disappeared, by name.
+func diffStates(prev map[string]VMState, vms []VM, now time.Time) []Event {
+	var events []Event
+	seen := make(map[string]bool, len(vms))
+
+	for _, vm := range vms {
+		seen[vm.Name] = true
+
+		from, ok := prev[vm.Name]
+		if !ok {
+			events = append(events, Event{Time: now, VM: vm.Name, Type: EventDefined})
+			from = StateStopped
+		}
+		if typ, ok := transition(from, vm.Status); ok {
+			events = append(events, Event{Time: now, VM: vm.Name, Type: typ})
+		}
+	}
+
+	var gone []string
+	for name := range prev {
+		if !seen[name] {
+			gone = append(gone, name)
+		}
+	}
+	sort.Strings(gone)
+	for _, name := range gone {
+		events = append(events, Event{Time: now, VM: name, Type: EventUndefined})
+	}
+
+	return events
+}
+
+// transition returns the event for a change of state, if it warrants one.
+// Shutting down and unknown states produce no event; the state that
+// follows does.
+func transition(from, to VMState) (EventType, bool) {
+	if from == to {
+		return "", false
+	}
+	switch to {
+	case StateRunning:
+		if from == StatePaused {
+			return EventResumed, true
+		}
+		return EventStarted, true
+	case StatePaused, StateSuspended:
+		return EventSuspended, true
+	case StateStopped:
+		return EventStopped, true
+	case StateCrashed:
+		return EventCrashed, true
+	}
+	return "", false
+}
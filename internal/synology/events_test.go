@@ -0,0 +1,103 @@
+package synology
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseVirshEvent(t *testing.T) {
+	tests := []struct {
+		line string
+		want Event
+		ok   bool
+	}{
+		{"event 'lifecycle' for domain 'web-01': Started Booted", Event{VM: "web-01", Type: EventStarted, Detail: "booted"}, true},
+		{"event 'lifecycle' for domain web-01: Stopped Destroyed", Event{VM: "web-01", Type: EventStopped, Detail: "destroyed"}, true},
+		{"2026-10-16 12:00:00.000+0000: event 'lifecycle' for domain 'db 01': Crashed Panicked", Event{VM: "db 01", Type: EventCrashed, Detail: "panicked"}, true},
+		{"event 'lifecycle' for domain 'web-01': PMSuspended Memory", Event{VM: "web-01", Type: EventSuspended, Detail: "memory"}, true},
+		{"event 'lifecycle' for domain 'web-01': Undefined", Event{VM: "web-01", Type: EventUndefined}, true},
+		{"event 'lifecycle' for domain 'web-01': Shutdown Finished", Event{}, false},
+		{"event 'reboot' for domain 'web-01'", Event{}, false},
+		{"events received: 3", Event{}, false},
+		{"", Event{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, ok := parseVirshEvent(tt.line)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseVirshEvent() = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDiffStates(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	prev := map[string]VMState{
+		"web":   StateRunning,
+		"db":    StatePaused,
+		"build": StateRunning,
+		"old":   StateStopped,
+		"same":  StateStopped,
+	}
+	vms := []VM{
+		{Name: "web", Status: StateCrashed},
+		{Name: "db", Status: StateRunning},
+		{Name: "build", Status: StateShuttingDown},
+		{Name: "same", Status: StateStopped},
+		{Name: "new", Status: StateRunning},
+	}
+
+	want := []Event{
+		{Time: now, VM: "web", Type: EventCrashed},
+		{Time: now, VM: "db", Type: EventResumed},
+		{Time: now, VM: "new", Type: EventDefined},
+		{Time: now, VM: "new", Type: EventStarted},
+		{Time: now, VM: "old", Type: EventUndefined},
+	}
+	if got := diffStates(prev, vms, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+// listOnly serves a sequence of VM lists, cancelling once they run out
+type listOnly struct {
+	VMManager
+	lists  [][]VM
+	cancel context.CancelFunc
+}
+
+func (l *listOnly) ListVMs(ctx context.Context) ([]VM, error) {
+	if len(l.lists) == 1 {
+		l.cancel()
+	}
+	vms := l.lists[0]
+	l.lists = l.lists[1:]
+	return vms, nil
+}
+
+func TestPollEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &listOnly{
+		lists: [][]VM{
+			{{Name: "web", Status: StateRunning}},
+			{{Name: "web", Status: StateRunning}},
+			{{Name: "web", Status: StateStopped}},
+		},
+		cancel: cancel,
+	}
+
+	var events []Event
+	err := PollEvents(ctx, m, time.Millisecond, func(e Event) { events = append(events, e) })
+	if err != nil {
+		t.Fatalf("PollEvents() error = %v", err)
+	}
+	if len(events) != 1 || events[0].VM != "web" || events[0].Type != EventStopped {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
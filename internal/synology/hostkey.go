@@ -0,0 +1,245 @@
+package synology
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPrompt asks the user whether to trust a host key seen for the first
+// time. It returns true if the key should be trusted and remembered.
+type HostKeyPrompt func(hostname string, key ssh.PublicKey) (bool, error)
+
+// HostKeyMismatchError is returned when a host presents a key that differs
+// from the one recorded in known_hosts
+type HostKeyMismatchError struct {
+	Host string
+	Got  ssh.PublicKey
+	Want []knownhosts.KnownKey
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "host key verification failed for %s: the host key has changed\n", e.Host)
+	fmt.Fprintf(&b, "  presented: %s %s\n", e.Got.Type(), ssh.FingerprintSHA256(e.Got))
+	for _, want := range e.Want {
+		fmt.Fprintf(&b, "  expected:  %s %s (%s:%d)\n", want.Key.Type(), ssh.FingerprintSHA256(want.Key), want.Filename, want.Line)
+	}
+	b.WriteString("This could mean someone is intercepting the connection, or the NAS was reinstalled.\n")
+	b.WriteString("If the change is expected, remove the old entry from the file above and reconnect.")
+	return b.String()
+}
+
+// userKnownHostsFile returns the path of ~/.ssh/known_hosts
+func userKnownHostsFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// managedKnownHostsFile returns the path of the known_hosts file syno-vm
+// records trusted keys in
+func managedKnownHostsFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".syno-vm", "known_hosts"), nil
+}
+
+// hostKeyCallback verifies host keys against ~/.ssh/known_hosts and the
+// syno-vm known_hosts file. Unknown hosts are trusted on first use if the
+// prompt accepts them, in which case the key is added to the syno-vm file.
+func (c *Client) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if c.insecureSkipHostKeyCheck {
+		return ssh.InsecureIgnoreHostKey(), nil // nolint:gosec // explicitly requested by the user
+	}
+
+	managedFile, verify, err := loadKnownHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := verify(hostname, remote, key)
+
+		var keyErr *knownhosts.KeyError
+		if err == nil || !errors.As(err, &keyErr) {
+			return err
+		}
+
+		// Only a known key of the same type can contradict the presented
+		// one; a key of a type not recorded yet is treated as unknown
+		for _, want := range keyErr.Want {
+			if want.Key.Type() == key.Type() {
+				return &HostKeyMismatchError{Host: hostname, Got: key, Want: keyErr.Want}
+			}
+		}
+
+		// Unknown host or key type: trust on first use
+		prompt := c.hostKeyPrompt
+		if prompt == nil {
+			prompt = promptHostKey
+		}
+		trusted, err := prompt(hostname, key)
+		if err != nil {
+			return err
+		}
+		if !trusted {
+			return fmt.Errorf("host key for %s was not accepted", hostname)
+		}
+
+		return appendKnownHost(managedFile, hostname, remote, key)
+	}, nil
+}
+
+// loadKnownHosts returns the syno-vm known_hosts file, creating it if
+// needed, and a callback checking keys against it and ~/.ssh/known_hosts
+func loadKnownHosts() (string, ssh.HostKeyCallback, error) {
+	managedFile, err := managedKnownHostsFile()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := ensureFile(managedFile); err != nil {
+		return "", nil, fmt.Errorf("failed to create known_hosts file: %w", err)
+	}
+
+	files := []string{managedFile}
+	if userFile, err := userKnownHostsFile(); err == nil {
+		if _, err := os.Stat(userFile); err == nil {
+			files = append(files, userFile)
+		}
+	}
+
+	verify, err := knownhosts.New(files...)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+	return managedFile, verify, nil
+}
+
+// hostKeyAlgorithmOrder is the order host key algorithms are offered in
+var hostKeyAlgorithmOrder = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSASHA256,
+	ssh.KeyAlgoRSA,
+}
+
+// hostKeyAlgorithms returns the host key algorithms matching the key types
+// known for the client's host, so the server presents a key that can be
+// verified instead of one of another type. It returns nil, leaving the
+// default algorithms, when no key is known or keys are not checked.
+func (c *Client) hostKeyAlgorithms() []string {
+	if c.insecureSkipHostKeyCheck {
+		return nil
+	}
+	_, verify, err := loadKnownHosts()
+	if err != nil {
+		return nil
+	}
+
+	// Checking a throwaway key lists the known keys for the host
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(c.host)
+	if ip == nil {
+		ip = net.IPv4zero
+	}
+	address := net.JoinHostPort(c.host, strconv.Itoa(c.port))
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(verify(address, &net.TCPAddr{IP: ip, Port: c.port}, probe), &keyErr) {
+		return nil
+	}
+	known := make(map[string]bool)
+	for _, want := range keyErr.Want {
+		known[want.Key.Type()] = true
+	}
+
+	var algorithms []string
+	for _, algo := range hostKeyAlgorithmOrder {
+		keyType := algo
+		if algo == ssh.KeyAlgoRSASHA512 || algo == ssh.KeyAlgoRSASHA256 {
+			keyType = ssh.KeyAlgoRSA
+		}
+		if known[keyType] {
+			algorithms = append(algorithms, algo)
+		}
+	}
+	return algorithms
+}
+
+// appendKnownHost records a trusted host key in a known_hosts file
+func appendKnownHost(file, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if remote != nil {
+		if addr := knownhosts.Normalize(remote.String()); addr != addresses[0] {
+			addresses = append(addresses, addr)
+		}
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintln(f, knownhosts.Line(addresses, key)); err != nil {
+		return fmt.Errorf("failed to record host key: %w", err)
+	}
+	return nil
+}
+
+// ensureFile creates an empty file, and its directory, if it does not exist
+func ensureFile(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// promptHostKey asks on the terminal whether to trust an unknown host key
+func promptHostKey(hostname string, key ssh.PublicKey) (bool, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, fmt.Errorf("host key for %s is unknown (%s %s) and stdin is not a terminal to confirm it; "+
+			"connect once interactively or add it to ~/.ssh/known_hosts", hostname, key.Type(), ssh.FingerprintSHA256(key))
+	}
+
+	fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\n", hostname)
+	fmt.Fprintf(os.Stderr, "%s key fingerprint is %s.\n", strings.ToUpper(strings.TrimPrefix(key.Type(), "ssh-")), ssh.FingerprintSHA256(key))
+	fmt.Fprint(os.Stderr, "Are you sure you want to continue connecting (yes/no)? ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read answer: %w", err)
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "yes" || answer == "y", nil
+}
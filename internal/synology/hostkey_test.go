@@ -0,0 +1,194 @@
+package synology
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to convert key: %v", err)
+	}
+	return key
+}
+
+func TestHostKeyCallback_TrustOnFirstUse(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	key := newTestHostKey(t)
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+
+	prompted := 0
+	client := &Client{hostKeyPrompt: func(hostname string, got ssh.PublicKey) (bool, error) {
+		prompted++
+		return true, nil
+	}}
+
+	callback, err := client.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("hostKeyCallback() error = %v", err)
+	}
+	if err := callback("nas.local:22", remote, key); err != nil {
+		t.Fatalf("expected unknown key to be accepted, got %v", err)
+	}
+	if prompted != 1 {
+		t.Errorf("expected 1 prompt, got %d", prompted)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".syno-vm", "known_hosts"))
+	if err != nil {
+		t.Fatalf("failed to read managed known_hosts: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "nas.local,192.0.2.10 ssh-ed25519 ") {
+		t.Errorf("unexpected known_hosts entry: %s", data)
+	}
+
+	// A fresh callback now knows the key and does not prompt again
+	callback, err = client.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("hostKeyCallback() error = %v", err)
+	}
+	if err := callback("nas.local:22", remote, key); err != nil {
+		t.Errorf("expected known key to verify, got %v", err)
+	}
+	if prompted != 1 {
+		t.Errorf("expected no further prompts, got %d", prompted)
+	}
+
+	// A different key for the same host is a mismatch
+	other := newTestHostKey(t)
+	err = callback("nas.local:22", remote, other)
+
+	var mismatch *HostKeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected HostKeyMismatchError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), ssh.FingerprintSHA256(other)) || !strings.Contains(err.Error(), ssh.FingerprintSHA256(key)) {
+		t.Errorf("expected both fingerprints in error, got %v", err)
+	}
+}
+
+func TestHostKeyCallback_DifferentKeyType(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+
+	prompted := 0
+	client := &Client{host: "nas.local", port: 22, hostKeyPrompt: func(string, ssh.PublicKey) (bool, error) {
+		prompted++
+		return true, nil
+	}}
+	if algos := client.hostKeyAlgorithms(); algos != nil {
+		t.Errorf("hostKeyAlgorithms() for an unknown host = %v, want the defaults", algos)
+	}
+
+	callback, err := client.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("hostKeyCallback() error = %v", err)
+	}
+	if err := callback("nas.local:22", remote, newTestHostKey(t)); err != nil {
+		t.Fatalf("expected unknown key to be accepted, got %v", err)
+	}
+	if algos := client.hostKeyAlgorithms(); strings.Join(algos, ",") != ssh.KeyAlgoED25519 {
+		t.Errorf("hostKeyAlgorithms() = %v, want only the known ed25519 type", algos)
+	}
+
+	// An ECDSA key is not a mismatch of the recorded ed25519 key but a key
+	// seen for the first time
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err = client.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("hostKeyCallback() error = %v", err)
+	}
+	if err := callback("nas.local:22", remote, ecdsaKey); err != nil {
+		t.Fatalf("expected a key of another type to be treated as unknown, got %v", err)
+	}
+	if prompted != 2 {
+		t.Errorf("expected 2 prompts, got %d", prompted)
+	}
+	want := ssh.KeyAlgoED25519 + "," + ssh.KeyAlgoECDSA256
+	if algos := client.hostKeyAlgorithms(); strings.Join(algos, ",") != want {
+		t.Errorf("hostKeyAlgorithms() = %v, want %s", algos, want)
+	}
+}
+
+func TestHostKeyCallback_Rejected(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	client := &Client{hostKeyPrompt: func(string, ssh.PublicKey) (bool, error) {
+		return false, nil
+	}}
+
+	callback, err := client.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("hostKeyCallback() error = %v", err)
+	}
+	if err := callback("nas.local:22", &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}, newTestHostKey(t)); err == nil {
+		t.Error("expected rejected key to fail verification")
+	}
+}
+
+func TestHostKeyCallback_UserKnownHosts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	key := newTestHostKey(t)
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	line := "nas.local " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + "\n"
+	if err := os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{hostKeyPrompt: func(string, ssh.PublicKey) (bool, error) {
+		t.Error("did not expect a prompt for a key in ~/.ssh/known_hosts")
+		return false, nil
+	}}
+
+	callback, err := client.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("hostKeyCallback() error = %v", err)
+	}
+	if err := callback("nas.local:22", &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}, key); err != nil {
+		t.Errorf("expected key from ~/.ssh/known_hosts to verify, got %v", err)
+	}
+}
+
+func TestHostKeyCallback_InsecureSkip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	client := &Client{insecureSkipHostKeyCheck: true}
+	callback, err := client.hostKeyCallback()
+	if err != nil {
+		t.Fatalf("hostKeyCallback() error = %v", err)
+	}
+	if err := callback("nas.local:22", &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}, newTestHostKey(t)); err != nil {
+		t.Errorf("expected any key to be accepted, got %v", err)
+	}
+}
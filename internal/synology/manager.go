@@ -0,0 +1,91 @@
+package synology
+
+import "context"
+
+// VMManager is the set of VM operations the CLI depends on. It is satisfied
+// by Client and by test doubles such as test/mock.MockClient. Every method
+// gives up and returns an error once ctx is cancelled.
+type VMManager interface {
+	// ListVMs lists all virtual machines
+	ListVMs(ctx context.Context) ([]VM, error)
+	// StartVM starts a virtual machine
+	StartVM(ctx context.Context, vmName string) error
+	// StopVM gracefully stops a virtual machine
+	StopVM(ctx context.Context, vmName string) error
+	// PowerOffVM forcibly powers off a virtual machine
+	PowerOffVM(ctx context.Context, vmName string) error
+	// RestartVM restarts a virtual machine
+	RestartVM(ctx context.Context, vmName string) error
+	// ResetVM hard-resets a virtual machine without a guest shutdown
+	ResetVM(ctx context.Context, vmName string) error
+	// PauseVM suspends a running virtual machine in memory
+	PauseVM(ctx context.Context, vmName string) error
+	// ResumeVM resumes a paused virtual machine
+	ResumeVM(ctx context.Context, vmName string) error
+	// SaveVM saves a virtual machine's state to disk and stops it
+	SaveVM(ctx context.Context, vmName string) error
+	// RestoreVM starts a virtual machine from its saved state
+	RestoreVM(ctx context.Context, vmName string) error
+	// GetVMStatus gets the status of a specific virtual machine
+	GetVMStatus(ctx context.Context, vmName string) (*VM, error)
+	// CreateVM creates a new virtual machine
+	CreateVM(ctx context.Context, config VMConfig) error
+	// DeleteVM deletes a virtual machine
+	DeleteVM(ctx context.Context, vmName string) error
+
+	// ListTemplates lists available VM templates
+	ListTemplates(ctx context.Context) ([]Template, error)
+	// CreateTemplate creates a new VM template from an existing VM
+	CreateTemplate(ctx context.Context, templateName, vmName string) error
+	// DeleteTemplate deletes a VM template
+	DeleteTemplate(ctx context.Context, templateName string) error
+}
+
+// CreatePlanner is implemented by backends that can show what CreateVM
+// would send to the NAS without changing anything
+type CreatePlanner interface {
+	// PlanCreate renders the request CreateVM would make for config
+	PlanCreate(ctx context.Context, config VMConfig) ([]byte, error)
+}
+
+// GuestCreator is implemented by the VMM backends, which report the guest
+// ID of a new VM
+type GuestCreator interface {
+	// CreateGuest creates a new virtual machine and returns its guest ID
+	CreateGuest(ctx context.Context, config VMConfig) (*GuestCreateResult, error)
+}
+
+// SnapshotManager is implemented by backends that can manage VM snapshots
+type SnapshotManager interface {
+	// CreateSnapshot takes a snapshot of a virtual machine
+	CreateSnapshot(ctx context.Context, vmName string, opts SnapshotOptions) error
+	// ListSnapshots lists the snapshots of a virtual machine
+	ListSnapshots(ctx context.Context, vmName string) ([]Snapshot, error)
+	// RevertSnapshot reverts a virtual machine to a snapshot
+	RevertSnapshot(ctx context.Context, vmName, snapshotName string) error
+	// DeleteSnapshot deletes a snapshot
+	DeleteSnapshot(ctx context.Context, vmName, snapshotName string) error
+}
+
+// DomainInspector is implemented by backends that can return the full
+// definition of a VM
+type DomainInspector interface {
+	// GetDomain returns the definition of a virtual machine
+	GetDomain(ctx context.Context, vmName string) (*Domain, error)
+}
+
+// VMUpdater is implemented by backends that can change the definition of
+// an existing VM
+type VMUpdater interface {
+	// UpdateVM applies update to a virtual machine
+	UpdateVM(ctx context.Context, vmName string, update VMUpdate) error
+}
+
+// Ensure Client implements VMManager and the optional interfaces
+var (
+	_ VMManager       = (*Client)(nil)
+	_ CreatePlanner   = (*Client)(nil)
+	_ SnapshotManager = (*Client)(nil)
+	_ DomainInspector = (*Client)(nil)
+	_ VMUpdater       = (*Client)(nil)
+)
@@ -0,0 +1,205 @@
+package synology
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" // nolint:gosec // TOTP is defined over HMAC-SHA1
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// totpPeriod is the TOTP time step used by DSM and authenticator apps
+const totpPeriod = 30
+
+// TwoFactor configures how WebAPIClient answers DSM's 2-step verification
+type TwoFactor struct {
+	// Code is a one-time code to use as is
+	Code string
+	// Secret returns the base32 TOTP secret to generate codes from, or ""
+	// if none is stored
+	Secret func(ctx context.Context) (string, error)
+	// Prompt asks the user for a code
+	Prompt func(ctx context.Context) (string, error)
+
+	// Devices remembers the device tokens DSM issues after a successful
+	// 2-step verification, so later logins skip it. Nil disables tokens.
+	Devices *DeviceTokens
+	// DeviceName is the name of this device in DSM's trusted devices
+	DeviceName string
+}
+
+// code returns a one-time code: Code if set, otherwise one generated from
+// the TOTP secret, otherwise one entered at the prompt
+func (tf TwoFactor) code(ctx context.Context) (string, error) {
+	if tf.Code != "" {
+		return tf.Code, nil
+	}
+	if tf.Secret != nil {
+		secret, err := tf.Secret(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get TOTP secret: %w", err)
+		}
+		if secret != "" {
+			return TOTP(secret, time.Now())
+		}
+	}
+	if tf.Prompt != nil {
+		return tf.Prompt(ctx)
+	}
+	return "", fmt.Errorf("no code available; pass --otp-code or store a TOTP secret with 'syno-vm config set --otp-secret'")
+}
+
+// TOTP returns the 6-digit RFC 6238 code of a base32 secret at time t
+func TOTP(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/totpPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
+
+// ValidateTOTPSecret checks that a TOTP secret is valid base32
+func ValidateTOTPSecret(secret string) error {
+	_, err := decodeTOTPSecret(secret)
+	return err
+}
+
+// decodeTOTPSecret decodes a base32 secret as shown by DSM, ignoring case,
+// spaces and padding
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("invalid TOTP secret: expected the base32 key shown when setting up 2-step verification")
+	}
+	return key, nil
+}
+
+// PromptOTP asks for a 2-step verification code on the terminal
+func PromptOTP(ctx context.Context) (string, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return "", fmt.Errorf("stdin is not a terminal to ask for a code; pass --otp-code or store a TOTP secret with 'syno-vm config set --otp-secret'")
+	}
+
+	fmt.Fprint(os.Stderr, "2-step verification code: ")
+
+	// A read from the terminal cannot be interrupted, so it is left behind
+	// if ctx ends first
+	type result struct {
+		answer string
+		err    error
+	}
+	read := make(chan result, 1)
+	go func() {
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		read <- result{answer, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stderr)
+		return "", ctx.Err()
+	case r := <-read:
+		if r.err != nil {
+			return "", fmt.Errorf("failed to read code: %w", r.err)
+		}
+		return strings.TrimSpace(r.answer), nil
+	}
+}
+
+// DeviceTokens stores the DSM device tokens of each account in a file
+// readable only by the current user, since a token stands in for the
+// second factor
+type DeviceTokens struct {
+	path string
+}
+
+// DefaultDeviceTokensPath returns the default location of the device token
+// file, ~/.syno-vm/device-tokens.json
+func DefaultDeviceTokensPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".syno-vm", "device-tokens.json"), nil
+}
+
+// NewDeviceTokens returns the device tokens stored at path
+func NewDeviceTokens(path string) *DeviceTokens {
+	return &DeviceTokens{path: path}
+}
+
+// Get returns the device token of account, or "" if there is none
+func (d *DeviceTokens) Get(account string) string {
+	tokens, err := d.load()
+	if err != nil {
+		return ""
+	}
+	return tokens[account]
+}
+
+// Set stores the device token of account. An empty token removes it.
+func (d *DeviceTokens) Set(account, token string) error {
+	tokens, err := d.load()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		delete(tokens, account)
+	} else {
+		tokens[account] = token
+	}
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode device tokens: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0700); err != nil {
+		return fmt.Errorf("failed to create device token directory: %w", err)
+	}
+
+	// Write a temporary file and rename it, so a failed write cannot lose
+	// the tokens of other accounts
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write device tokens: %w", err)
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write device tokens: %w", err)
+	}
+	return nil
+}
+
+// load reads the token file. A missing file holds no tokens.
+func (d *DeviceTokens) load() (map[string]string, error) {
+	tokens := map[string]string{}
+	data, err := os.ReadFile(d.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device tokens: %w", err)
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse device tokens %s: %w", d.path, err)
+	}
+	return tokens, nil
+}
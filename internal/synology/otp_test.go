@@ -0,0 +1,194 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 test vectors for the SHA-1 secret "12345678901234567890",
+	// truncated to the 6 digits DSM uses
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTP(secret, time.Unix(tt.unix, 0))
+		if err != nil || got != tt.want {
+			t.Errorf("TOTP(%d) = %q, %v; want %q", tt.unix, got, err, tt.want)
+		}
+	}
+
+	// DSM shows secrets in lower case groups
+	if got, _ := TOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0)); got != "287082" {
+		t.Errorf("TOTP() of a formatted secret = %q", got)
+	}
+	if err := ValidateTOTPSecret("not base32!"); err == nil {
+		t.Error("expected an invalid secret to be rejected")
+	}
+}
+
+// fakeAuth is a DSM login endpoint requiring 2-step verification with one
+// of codes, which issues device token "dev-1"
+type fakeAuth struct {
+	codes  []string
+	logins []map[string]string
+}
+
+func (f *fakeAuth) valid(code string) bool {
+	for _, c := range f.codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	q := r.PostForm
+	params := map[string]string{}
+	for key := range q {
+		params[key] = q.Get(key)
+	}
+	f.logins = append(f.logins, params)
+
+	resp := WebAPIResponse{}
+	switch {
+	case q.Get("device_id") == "dev-1":
+		resp = WebAPIResponse{Success: true, Data: map[string]interface{}{"sid": "sid-device"}}
+	case q.Get("otp_code") == "":
+		resp.Error = &WebAPIError{Code: errCodeOTPRequired}
+	case !f.valid(q.Get("otp_code")):
+		resp.Error = &WebAPIError{Code: errCodeOTPInvalid}
+	default:
+		resp = WebAPIResponse{Success: true, Data: map[string]interface{}{"sid": "sid-otp"}}
+		if q.Get("enable_device_token") == "yes" {
+			resp.Data["did"] = "dev-1"
+		}
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func newTestWebAPIClient(t *testing.T, h http.Handler, tf TwoFactor) *WebAPIClient {
+	t.Helper()
+	srv := httptest.NewTLSServer(withAPIInfo(testAPIs, h))
+	t.Cleanup(srv.Close)
+
+	w := NewWebAPIClient("nas.local", "admin", "s3cret")
+	w.baseURL = srv.URL
+	w.SetTwoFactor(tf)
+	return w
+}
+
+func TestDeviceTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device-tokens.json")
+	devices := NewDeviceTokens(path)
+
+	if err := devices.Set("admin@nas.local", "dev-1"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := devices.Set("admin@lab.local", "dev-2"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := devices.Set("admin@nas.local", ""); err != nil {
+		t.Fatalf("Set() of an empty token error = %v", err)
+	}
+	if got := devices.Get("admin@nas.local"); got != "" {
+		t.Errorf("removed token = %q", got)
+	}
+	if got := NewDeviceTokens(path).Get("admin@lab.local"); got != "dev-2" {
+		t.Errorf("token = %q, want dev-2", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	auth := &fakeAuth{codes: []string{"123456"}}
+	devices := NewDeviceTokens(filepath.Join(t.TempDir(), "device-tokens.json"))
+	prompts := 0
+	tf := TwoFactor{
+		Prompt: func(ctx context.Context) (string, error) {
+			prompts++
+			return "123456", nil
+		},
+		Devices:    devices,
+		DeviceName: "syno-vm test",
+	}
+
+	w := newTestWebAPIClient(t, auth, tf)
+	if err := w.Login(ctx); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if w.sessionID != "sid-otp" || prompts != 1 {
+		t.Errorf("session %q after %d prompts", w.sessionID, prompts)
+	}
+	if len(auth.logins) != 2 || auth.logins[1]["device_name"] != "syno-vm test" {
+		t.Errorf("unexpected logins %v", auth.logins)
+	}
+	if got := devices.Get("admin@nas.local"); got != "dev-1" {
+		t.Fatalf("device token = %q, want dev-1", got)
+	}
+
+	// The device token skips 2-step verification next time
+	w = newTestWebAPIClient(t, auth, tf)
+	if err := w.Login(ctx); err != nil {
+		t.Fatalf("Login() with device token error = %v", err)
+	}
+	if w.sessionID != "sid-device" || prompts != 1 {
+		t.Errorf("session %q after %d prompts; want the device token to be used", w.sessionID, prompts)
+	}
+}
+
+func TestLoginTwoFactorCodes(t *testing.T) {
+	ctx := context.Background()
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Now()
+	code, err := TOTP(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The client may generate its code in the next time step
+	next, _ := TOTP(secret, now.Add(totpPeriod*time.Second))
+
+	tests := []struct {
+		name    string
+		tf      TwoFactor
+		wantErr string
+	}{
+		{"one-time code", TwoFactor{Code: code}, ""},
+		{"TOTP secret", TwoFactor{Secret: func(ctx context.Context) (string, error) { return secret, nil }}, ""},
+		{"wrong code", TwoFactor{Code: "000000"}, "not accepted"},
+		{"no code", TwoFactor{}, "--otp-code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWebAPIClient(t, &fakeAuth{codes: []string{code, next}}, tt.tf)
+			err := w.Login(ctx)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Login() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Login() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package synology
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Session is a Web API session saved between invocations
+type Session struct {
+	// Account is the user@host the session belongs to
+	Account   string `json:"account"`
+	SID       string `json:"sid"`
+	SynoToken string `json:"synotoken,omitempty"`
+	// APIs are the APIs discovered at login
+	APIs    APIDirectory `json:"apis,omitempty"`
+	Created time.Time    `json:"created"`
+}
+
+// SessionCache keeps the Web API session of one context in a file readable
+// only by the current user, so later invocations reuse it instead of
+// logging in again
+type SessionCache struct {
+	path string
+}
+
+// NewSessionCache returns the session cache stored at path
+func NewSessionCache(path string) *SessionCache {
+	return &SessionCache{path: path}
+}
+
+// Path returns the location of the cache file
+func (c *SessionCache) Path() string {
+	return c.path
+}
+
+// Load returns the cached session, or nil if there is none
+func (c *SessionCache) Load() (*Session, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session cache: %w", err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse session cache %s: %w", c.path, err)
+	}
+	if s.SID == "" {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+// Save replaces the cached session
+func (c *SessionCache) Save(s Session) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session cache: %w", err)
+	}
+	return nil
+}
+
+// Clear removes the cached session
+func (c *SessionCache) Clear() error {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove session cache: %w", err)
+	}
+	return nil
+}
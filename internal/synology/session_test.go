@@ -0,0 +1,227 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSessions is a DSM Web API that knows one valid session at a time
+type fakeSessions struct {
+	mu      sync.Mutex
+	valid   string
+	logins  int
+	logouts int
+	calls   int
+}
+
+func (f *fakeSessions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_ = r.ParseForm()
+	q := r.PostForm
+	resp := WebAPIResponse{}
+	switch {
+	case q.Get("method") == "login":
+		f.logins++
+		f.valid = fmt.Sprintf("sid-%d", f.logins)
+		resp = WebAPIResponse{Success: true, Data: map[string]interface{}{"sid": f.valid, "synotoken": "token-" + f.valid}}
+	case q.Get("method") == "logout":
+		f.logouts++
+		f.valid = ""
+		resp.Success = true
+	case q.Get("_sid") != f.valid:
+		resp.Error = &WebAPIError{Code: errCodeSIDNotFound}
+	case r.Header.Get("X-SYNO-TOKEN") != "token-"+f.valid:
+		resp.Error = &WebAPIError{Code: errCodeNoPermission}
+	default:
+		f.calls++
+		resp = WebAPIResponse{Success: true, Data: map[string]interface{}{"sid": q.Get("_sid")}}
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func TestSessionCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions", "default.json")
+	c := NewSessionCache(path)
+
+	if s, err := c.Load(); s != nil || err != nil {
+		t.Fatalf("Load() of a missing cache = %+v, %v", s, err)
+	}
+
+	want := Session{
+		Account:   "admin@nas.local",
+		SID:       "sid-1",
+		SynoToken: "token",
+		APIs:      APIDirectory{apiGuest: {Path: "entry.cgi", MinVersion: 1, MaxVersion: 1}},
+		Created:   time.Unix(1700000000, 0).UTC(),
+	}
+	if err := c.Save(want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("session cache mode = %o, want 600", perm)
+		}
+	}
+	if got, err := c.Load(); err != nil || !reflect.DeepEqual(*got, want) {
+		t.Errorf("Load() = %+v, %v; want %+v", got, err, want)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if err := c.Clear(); err != nil {
+		t.Errorf("Clear() of a missing cache error = %v", err)
+	}
+}
+
+func TestWebAPIClientReusesCachedSession(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeSessions{}
+	cache := NewSessionCache(filepath.Join(t.TempDir(), "default.json"))
+
+	// The first invocation logs in and caches its session
+	w := newTestWebAPIClient(t, api, TwoFactor{})
+	if err := w.SetSessionCache(cache); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.CallAPI(ctx, apiGuest, "list", "1", nil); err != nil {
+		t.Fatalf("CallAPI() error = %v", err)
+	}
+	if api.logins != 1 {
+		t.Fatalf("logged in %d times, want 1", api.logins)
+	}
+
+	// The next one reuses it without logging in
+	w2 := NewWebAPIClient("nas.local", "admin", "s3cret")
+	w2.baseURL = w.baseURL
+	if err := w2.SetSessionCache(cache); err != nil {
+		t.Fatal(err)
+	}
+	if !w2.HasSession() {
+		t.Fatal("cached session was not loaded")
+	}
+	if _, err := w2.CallAPI(ctx, apiGuest, "list", "1", nil); err != nil {
+		t.Fatalf("CallAPI() with cached session error = %v", err)
+	}
+	if api.logins != 1 || api.calls != 2 {
+		t.Errorf("logins = %d, calls = %d; want the cached session to be used", api.logins, api.calls)
+	}
+
+	// When DSM forgets the session, the client logs in again and caches
+	// the new session
+	api.valid = "sid-expired"
+	resp, err := w2.CallAPI(ctx, apiGuest, "list", "1", nil)
+	if err != nil || !resp.Success {
+		t.Fatalf("CallAPI() after expiry = %+v, %v", resp, err)
+	}
+	if api.logins != 2 {
+		t.Errorf("logged in %d times, want 2", api.logins)
+	}
+	if s, _ := cache.Load(); s == nil || s.SID != api.valid {
+		t.Errorf("cached session = %+v, want %s", s, api.valid)
+	}
+
+	// A session of another account is ignored
+	w3 := NewWebAPIClient("nas.local", "ops", "s3cret")
+	if err := w3.SetSessionCache(cache); err != nil {
+		t.Fatal(err)
+	}
+	if w3.HasSession() {
+		t.Error("used the cached session of another account")
+	}
+
+	if err := w2.Logout(ctx); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if s, _ := cache.Load(); s != nil {
+		t.Errorf("Logout() left session %+v in the cache", s)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeSessions{}
+	cache := NewSessionCache(filepath.Join(t.TempDir(), "default.json"))
+	client := func() *WebAPIClient {
+		t.Helper()
+		w := newTestWebAPIClient(t, api, TwoFactor{})
+		if err := w.SetSessionCache(cache); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	if kept, err := client().Refresh(ctx); err != nil || kept || api.logins != 1 {
+		t.Fatalf("Refresh() without a session = %v, %v after %d logins; want a login", kept, err, api.logins)
+	}
+
+	// A session DSM accepts is kept
+	if kept, err := client().Refresh(ctx); err != nil || !kept || api.logins != 1 {
+		t.Errorf("Refresh() with a valid session = %v, %v after %d logins; want it kept", kept, err, api.logins)
+	}
+
+	// One it rejects is logged out and replaced
+	api.valid = "sid-expired"
+	w := client()
+	if kept, err := w.Refresh(ctx); err != nil || kept || api.logins != 2 || api.logouts != 1 {
+		t.Errorf("Refresh() with a rejected session = %v, %v after %d logins, %d logouts; want a logout and a login", kept, err, api.logins, api.logouts)
+	}
+	if s, _ := cache.Load(); s == nil || s.SID != api.valid || w.sessionID != api.valid {
+		t.Errorf("cached session = %+v, want %s", s, api.valid)
+	}
+}
+
+func TestConcurrentCallsShareOneLogin(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeSessions{}
+	w := newTestWebAPIClient(t, api, TwoFactor{})
+
+	callAll := func() {
+		t.Helper()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if resp, err := w.CallAPI(ctx, apiGuest, "list", "1", nil); err != nil || !resp.Success {
+					t.Errorf("CallAPI() = %+v, %v", resp, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	logins := func() int {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		return api.logins
+	}
+
+	callAll()
+	if n := logins(); n != 1 {
+		t.Errorf("logged in %d times, want 1", n)
+	}
+
+	// Calls that see the session expire log in again only once
+	api.mu.Lock()
+	api.valid = "sid-expired"
+	api.mu.Unlock()
+	callAll()
+	if n := logins(); n != 2 {
+		t.Errorf("logged in %d times after expiry, want 2", n)
+	}
+}
@@ -0,0 +1,87 @@
+package synology
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ShellQuote quotes s so that a POSIX shell reads it back as exactly one
+// word with the same contents. Strings made only of characters that are not
+// special to the shell in argument position are returned unchanged.
+func ShellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool { return !isShellSafe(r) }) < 0 {
+		return s
+	}
+	return singleQuote(s)
+}
+
+// singleQuote wraps s in single quotes. Inside them everything is literal
+// except the closing quote, which is emitted as '"'"' (close, double-quoted
+// quote, reopen).
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// isShellSafe reports whether r can appear unquoted in an argument word.
+// '=' is only special in the command word, which shellCommand handles.
+func isShellSafe(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		strings.ContainsRune("-_./,:@+%=", r)
+}
+
+// shellCommand builds a shell command line from a program and its arguments,
+// quoting every word
+func shellCommand(args ...string) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = ShellQuote(arg)
+	}
+	// An unquoted command word containing '=' would be parsed as a variable
+	// assignment rather than the program to run
+	if len(args) > 0 && strings.Contains(words[0], "=") && words[0] == args[0] {
+		words[0] = singleQuote(args[0])
+	}
+	return strings.Join(words, " ")
+}
+
+// virshCommand builds a virsh command line from its arguments
+func virshCommand(args ...string) string {
+	return shellCommand(append([]string{virshPath}, args...)...)
+}
+
+// ValidateVMName checks that name is acceptable to libvirt as a domain name:
+// non-empty valid UTF-8 without '/' or control characters. Names may not
+// start with '-' so they can never be mistaken for a virsh option.
+func ValidateVMName(name string) error {
+	return validateName("VM", name)
+}
+
+// ValidateSnapshotName checks a snapshot name by the same rules as
+// ValidateVMName
+func ValidateSnapshotName(name string) error {
+	return validateName("snapshot", name)
+}
+
+// validateName checks a libvirt object name; kind is used in error messages
+func validateName(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s name is required", kind)
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("invalid %s name %q: not valid UTF-8", kind, name)
+	}
+	if strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid %s name %q: must not start with '-'", kind, name)
+	}
+	for _, r := range name {
+		if r == '/' {
+			return fmt.Errorf("invalid %s name %q: must not contain '/'", kind, name)
+		}
+		if unicode.IsControl(r) {
+			return fmt.Errorf("invalid %s name %q: must not contain control characters", kind, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package synology
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// shellSeeds are arguments that would break out of their word if they were
+// interpolated into a command line unquoted
+var shellSeeds = []string{
+	"",
+	"simple",
+	"with space",
+	"it's",
+	`"; rm -rf / #`,
+	";rm -rf /",
+	"$(reboot)",
+	"`id`",
+	"${HOME}",
+	"a\nb",
+	"tab\there",
+	"*",
+	"~root",
+	"-rf",
+	"'",
+	"''",
+	`\`,
+	"a=b",
+	"| cat /etc/shadow",
+	"&& halt &",
+	"ümlaut",
+	"\xff\xfe",
+}
+
+// requireShell skips the test if no POSIX shell is available
+func requireShell(tb testing.TB) {
+	tb.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		tb.Skip("sh not available")
+	}
+}
+
+// FuzzShellQuote checks that the shell reads every quoted string back as
+// exactly the original string
+func FuzzShellQuote(f *testing.F) {
+	for _, seed := range shellSeeds {
+		f.Add(seed)
+	}
+	requireShell(f)
+
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.ContainsRune(s, 0) {
+			t.Skip("command arguments cannot contain NUL")
+		}
+
+		out, err := exec.Command("sh", "-c", "printf '%s' "+ShellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("shell failed for %q (quoted %s): %v", s, ShellQuote(s), err)
+		}
+		if string(out) != s {
+			t.Errorf("ShellQuote(%q) = %s, shell read back %q", s, ShellQuote(s), out)
+		}
+	})
+}
+
+// FuzzShellCommand checks that each argument of a built command line stays
+// a single, unchanged word
+func FuzzShellCommand(f *testing.F) {
+	for _, a := range shellSeeds {
+		f.Add(a, "second word")
+	}
+	requireShell(f)
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if strings.ContainsRune(a, 0) || strings.ContainsRune(b, 0) {
+			t.Skip("command arguments cannot contain NUL")
+		}
+
+		cmd := shellCommand("printf", `%s\0`, a, b)
+		out, err := exec.Command("sh", "-c", cmd).Output()
+		if err != nil {
+			t.Fatalf("shell failed for %s: %v", cmd, err)
+		}
+
+		words := strings.Split(string(out), "\x00")
+		if len(words) != 3 || words[0] != a || words[1] != b || words[2] != "" {
+			t.Errorf("command %s produced words %q, want [%q %q]", cmd, words, a, b)
+		}
+	})
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"":                 "''",
+		"test-vm":          "test-vm",
+		"runner=admin":     "runner=admin",
+		"/usr/local/bin/x": "/usr/local/bin/x",
+		"my vm":            "'my vm'",
+		"it's":             `'it'"'"'s'`,
+		";rm -rf /":        "';rm -rf /'",
+	}
+
+	for in, want := range tests {
+		if got := ShellQuote(in); got != want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestShellCommand_QuotesAssignmentInCommandWord(t *testing.T) {
+	if got := shellCommand("a=b", "c=d"); got != "'a=b' c=d" {
+		t.Errorf("shellCommand() = %s, want 'a=b' c=d", got)
+	}
+}
+
+func TestVirshCommand(t *testing.T) {
+	got := virshCommand("start", "my vm;reboot")
+	want := "/usr/local/bin/virsh start 'my vm;reboot'"
+	if got != want {
+		t.Errorf("virshCommand() = %s, want %s", got, want)
+	}
+}
+
+func TestValidateVMName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"test-vm", false},
+		{"Ubuntu Server 22.04", false},
+		{"vm_01.lab", false},
+		{"ümlaut", false},
+		{"", true},
+		{"-rf", true},
+		{"a/b", true},
+		{"a\nb", true},
+		{"a\x00b", true},
+		{"\xff", true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateVMName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateVMName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package synology
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Snapshot represents a snapshot of a virtual machine
+type Snapshot struct {
+	Name        string    `json:"name"`
+	VMName      string    `json:"vm_name"`
+	Description string    `json:"description,omitempty"`
+	State       string    `json:"state"`            // VM state when the snapshot was taken
+	Parent      string    `json:"parent,omitempty"` // empty for root snapshots
+	CreatedAt   time.Time `json:"created_at"`
+	Current     bool      `json:"current"`
+}
+
+// SnapshotOptions holds the options for creating a snapshot
+type SnapshotOptions struct {
+	Name        string `json:"name,omitempty"` // generated by libvirt if empty
+	Description string `json:"description,omitempty"`
+	Quiesce     bool   `json:"quiesce,omitempty"` // freeze guest filesystems via the guest agent
+}
+
+// snapshotXML is the part of 'virsh snapshot-dumpxml' output we use
+type snapshotXML struct {
+	XMLName      xml.Name `xml:"domainsnapshot"`
+	Name         string   `xml:"name"`
+	Description  string   `xml:"description"`
+	State        string   `xml:"state"`
+	CreationTime int64    `xml:"creationTime"`
+	Parent       struct {
+		Name string `xml:"name"`
+	} `xml:"parent"`
+}
+
+// CreateSnapshot takes a snapshot using virsh snapshot-create-as
+func (c *Client) CreateSnapshot(ctx context.Context, vmName string, opts SnapshotOptions) error {
+	var args []string
+	if opts.Name != "" {
+		if err := ValidateSnapshotName(opts.Name); err != nil {
+			return err
+		}
+		args = append(args, "--name", opts.Name)
+	}
+	if opts.Description != "" {
+		args = append(args, "--description", opts.Description)
+	}
+	if opts.Quiesce {
+		args = append(args, "--quiesce")
+	}
+	args = append(args, "--atomic")
+
+	_, err := c.domainCommand(ctx, "snapshot-create-as", vmName, args...)
+	return err
+}
+
+// ListSnapshots lists the snapshots of a VM in a single round trip: the
+// current snapshot name on the first line, then the XML of every snapshot
+func (c *Client) ListSnapshots(ctx context.Context, vmName string) ([]Snapshot, error) {
+	if err := ValidateVMName(vmName); err != nil {
+		return nil, err
+	}
+
+	script := fmt.Sprintf(
+		`names=$(%s) || exit; cur=$(%s 2>/dev/null); printf '%%s\n' "$cur"; `+
+			`printf '%%s\n' "$names" | while IFS= read -r s; do [ -z "$s" ] || %s --snapshotname "$s" || exit; done`,
+		virshCommand("snapshot-list", vmName, "--name"),
+		virshCommand("snapshot-current", vmName, "--name"),
+		virshCommand("snapshot-dumpxml", vmName),
+	)
+
+	output, err := c.ExecuteCommand(ctx, script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	return parseSnapshotList(vmName, output)
+}
+
+// RevertSnapshot reverts a VM to a snapshot using virsh snapshot-revert
+func (c *Client) RevertSnapshot(ctx context.Context, vmName, snapshotName string) error {
+	if err := ValidateSnapshotName(snapshotName); err != nil {
+		return err
+	}
+	_, err := c.domainCommand(ctx, "snapshot-revert", vmName, "--snapshotname", snapshotName)
+	return err
+}
+
+// DeleteSnapshot deletes a snapshot using virsh snapshot-delete. Its
+// children are kept and re-parented by libvirt.
+func (c *Client) DeleteSnapshot(ctx context.Context, vmName, snapshotName string) error {
+	if err := ValidateSnapshotName(snapshotName); err != nil {
+		return err
+	}
+	_, err := c.domainCommand(ctx, "snapshot-delete", vmName, "--snapshotname", snapshotName)
+	return err
+}
+
+// parseSnapshotList parses the output of the ListSnapshots script
+func parseSnapshotList(vmName, output string) ([]Snapshot, error) {
+	current, docs, _ := strings.Cut(output, "\n")
+	current = strings.TrimSpace(current)
+
+	var snapshots []Snapshot
+	dec := xml.NewDecoder(strings.NewReader(docs))
+	for {
+		var s snapshotXML
+		if err := dec.Decode(&s); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse snapshot XML: %w", err)
+		}
+
+		snapshots = append(snapshots, Snapshot{
+			Name:        s.Name,
+			VMName:      vmName,
+			Description: strings.TrimSpace(s.Description),
+			State:       s.State,
+			Parent:      s.Parent.Name,
+			CreatedAt:   time.Unix(s.CreationTime, 0),
+			Current:     s.Name != "" && s.Name == current,
+		})
+	}
+
+	return snapshots, nil
+}
@@ -0,0 +1,56 @@
+package synology
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSnapshotList(t *testing.T) {
+	output := "after-upgrade\n" +
+		`<domainsnapshot>
+  <name>clean-install</name>
+  <description>Fresh OS</description>
+  <state>shutoff</state>
+  <creationTime>1700000000</creationTime>
+  <domain type='kvm'><name>web</name></domain>
+</domainsnapshot>
+<domainsnapshot>
+  <name>after-upgrade</name>
+  <state>running</state>
+  <parent><name>clean-install</name></parent>
+  <creationTime>1700003600</creationTime>
+</domainsnapshot>
+`
+
+	snapshots, err := parseSnapshotList("web", output)
+	if err != nil {
+		t.Fatalf("parseSnapshotList() error = %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(snapshots))
+	}
+
+	root := snapshots[0]
+	if root.Name != "clean-install" || root.Description != "Fresh OS" || root.State != "shutoff" ||
+		root.Parent != "" || root.Current || root.VMName != "web" {
+		t.Errorf("unexpected root snapshot: %+v", root)
+	}
+	if !root.CreatedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected creation time: %v", root.CreatedAt)
+	}
+
+	child := snapshots[1]
+	if child.Parent != "clean-install" || !child.Current {
+		t.Errorf("unexpected child snapshot: %+v", child)
+	}
+}
+
+func TestParseSnapshotList_Empty(t *testing.T) {
+	snapshots, err := parseSnapshotList("web", "\n")
+	if err != nil {
+		t.Fatalf("parseSnapshotList() error = %v", err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("expected no snapshots, got %d", len(snapshots))
+	}
+}
@@ -0,0 +1,59 @@
+package synology
+
+import "strings"
+
+// VMState is the normalised power state of a virtual machine, independent
+// of the backend that reported it
+type VMState string
+
+// VM states
+const (
+	StateRunning      VMState = "running"
+	StatePaused       VMState = "paused"
+	StateShuttingDown VMState = "shutting-down"
+	StateStopped      VMState = "stopped"
+	StateCrashed      VMState = "crashed"
+	StateSuspended    VMState = "suspended" // guest-initiated power management suspend
+	StateUnknown      VMState = "unknown"
+)
+
+// VMStates lists the normalised states
+var VMStates = []VMState{
+	StateRunning, StatePaused, StateShuttingDown, StateStopped, StateCrashed, StateSuspended, StateUnknown,
+}
+
+// ParseVMState maps a state reported by virsh or the VMM API onto a VMState.
+// States it does not recognise are returned lower-cased rather than dropped.
+func ParseVMState(s string) VMState {
+	switch state := strings.ToLower(strings.TrimSpace(s)); state {
+	case "running", "idle", "blocked", "booting":
+		return StateRunning
+	case "paused":
+		return StatePaused
+	case "in shutdown", "shutting_down", "shutting down":
+		return StateShuttingDown
+	case "shut off", "shutoff", "shutdown", "stopped", "stop":
+		return StateStopped
+	case "crashed":
+		return StateCrashed
+	case "pmsuspended":
+		return StateSuspended
+	case "", "no state", "nostate":
+		return StateUnknown
+	default:
+		return VMState(state)
+	}
+}
+
+// libvirtStates maps virDomainState values, as reported by
+// 'virsh domstats --state', onto VMStates
+var libvirtStates = map[int]VMState{
+	0: StateUnknown,
+	1: StateRunning,
+	2: StateRunning, // blocked on a resource
+	3: StatePaused,
+	4: StateShuttingDown,
+	5: StateStopped,
+	6: StateCrashed,
+	7: StateSuspended,
+}
@@ -0,0 +1,25 @@
+package synology
+
+import "testing"
+
+func TestParseVMState(t *testing.T) {
+	tests := map[string]VMState{
+		"running":     StateRunning,
+		"idle":        StateRunning,
+		"paused":      StatePaused,
+		"in shutdown": StateShuttingDown,
+		"shut off":    StateStopped,
+		"shutdown":    StateStopped,
+		"Stopped":     StateStopped,
+		"crashed":     StateCrashed,
+		"pmsuspended": StateSuspended,
+		"":            StateUnknown,
+		"Moving":      "moving",
+	}
+
+	for in, want := range tests {
+		if got := ParseVMState(in); got != want {
+			t.Errorf("ParseVMState(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package synology
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stats is a point-in-time sample of resource usage on the NAS
+type Stats struct {
+	Host    HostStats     `json:"host"`
+	Domains []DomainStats `json:"domains"`
+}
+
+// HostStats is the capacity of the NAS as seen by the hypervisor
+type HostStats struct {
+	CPUs            int    `json:"cpus"`
+	MemoryBytes     uint64 `json:"memory_bytes"`
+	MemoryFreeBytes uint64 `json:"memory_free_bytes,omitempty"` // 0 if not reported
+}
+
+// DomainStats is the resource usage of one VM. Counters are cumulative since
+// the VM started; optional values are nil when the hypervisor does not
+// report them, e.g. without a balloon driver in the guest.
+type DomainStats struct {
+	Name  string  `json:"name"`
+	State VMState `json:"state"`
+	VCPUs int     `json:"vcpus"`
+
+	CPUTimeNs    uint64 `json:"cpu_time_ns"`
+	CPUUserNs    uint64 `json:"cpu_user_ns"`
+	CPUSystemNs  uint64 `json:"cpu_system_ns"`
+	MemoryMaxKiB uint64 `json:"memory_max_kib"`
+
+	MemoryCurrentKiB   *uint64 `json:"memory_current_kib,omitempty"`
+	MemoryRSSKiB       *uint64 `json:"memory_rss_kib,omitempty"`
+	MemoryAvailableKiB *uint64 `json:"memory_available_kib,omitempty"`
+	MemoryUnusedKiB    *uint64 `json:"memory_unused_kib,omitempty"`
+
+	Disks []DiskStats `json:"disks,omitempty"`
+	NICs  []NICStats  `json:"nics,omitempty"`
+}
+
+// DiskStats is the I/O of one VM disk
+type DiskStats struct {
+	Device     string `json:"device"` // e.g. vda
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadReqs   uint64 `json:"read_reqs"`
+	WriteReqs  uint64 `json:"write_reqs"`
+	Capacity   uint64 `json:"capacity"`   // bytes, as seen by the guest
+	Allocation uint64 `json:"allocation"` // bytes used on the NAS
+}
+
+// NICStats is the traffic of one VM network interface
+type NICStats struct {
+	Interface string `json:"interface"` // host-side device, e.g. vnet0
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDrops   uint64 `json:"rx_drops"`
+	TxDrops   uint64 `json:"tx_drops"`
+}
+
+// StatsCollector is implemented by backends that can sample detailed
+// resource usage
+type StatsCollector interface {
+	CollectStats(ctx context.Context) (*Stats, error)
+}
+
+// Ensure Client implements StatsCollector
+var _ StatsCollector = (*Client)(nil)
+
+// Separators between the outputs combined in CollectStats
+const (
+	nodeInfoSeparator     = "--- nodeinfo ---"
+	nodeMemStatsSeparator = "--- nodememstats ---"
+)
+
+// CollectStats samples the usage of every VM and the host capacity in a
+// single round trip
+func (c *Client) CollectStats(ctx context.Context) (*Stats, error) {
+	// nodememstats is best effort: not every libvirt driver supports it
+	script := fmt.Sprintf("%s || exit; echo %s; %s || exit; echo %s; %s 2>/dev/null || true",
+		virshCommand("domstats", "--raw"),
+		nodeInfoSeparator,
+		virshCommand("nodeinfo"),
+		nodeMemStatsSeparator,
+		virshCommand("nodememstats"),
+	)
+
+	output, err := c.ExecuteCommand(ctx, script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect stats: %w", err)
+	}
+
+	domains, rest, _ := strings.Cut(output, nodeInfoSeparator+"\n")
+	nodeInfo, memStats, _ := strings.Cut(rest, nodeMemStatsSeparator+"\n")
+
+	stats := &Stats{
+		Host:    parseNodeInfo(nodeInfo),
+		Domains: parseDomainStats(domains),
+	}
+	if free, ok := parseNodeMemStats(memStats)["free"]; ok {
+		stats.Host.MemoryFreeBytes = free * 1024
+	}
+	return stats, nil
+}
+
+// parseDomainStats parses 'virsh domstats --raw' output. Domains are
+// returned in the order virsh lists them.
+func parseDomainStats(output string) []DomainStats {
+	var domains []DomainStats
+	disks := make(map[int]*DiskStats)
+	nics := make(map[int]*NICStats)
+
+	// finish moves the disks and NICs of the last domain into it
+	finish := func() {
+		if len(domains) == 0 {
+			return
+		}
+		d := &domains[len(domains)-1]
+		for _, i := range sortedKeys(disks) {
+			d.Disks = append(d.Disks, *disks[i])
+		}
+		for _, i := range sortedKeys(nics) {
+			d.NICs = append(d.NICs, *nics[i])
+		}
+		disks = make(map[int]*DiskStats)
+		nics = make(map[int]*NICStats)
+	}
+
+	scanDomStats(output, func(name, key, value string) {
+		if key == "" {
+			finish()
+			domains = append(domains, DomainStats{Name: name, State: StateUnknown})
+			return
+		}
+		d := &domains[len(domains)-1]
+
+		// Per-device keys look like block.0.rd.bytes and net.1.rx.bytes
+		if group, rest, ok := strings.Cut(key, "."); ok && (group == "block" || group == "net") {
+			index, field, ok := strings.Cut(rest, ".")
+			i, err := strconv.Atoi(index)
+			if !ok || err != nil {
+				return // block.count, net.count
+			}
+			if group == "block" {
+				if disks[i] == nil {
+					disks[i] = &DiskStats{}
+				}
+				setDiskStat(disks[i], field, value)
+			} else {
+				if nics[i] == nil {
+					nics[i] = &NICStats{}
+				}
+				setNICStat(nics[i], field, value)
+			}
+			return
+		}
+
+		n, _ := strconv.ParseUint(value, 10, 64)
+		switch key {
+		case "state.state":
+			if state, ok := libvirtStates[int(n)]; ok {
+				d.State = state
+			}
+		case "vcpu.current":
+			d.VCPUs = int(n)
+		case "cpu.time":
+			d.CPUTimeNs = n
+		case "cpu.user":
+			d.CPUUserNs = n
+		case "cpu.system":
+			d.CPUSystemNs = n
+		case "balloon.maximum":
+			d.MemoryMaxKiB = n
+		case "balloon.current":
+			d.MemoryCurrentKiB = &n
+		case "balloon.rss":
+			d.MemoryRSSKiB = &n
+		case "balloon.available":
+			d.MemoryAvailableKiB = &n
+		case "balloon.unused":
+			d.MemoryUnusedKiB = &n
+		}
+	})
+	finish()
+
+	return domains
+}
+
+func setDiskStat(d *DiskStats, field, value string) {
+	if field == "name" {
+		d.Device = value
+		return
+	}
+	n, _ := strconv.ParseUint(value, 10, 64)
+	switch field {
+	case "rd.bytes":
+		d.ReadBytes = n
+	case "wr.bytes":
+		d.WriteBytes = n
+	case "rd.reqs":
+		d.ReadReqs = n
+	case "wr.reqs":
+		d.WriteReqs = n
+	case "capacity":
+		d.Capacity = n
+	case "allocation":
+		d.Allocation = n
+	}
+}
+
+func setNICStat(s *NICStats, field, value string) {
+	if field == "name" {
+		s.Interface = value
+		return
+	}
+	n, _ := strconv.ParseUint(value, 10, 64)
+	switch field {
+	case "rx.bytes":
+		s.RxBytes = n
+	case "tx.bytes":
+		s.TxBytes = n
+	case "rx.pkts":
+		s.RxPackets = n
+	case "tx.pkts":
+		s.TxPackets = n
+	case "rx.errs":
+		s.RxErrors = n
+	case "tx.errs":
+		s.TxErrors = n
+	case "rx.drop":
+		s.RxDrops = n
+	case "tx.drop":
+		s.TxDrops = n
+	}
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// parseNodeInfo parses 'virsh nodeinfo' output:
+//
+//	CPU(s):              4
+//	Memory size:         8045832 KiB
+func parseNodeInfo(output string) HostStats {
+	var host HostStats
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "CPU(s)":
+			host.CPUs = int(n)
+		case "Memory size":
+			host.MemoryBytes = n * 1024
+		}
+	}
+	return host
+}
+
+// parseNodeMemStats parses 'virsh nodememstats' output into KiB values:
+//
+//	total  :              8045832 KiB
+//	free   :              1234567 KiB
+func parseNodeMemStats(output string) map[string]uint64 {
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			values[strings.TrimSpace(key)] = n
+		}
+	}
+	return values
+}
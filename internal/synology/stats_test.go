@@ -0,0 +1,99 @@
+package synology
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDomainStats(t *testing.T) {
+	output := `Domain: 'web-01'
+  state.state=1
+  state.reason=1
+  cpu.time=12500000000
+  cpu.user=9000000000
+  cpu.system=3000000000
+  balloon.current=2097152
+  balloon.maximum=4194304
+  balloon.rss=1048576
+  vcpu.current=2
+  vcpu.maximum=4
+  net.count=1
+  net.0.name=vnet0
+  net.0.rx.bytes=1000
+  net.0.rx.pkts=10
+  net.0.rx.errs=1
+  net.0.rx.drop=2
+  net.0.tx.bytes=2000
+  net.0.tx.pkts=20
+  net.0.tx.errs=3
+  net.0.tx.drop=4
+  block.count=2
+  block.1.name=vdb
+  block.1.rd.bytes=5
+  block.0.name=vda
+  block.0.rd.reqs=100
+  block.0.rd.bytes=409600
+  block.0.wr.reqs=50
+  block.0.wr.bytes=204800
+  block.0.allocation=1073741824
+  block.0.capacity=21474836480
+
+Domain: 'db-01'
+  state.state=5
+  state.reason=0
+  balloon.maximum=8388608
+  vcpu.current=4
+`
+
+	current, rss := uint64(2097152), uint64(1048576)
+	want := []DomainStats{
+		{
+			Name:             "web-01",
+			State:            StateRunning,
+			VCPUs:            2,
+			CPUTimeNs:        12500000000,
+			CPUUserNs:        9000000000,
+			CPUSystemNs:      3000000000,
+			MemoryMaxKiB:     4194304,
+			MemoryCurrentKiB: &current,
+			MemoryRSSKiB:     &rss,
+			Disks: []DiskStats{
+				{Device: "vda", ReadBytes: 409600, WriteBytes: 204800, ReadReqs: 100, WriteReqs: 50, Capacity: 21474836480, Allocation: 1073741824},
+				{Device: "vdb", ReadBytes: 5},
+			},
+			NICs: []NICStats{
+				{Interface: "vnet0", RxBytes: 1000, TxBytes: 2000, RxPackets: 10, TxPackets: 20, RxErrors: 1, TxErrors: 3, RxDrops: 2, TxDrops: 4},
+			},
+		},
+		{Name: "db-01", State: StateStopped, VCPUs: 4, MemoryMaxKiB: 8388608},
+	}
+
+	if got := parseDomainStats(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseNodeInfo(t *testing.T) {
+	output := `CPU model:           x86_64
+CPU(s):              4
+CPU frequency:       2000 MHz
+CPU socket(s):       1
+Memory size:         8045832 KiB
+`
+	want := HostStats{CPUs: 4, MemoryBytes: 8045832 * 1024}
+	if got := parseNodeInfo(output); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseNodeMemStats(t *testing.T) {
+	output := `total  :              8045832 KiB
+free   :              1234567 KiB
+buffers:                12345 KiB
+cached :               654321 KiB
+`
+	got := parseNodeMemStats(output)
+	if got["total"] != 8045832 || got["free"] != 1234567 || len(got) != 4 {
+		t.Errorf("unexpected values %v", got)
+	}
+}
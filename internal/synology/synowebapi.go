@@ -0,0 +1,147 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SynoWebAPIClient calls the Synology Web API by running the synowebapi tool
+// on the NAS over SSH. It needs no DSM password, only SSH access.
+type SynoWebAPIClient struct {
+	ssh    *Client
+	runner string
+
+	mu   sync.Mutex // guards apis
+	apis APIDirectory
+}
+
+// NewSynoWebAPIClient creates a synowebapi client that executes over the
+// given SSH client, running API calls as the SSH user
+func NewSynoWebAPIClient(client *Client) *SynoWebAPIClient {
+	return &SynoWebAPIClient{
+		ssh:    client,
+		runner: client.username,
+	}
+}
+
+// Close releases the underlying SSH connection
+func (s *SynoWebAPIClient) Close() error {
+	return s.ssh.Close()
+}
+
+// CallAPI runs a Web API method through synowebapi and decodes its response.
+// An empty version selects the highest one DSM supports.
+func (s *SynoWebAPIClient) CallAPI(ctx context.Context, api, method, version string, apiParams map[string]interface{}) (*WebAPIResponse, error) {
+	apis, err := s.APIs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, version, err = apis.Resolve(api, version); err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]string, len(apiParams)+1)
+	params["runner"] = s.runner
+	for key, value := range apiParams {
+		params[key] = formatParam(value)
+	}
+
+	output, err := s.ssh.ExecuteCommand(ctx, buildAPICommand(api, method, version, params))
+	if err != nil {
+		return nil, fmt.Errorf("synowebapi call failed: %w", err)
+	}
+
+	return parseSynoWebAPIOutput(output)
+}
+
+// APIs returns the APIs provided by the NAS, querying SYNO.API.Info the
+// first time
+func (s *SynoWebAPIClient) APIs(ctx context.Context) (APIDirectory, error) {
+	s.mu.Lock()
+	apis := s.apis
+	s.mu.Unlock()
+
+	if apis != nil {
+		return apis, nil
+	}
+
+	output, err := s.ssh.ExecuteCommand(ctx, buildAPICommand(apiInfo, "query", "1", map[string]string{"query": "ALL"}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Web APIs: synowebapi call failed: %w", err)
+	}
+	resp, err := parseSynoWebAPIOutput(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Web APIs: %w", err)
+	}
+	apis, err = parseAPIDirectory(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Web APIs: %w", err)
+	}
+
+	s.mu.Lock()
+	s.apis = apis
+	s.mu.Unlock()
+	return apis, nil
+}
+
+// buildAPICommand builds a synowebapi command line. Every value is shell
+// quoted and parameters are emitted in key order so the command is
+// deterministic.
+func buildAPICommand(api, method, version string, params map[string]string) string {
+	cmd := shellCommand("synowebapi", "--exec", "api="+api, "method="+method, "version="+version)
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		cmd += " " + ShellQuote(key+"="+params[key])
+	}
+
+	return cmd
+}
+
+// parseSynoWebAPIOutput extracts the JSON response from synowebapi output,
+// which may be preceded by diagnostic log lines
+func parseSynoWebAPIOutput(output string) (*WebAPIResponse, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON response in synowebapi output: %s", strings.TrimSpace(output))
+	}
+
+	var resp WebAPIResponse
+	if err := json.Unmarshal([]byte(output[start:end+1]), &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse synowebapi response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// formatParam converts an API parameter to its wire representation. Slices
+// and maps are JSON encoded, as the VMM APIs expect for vdisks and vnics.
+func formatParam(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}, []map[string]interface{}, []string, map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
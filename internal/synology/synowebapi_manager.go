@@ -0,0 +1,173 @@
+package synology
+
+import "context"
+
+// virshFeatures is what the synowebapi backend borrows from virsh
+type virshFeatures interface {
+	SnapshotManager
+	DomainInspector
+	StatsCollector
+	EventWatcher
+}
+
+// SynoWebAPIManager manages guests through synowebapi and uses virsh over
+// the same SSH connection for what the VMM API does not offer: snapshots,
+// full definitions, detailed statistics and lifecycle events. VMM names the
+// libvirt domain of a guest after its guest ID, so VM names are translated
+// between the two. Updates go through VMM, which owns the guest definition.
+type SynoWebAPIManager struct {
+	*VMMClient
+	virsh virshFeatures
+}
+
+// Ensure SynoWebAPIManager implements VMManager and the optional interfaces
+var (
+	_ VMManager       = (*SynoWebAPIManager)(nil)
+	_ CreatePlanner   = (*SynoWebAPIManager)(nil)
+	_ GuestCreator    = (*SynoWebAPIManager)(nil)
+	_ SnapshotManager = (*SynoWebAPIManager)(nil)
+	_ DomainInspector = (*SynoWebAPIManager)(nil)
+	_ VMUpdater       = (*SynoWebAPIManager)(nil)
+	_ StatsCollector  = (*SynoWebAPIManager)(nil)
+	_ EventWatcher    = (*SynoWebAPIManager)(nil)
+)
+
+// NewSynoWebAPIManager creates a synowebapi backed manager on top of an SSH
+// client
+func NewSynoWebAPIManager(client *Client) *SynoWebAPIManager {
+	return &SynoWebAPIManager{
+		VMMClient: NewVMMClient(NewSynoWebAPIClient(client)),
+		virsh:     client,
+	}
+}
+
+// domainName returns the libvirt domain name of a guest
+func (s *SynoWebAPIManager) domainName(ctx context.Context, vmName string) (string, error) {
+	guest, err := s.getGuest(ctx, vmName)
+	if err != nil {
+		return "", err
+	}
+	if guest.GuestID == "" {
+		return vmName, nil
+	}
+	return guest.GuestID, nil
+}
+
+// guestNames maps the libvirt domain names of all guests to their VM names
+func (s *SynoWebAPIManager) guestNames(ctx context.Context) (map[string]string, error) {
+	guests, err := s.listGuests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(guests))
+	for _, guest := range guests {
+		if guest.GuestID != "" {
+			names[guest.GuestID] = guest.GuestName
+		}
+	}
+	return names, nil
+}
+
+// CreateSnapshot takes a snapshot of a guest with virsh
+func (s *SynoWebAPIManager) CreateSnapshot(ctx context.Context, vmName string, opts SnapshotOptions) error {
+	domain, err := s.domainName(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	return s.virsh.CreateSnapshot(ctx, domain, opts)
+}
+
+// ListSnapshots lists the snapshots of a guest with virsh
+func (s *SynoWebAPIManager) ListSnapshots(ctx context.Context, vmName string) ([]Snapshot, error) {
+	domain, err := s.domainName(ctx, vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := s.virsh.ListSnapshots(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	for i := range snapshots {
+		snapshots[i].VMName = vmName
+	}
+	return snapshots, nil
+}
+
+// RevertSnapshot reverts a guest to a snapshot with virsh
+func (s *SynoWebAPIManager) RevertSnapshot(ctx context.Context, vmName, snapshotName string) error {
+	domain, err := s.domainName(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	return s.virsh.RevertSnapshot(ctx, domain, snapshotName)
+}
+
+// DeleteSnapshot deletes a snapshot of a guest with virsh
+func (s *SynoWebAPIManager) DeleteSnapshot(ctx context.Context, vmName, snapshotName string) error {
+	domain, err := s.domainName(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	return s.virsh.DeleteSnapshot(ctx, domain, snapshotName)
+}
+
+// GetDomain returns the libvirt definition of a guest under its VM name
+func (s *SynoWebAPIManager) GetDomain(ctx context.Context, vmName string) (*Domain, error) {
+	domain, err := s.domainName(ctx, vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := s.virsh.GetDomain(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	d.Name = vmName
+	return d, nil
+}
+
+// CollectStats samples resource usage with virsh and reports it under the
+// VM names. Domains that are not VMM guests keep their libvirt name.
+func (s *SynoWebAPIManager) CollectStats(ctx context.Context) (*Stats, error) {
+	names, err := s.guestNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.virsh.CollectStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, domain := range stats.Domains {
+		if name, ok := names[domain.Name]; ok {
+			stats.Domains[i].Name = name
+		}
+	}
+	return stats, nil
+}
+
+// WatchEvents streams lifecycle events from virsh under the VM names. The
+// guest list is fetched again when an event names an unknown domain, e.g.
+// a guest created after the watch started.
+func (s *SynoWebAPIManager) WatchEvents(ctx context.Context, handle func(Event)) error {
+	names, err := s.guestNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.virsh.WatchEvents(ctx, func(event Event) {
+		name, ok := names[event.VM]
+		if !ok {
+			if refreshed, err := s.guestNames(ctx); err == nil {
+				names = refreshed
+				name, ok = names[event.VM]
+			}
+		}
+		if ok {
+			event.VM = name
+		}
+		handle(event)
+	})
+}
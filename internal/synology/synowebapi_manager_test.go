@@ -0,0 +1,118 @@
+package synology
+
+import (
+	"context"
+	"testing"
+)
+
+// fakeVirsh records the domain names the synowebapi manager passes to virsh
+type fakeVirsh struct {
+	domains []string
+	stats   *Stats
+	events  []Event
+}
+
+func (f *fakeVirsh) CreateSnapshot(ctx context.Context, vmName string, opts SnapshotOptions) error {
+	f.domains = append(f.domains, vmName)
+	return nil
+}
+
+func (f *fakeVirsh) ListSnapshots(ctx context.Context, vmName string) ([]Snapshot, error) {
+	f.domains = append(f.domains, vmName)
+	return []Snapshot{{Name: "before-upgrade", VMName: vmName}}, nil
+}
+
+func (f *fakeVirsh) RevertSnapshot(ctx context.Context, vmName, snapshotName string) error {
+	f.domains = append(f.domains, vmName)
+	return nil
+}
+
+func (f *fakeVirsh) DeleteSnapshot(ctx context.Context, vmName, snapshotName string) error {
+	f.domains = append(f.domains, vmName)
+	return nil
+}
+
+func (f *fakeVirsh) GetDomain(ctx context.Context, vmName string) (*Domain, error) {
+	f.domains = append(f.domains, vmName)
+	return &Domain{Name: vmName}, nil
+}
+
+func (f *fakeVirsh) CollectStats(ctx context.Context) (*Stats, error) {
+	return f.stats, nil
+}
+
+func (f *fakeVirsh) WatchEvents(ctx context.Context, handle func(Event)) error {
+	for _, event := range f.events {
+		handle(event)
+	}
+	return nil
+}
+
+func newTestSynoWebAPIManager(virsh *fakeVirsh) *SynoWebAPIManager {
+	caller := &fakeCaller{responses: map[string]string{
+		apiGuest + "/get":  `{"success": true, "data": {"guest_id": "a1", "guest_name": "web"}}`,
+		apiGuest + "/list": `{"success": true, "data": {"guests": [{"guest_id": "a1", "guest_name": "web"}]}}`,
+	}}
+	return &SynoWebAPIManager{VMMClient: NewVMMClient(caller), virsh: virsh}
+}
+
+func TestSynoWebAPIManager_UsesGuestIDForVirsh(t *testing.T) {
+	virsh := &fakeVirsh{}
+	m := newTestSynoWebAPIManager(virsh)
+	ctx := context.Background()
+
+	if err := m.CreateSnapshot(ctx, "web", SnapshotOptions{Name: "before-upgrade"}); err != nil {
+		t.Fatalf("CreateSnapshot() error = %v", err)
+	}
+	snapshots, err := m.ListSnapshots(ctx, "web")
+	if err != nil {
+		t.Fatalf("ListSnapshots() error = %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].VMName != "web" {
+		t.Errorf("expected the snapshot of web, got %+v", snapshots)
+	}
+	domain, err := m.GetDomain(ctx, "web")
+	if err != nil {
+		t.Fatalf("GetDomain() error = %v", err)
+	}
+	if domain.Name != "web" {
+		t.Errorf("domain name = %q, want web", domain.Name)
+	}
+
+	for i, name := range virsh.domains {
+		if name != "a1" {
+			t.Errorf("call %d went to domain %q, want the guest ID a1", i, name)
+		}
+	}
+}
+
+func TestSynoWebAPIManager_NamesStatsAndEvents(t *testing.T) {
+	virsh := &fakeVirsh{
+		stats: &Stats{Domains: []DomainStats{{Name: "a1"}, {Name: "plain-libvirt"}}},
+		events: []Event{
+			{VM: "a1", Type: EventStarted},
+			{VM: "plain-libvirt", Type: EventStopped},
+		},
+	}
+	m := newTestSynoWebAPIManager(virsh)
+	ctx := context.Background()
+
+	stats, err := m.CollectStats(ctx)
+	if err != nil {
+		t.Fatalf("CollectStats() error = %v", err)
+	}
+	if stats.Domains[0].Name != "web" || stats.Domains[1].Name != "plain-libvirt" {
+		t.Errorf("unexpected domain names: %q, %q", stats.Domains[0].Name, stats.Domains[1].Name)
+	}
+
+	var names []string
+	err = m.WatchEvents(ctx, func(event Event) {
+		names = append(names, event.VM)
+	})
+	if err != nil {
+		t.Fatalf("WatchEvents() error = %v", err)
+	}
+	if len(names) != 2 || names[0] != "web" || names[1] != "plain-libvirt" {
+		t.Errorf("unexpected event VMs: %v", names)
+	}
+}
@@ -1,40 +1,63 @@
 package synology
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
-// parseVirshList parses the output of 'virsh list --all'
+// virshPath is the location of virsh on DSM
+const virshPath = "/usr/local/bin/virsh"
+
+// parseVirshList parses the output of 'virsh list --all':
+//
+//	 Id   Name         State
+//	-----------------------------
+//	 1    test-vm      running
+//	 -    stopped-vm   shut off
+//
+// The Name column is padded to the longest name, so the columns are split at
+// the header offsets to keep names that contain spaces intact.
 func parseVirshList(output string) ([]VM, error) {
 	var vms []VM
 
-	lines := strings.Split(strings.TrimSpace(output), "\n")
+	lines := strings.Split(strings.Trim(output, "\n"), "\n")
 	if len(lines) < 3 {
 		// No VMs found (just header lines)
 		return vms, nil
 	}
 
+	nameCol := strings.Index(lines[0], "Name")
+	stateCol := strings.Index(lines[0], "State")
+
 	// Skip header lines (usually first 2 lines)
-	for i := 2; i < len(lines); i++ {
-		line := strings.TrimSpace(lines[i])
-		if line == "" {
+	for _, line := range lines[2:] {
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
 
-		// Parse line format: " Id   Name   State"
-		// Example: " 1    test-vm    running"
-		// Example: " -    stopped-vm shut off"
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
-			continue
+		var id, name, state string
+		if nameCol > 0 && stateCol > nameCol && len(line) > stateCol {
+			id = strings.TrimSpace(line[:nameCol])
+			name = strings.TrimSpace(line[nameCol:stateCol])
+			state = strings.TrimSpace(line[stateCol:])
+		} else {
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			// Handle multi-word states like "shut off"
+			id, name, state = fields[0], fields[1], strings.Join(fields[2:], " ")
 		}
 
 		vm := VM{
-			Name:   fields[1],
-			Status: strings.Join(fields[2:], " "), // Handle multi-word states like "shut off"
+			Name:   name,
+			Status: ParseVMState(state),
+		}
+		if n, err := strconv.Atoi(id); err == nil {
+			vm.ID = n // "-" for inactive domains
 		}
 
 		vms = append(vms, vm)
@@ -43,35 +66,105 @@ func parseVirshList(output string) ([]VM, error) {
 	return vms, nil
 }
 
-// getVMInfo gets detailed information about a specific VM using virsh
-func (c *Client) getVMInfo(vmName string) (*VM, error) {
-	// Get basic domain info
-	output, err := c.ExecuteCommand(fmt.Sprintf("/usr/local/bin/virsh dominfo %s", vmName))
-	if err != nil {
-		return nil, fmt.Errorf("failed to get VM info: %w", err)
-	}
+// domStatsSeparator separates the list and domstats output in ListVMs
+const domStatsSeparator = "--- domstats ---"
 
-	vm := &VM{Name: vmName}
+// domStats holds the fields of 'virsh domstats' output that ListVMs uses
+type domStats struct {
+	state     int // virDomainState, -1 if not reported
+	vcpus     int
+	memoryKiB uint64
+}
 
-	// Parse dominfo output
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
+// parseDomStats parses 'virsh domstats --state --vcpu --balloon' output,
+// which looks like:
+//
+//	Domain: 'web-01'
+//	  state.state=1
+//	  vcpu.current=2
+//	  balloon.maximum=4194304
+func parseDomStats(output string) map[string]domStats {
+	stats := make(map[string]domStats)
+
+	scanDomStats(output, func(name, key, value string) {
+		s, ok := stats[name]
+		if !ok {
+			s = domStats{state: -1}
+		}
+		switch key {
+		case "state.state":
+			if n, err := strconv.Atoi(value); err == nil {
+				s.state = n
+			}
+		case "vcpu.current":
+			if n, err := strconv.Atoi(value); err == nil {
+				s.vcpus = n
+			}
+		case "balloon.maximum":
+			if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+				s.memoryKiB = n
+			}
+		}
+		stats[name] = s
+	})
+
+	return stats
+}
+
+// scanDomStats calls fn for every key=value line of 'virsh domstats' output
+// with the name of the domain it belongs to. fn is called with an empty key
+// when a domain starts, so domains without stats are seen too.
+func scanDomStats(output string, fn func(name, key, value string)) {
+	var name string
+	for _, line := range strings.Split(output, "\n") {
 		line = strings.TrimSpace(line)
-		if line == "" {
+		if rest, ok := strings.CutPrefix(line, "Domain:"); ok {
+			name = strings.Trim(strings.TrimSpace(rest), "'")
+			fn(name, "", "")
 			continue
 		}
 
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || name == "" {
 			continue
 		}
+		fn(name, key, value)
+	}
+}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
+// applyDomStats fills in the state and resources of vms from stats
+func applyDomStats(vms []VM, stats map[string]domStats) {
+	for i := range vms {
+		s, ok := stats[vms[i].Name]
+		if !ok {
+			continue
+		}
+		if state, ok := libvirtStates[s.state]; ok {
+			vms[i].Status = state
+		}
+		vms[i].CPU = s.vcpus
+		vms[i].Memory = int(s.memoryKiB / 1024)
+	}
+}
+
+// getVMInfo gets detailed information about a specific VM using virsh
+func (c *Client) getVMInfo(ctx context.Context, vmName string) (*VM, error) {
+	// Get basic domain info
+	output, err := c.domainCommand(ctx, "dominfo", vmName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM info: %w", err)
+	}
 
+	vm := &VM{Name: vmName}
+
+	for key, value := range parseDomInfo(output) {
 		switch key {
+		case "Id":
+			if id, err := strconv.Atoi(value); err == nil {
+				vm.ID = id
+			}
 		case "State":
-			vm.Status = value
+			vm.Status = ParseVMState(value)
 		case "CPU(s)":
 			if cpu, err := strconv.Atoi(value); err == nil {
 				vm.CPU = cpu
@@ -87,17 +180,22 @@ func (c *Client) getVMInfo(vmName string) (*VM, error) {
 	}
 
 	// Try to get IP address
-	if ip, err := c.getVMIPAddress(vmName); err == nil {
+	if ip, err := c.getVMIPAddress(ctx, vmName); err == nil {
 		vm.IPAddress = ip
 	}
 
+	// Storage is where the VM's first disk lives on the NAS
+	if domain, err := c.GetDomain(ctx, vmName); err == nil {
+		vm.Storage = domain.primaryDisk()
+	}
+
 	return vm, nil
 }
 
 // getVMIPAddress attempts to get the IP address of a VM
-func (c *Client) getVMIPAddress(vmName string) (string, error) {
+func (c *Client) getVMIPAddress(ctx context.Context, vmName string) (string, error) {
 	// Try to get IP from domifaddr
-	output, err := c.ExecuteCommand(fmt.Sprintf("/usr/local/bin/virsh domifaddr %s", vmName))
+	output, err := c.domainCommand(ctx, "domifaddr", vmName)
 	if err != nil {
 		return "", err
 	}
@@ -115,9 +213,20 @@ func (c *Client) getVMIPAddress(vmName string) (string, error) {
 	return "", fmt.Errorf("no IP address found")
 }
 
-// executeVirshCommand executes a virsh command
-func (c *Client) executeVirshCommand(args string) error {
-	cmd := fmt.Sprintf("/usr/local/bin/virsh %s", args)
-	_, err := c.ExecuteCommand(cmd)
-	return err
-}
\ No newline at end of file
+// executeVirshCommand executes a virsh command, quoting every argument
+func (c *Client) executeVirshCommand(ctx context.Context, args ...string) (string, error) {
+	return c.ExecuteCommand(ctx, virshCommand(args...))
+}
+
+// domainCommand executes a virsh command that acts on the named domain,
+// after validating the name
+func (c *Client) domainCommand(ctx context.Context, command, vmName string, args ...string) (string, error) {
+	if err := ValidateVMName(vmName); err != nil {
+		return "", err
+	}
+	output, err := c.executeVirshCommand(ctx, append([]string{command, vmName}, args...)...)
+	if err != nil {
+		return "", virshError(vmName, err)
+	}
+	return output, nil
+}
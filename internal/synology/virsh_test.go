@@ -0,0 +1,51 @@
+package synology
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVirshListWithDomStats(t *testing.T) {
+	list := ` Id   Name         State
+-----------------------------------
+ 3    web-01       running
+ -    db-01        shut off
+ 7    build agent  paused
+`
+	stats := `Domain: 'web-01'
+  state.state=1
+  state.reason=1
+  balloon.current=2097152
+  balloon.maximum=4194304
+  vcpu.current=2
+  vcpu.maximum=4
+
+Domain: 'db-01'
+  state.state=5
+  state.reason=0
+  balloon.maximum=8388608
+  vcpu.current=4
+`
+
+	vms, err := parseVirshList(list)
+	if err != nil {
+		t.Fatalf("parseVirshList() error = %v", err)
+	}
+	applyDomStats(vms, parseDomStats(stats))
+
+	want := []VM{
+		{ID: 3, Name: "web-01", Status: StateRunning, CPU: 2, Memory: 4096},
+		{Name: "db-01", Status: StateStopped, CPU: 4, Memory: 8192},
+		{ID: 7, Name: "build agent", Status: StatePaused},
+	}
+	if !reflect.DeepEqual(vms, want) {
+		t.Errorf("got %+v\nwant %+v", vms, want)
+	}
+}
+
+func TestParseVirshList_Empty(t *testing.T) {
+	vms, err := parseVirshList(" Id   Name   State\n--------------------\n\n")
+	if err != nil || len(vms) != 0 {
+		t.Errorf("parseVirshList() = %v, %v; want no VMs", vms, err)
+	}
+}
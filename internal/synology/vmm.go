@@ -0,0 +1,338 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// VMM Web API names
+const (
+	apiGuest       = "SYNO.Virtualization.API.Guest"
+	apiGuestAction = "SYNO.Virtualization.API.Guest.Action"
+	apiTemplate    = "SYNO.Virtualization.API.Template"
+)
+
+// APICaller invokes a Synology Web API method. It is implemented by
+// WebAPIClient (HTTPS) and SynoWebAPIClient (synowebapi over SSH).
+type APICaller interface {
+	CallAPI(ctx context.Context, api, method, version string, apiParams map[string]interface{}) (*WebAPIResponse, error)
+}
+
+// Ensure both Web API transports implement APICaller
+var (
+	_ APICaller = (*WebAPIClient)(nil)
+	_ APICaller = (*SynoWebAPIClient)(nil)
+)
+
+// VMMClient manages VMs through the Virtual Machine Manager Web API. Unlike
+// the virsh backend it sees guests by their VMM names and can use templates.
+type VMMClient struct {
+	caller        APICaller
+	pollInterval  time.Duration
+	createTimeout time.Duration
+}
+
+// Ensure VMMClient implements VMManager and the optional interfaces
+var (
+	_ VMManager     = (*VMMClient)(nil)
+	_ CreatePlanner = (*VMMClient)(nil)
+	_ GuestCreator  = (*VMMClient)(nil)
+	_ VMUpdater     = (*VMMClient)(nil)
+)
+
+// NewVMMClient creates a VMM client on top of the given API transport
+func NewVMMClient(caller APICaller) *VMMClient {
+	return &VMMClient{
+		caller:        caller,
+		pollInterval:  2 * time.Second,
+		createTimeout: 10 * time.Minute,
+	}
+}
+
+// Close releases the API transport if it holds a connection
+func (v *VMMClient) Close() error {
+	if closer, ok := v.caller.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// vmmGuest is a guest as returned by SYNO.Virtualization.API.Guest
+type vmmGuest struct {
+	GuestID     string     `json:"guest_id"`
+	GuestName   string     `json:"guest_name"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	StorageID   string     `json:"storage_id"`
+	StorageName string     `json:"storage_name"`
+	VCPUNum     int        `json:"vcpu_num"`
+	VRAMSize    int        `json:"vram_size"` // MB
+	Autorun     int        `json:"autorun"`
+	VDisks      []vmmVDisk `json:"vdisks"`
+	VNICs       []vmmVNIC  `json:"vnics"`
+}
+
+// vmmVDisk is a virtual disk attached to a VMM guest
+type vmmVDisk struct {
+	VDiskID   string `json:"vdisk_id"`
+	VDiskSize int    `json:"vdisk_size"` // MB
+}
+
+// vmmVNIC is a virtual network interface attached to a VMM guest
+type vmmVNIC struct {
+	VNICID      string `json:"vnic_id"`
+	MAC         string `json:"mac"`
+	NetworkID   string `json:"network_id"`
+	NetworkName string `json:"network_name"`
+}
+
+// vmmTemplate is a template as returned by SYNO.Virtualization.API.Template
+type vmmTemplate struct {
+	TemplateName string `json:"template_name"`
+	Description  string `json:"description"`
+	OSType       string `json:"os_type"`
+}
+
+// toVM converts a VMM guest to the common VM representation
+func (g vmmGuest) toVM() VM {
+	autostart := g.Autorun != 0
+	return VM{
+		Name:      g.GuestName,
+		Status:    ParseVMState(g.Status),
+		CPU:       g.VCPUNum,
+		Memory:    g.VRAMSize,
+		Storage:   g.StorageName,
+		Autostart: &autostart,
+	}
+}
+
+// call invokes an API method and returns an error if it did not succeed
+func (v *VMMClient) call(ctx context.Context, api, method string, params map[string]interface{}) (*WebAPIResponse, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	// The transport picks the highest version DSM supports
+	resp, err := v.caller.CallAPI(ctx, api, method, "", params)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, responseError(api, method, resp)
+	}
+
+	return resp, nil
+}
+
+// decodeData decodes the data section of a response into out
+func decodeData(resp *WebAPIResponse, out interface{}) error {
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode response data: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response data: %w", err)
+	}
+	return nil
+}
+
+// ListVMs lists all VMM guests
+func (v *VMMClient) ListVMs(ctx context.Context) ([]VM, error) {
+	guests, err := v.listGuests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vms := make([]VM, 0, len(guests))
+	for _, guest := range guests {
+		vms = append(vms, guest.toVM())
+	}
+
+	return vms, nil
+}
+
+// listGuests fetches the raw VMM guest records
+func (v *VMMClient) listGuests(ctx context.Context) ([]vmmGuest, error) {
+	resp, err := v.call(ctx, apiGuest, "list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	var data struct {
+		Guests []vmmGuest `json:"guests"`
+	}
+	if err := decodeData(resp, &data); err != nil {
+		return nil, err
+	}
+
+	return data.Guests, nil
+}
+
+// StartVM powers on a guest
+func (v *VMMClient) StartVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "poweron", vmName)
+}
+
+// StopVM gracefully shuts down a guest
+func (v *VMMClient) StopVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "shutdown", vmName)
+}
+
+// PowerOffVM forcibly powers off a guest
+func (v *VMMClient) PowerOffVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "poweroff", vmName)
+}
+
+// RestartVM restarts a guest
+func (v *VMMClient) RestartVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "restart", vmName)
+}
+
+// ResetVM hard-resets a guest
+func (v *VMMClient) ResetVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "reset", vmName)
+}
+
+// PauseVM suspends a guest in memory
+func (v *VMMClient) PauseVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "pause", vmName)
+}
+
+// ResumeVM resumes a paused guest
+func (v *VMMClient) ResumeVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "resume", vmName)
+}
+
+// SaveVM saves a guest's memory state to disk and stops it
+func (v *VMMClient) SaveVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "save", vmName)
+}
+
+// RestoreVM starts a guest from its saved state
+func (v *VMMClient) RestoreVM(ctx context.Context, vmName string) error {
+	return v.guestAction(ctx, "restore", vmName)
+}
+
+// guestAction runs a SYNO.Virtualization.API.Guest.Action method on a guest
+func (v *VMMClient) guestAction(ctx context.Context, method, vmName string) error {
+	_, err := v.call(ctx, apiGuestAction, method, map[string]interface{}{
+		"guest_name": vmName,
+	})
+	return err
+}
+
+// GetVMStatus gets a single guest by name
+func (v *VMMClient) GetVMStatus(ctx context.Context, vmName string) (*VM, error) {
+	guest, err := v.getGuest(ctx, vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	vm := guest.toVM()
+	return &vm, nil
+}
+
+// getGuest fetches the raw VMM guest record for a guest name
+func (v *VMMClient) getGuest(ctx context.Context, vmName string) (*vmmGuest, error) {
+	resp, err := v.call(ctx, apiGuest, "get", map[string]interface{}{
+		"guest_name": vmName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM info: %w", err)
+	}
+
+	var guest vmmGuest
+	if err := decodeData(resp, &guest); err != nil {
+		return nil, err
+	}
+
+	return &guest, nil
+}
+
+// UpdateVM changes the vCPUs, memory and autorun of a guest via
+// SYNO.Virtualization.API.Guest set. Like virsh, VMM applies new vCPUs
+// and memory when the guest next starts.
+func (v *VMMClient) UpdateVM(ctx context.Context, vmName string, update VMUpdate) error {
+	if update.CPU < 0 || update.Memory < 0 {
+		return fmt.Errorf("CPU and memory must not be negative")
+	}
+	if update.IsZero() {
+		return nil
+	}
+
+	params := map[string]interface{}{
+		"guest_name": vmName,
+	}
+	if update.CPU > 0 {
+		params["vcpu_num"] = update.CPU
+	}
+	if update.Memory > 0 {
+		params["vram_size"] = update.Memory
+	}
+	if update.Autostart != nil {
+		params["autorun"] = 0
+		if *update.Autostart {
+			params["autorun"] = 1
+		}
+	}
+
+	if _, err := v.call(ctx, apiGuest, "set", params); err != nil {
+		return fmt.Errorf("failed to update VM: %w", err)
+	}
+	return nil
+}
+
+// DeleteVM deletes a guest and its virtual disks
+func (v *VMMClient) DeleteVM(ctx context.Context, vmName string) error {
+	_, err := v.call(ctx, apiGuest, "delete", map[string]interface{}{
+		"guest_name": vmName,
+	})
+	return err
+}
+
+// ListTemplates lists VMM templates
+func (v *VMMClient) ListTemplates(ctx context.Context) ([]Template, error) {
+	resp, err := v.call(ctx, apiTemplate, "list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	var data struct {
+		Templates []vmmTemplate `json:"templates"`
+	}
+	if err := decodeData(resp, &data); err != nil {
+		return nil, err
+	}
+
+	templates := make([]Template, 0, len(data.Templates))
+	for _, t := range data.Templates {
+		templates = append(templates, Template{
+			Name:        t.TemplateName,
+			Description: t.Description,
+			OS:          t.OSType,
+		})
+	}
+
+	return templates, nil
+}
+
+// CreateTemplate creates a template from an existing guest
+func (v *VMMClient) CreateTemplate(ctx context.Context, templateName, vmName string) error {
+	_, err := v.call(ctx, apiTemplate, "create", map[string]interface{}{
+		"template_name": templateName,
+		"source_vm":     vmName,
+	})
+	return err
+}
+
+// DeleteTemplate deletes a template
+func (v *VMMClient) DeleteTemplate(ctx context.Context, templateName string) error {
+	_, err := v.call(ctx, apiTemplate, "delete", map[string]interface{}{
+		"template_name": templateName,
+	})
+	return err
+}
@@ -0,0 +1,242 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// VMM Web API names used for guest creation
+const (
+	apiStorage  = "SYNO.Virtualization.API.Storage"
+	apiTaskInfo = "SYNO.Virtualization.API.Task.Info"
+)
+
+// defaultVDiskSizeGB is the disk size used when neither a size nor an image
+// is given
+const defaultVDiskSizeGB = 20
+
+// VMM vdisk and vnic create types
+const (
+	createTypeNew   = 0 // create an empty disk or a new NIC
+	createTypeImage = 1 // clone the disk from an image
+)
+
+// GuestCreateResult describes a guest created through the VMM API
+type GuestCreateResult struct {
+	GuestID string `json:"guest_id"`
+	Name    string `json:"guest_name"`
+	TaskID  string `json:"task_id,omitempty"`
+}
+
+// vmmStorage is a storage as returned by SYNO.Virtualization.API.Storage
+type vmmStorage struct {
+	StorageID   string `json:"storage_id"`
+	StorageName string `json:"storage_name"`
+}
+
+// vmmTask is the progress of an asynchronous VMM task
+type vmmTask struct {
+	Finish   bool                   `json:"finish"`
+	Progress int                    `json:"progress"`
+	TaskInfo map[string]interface{} `json:"task_info"`
+	Error    *WebAPIError           `json:"error"`
+}
+
+// CreateVM creates a new guest and waits until it exists
+func (v *VMMClient) CreateVM(ctx context.Context, config VMConfig) error {
+	_, err := v.CreateGuest(ctx, config)
+	return err
+}
+
+// PlanCreate returns the SYNO.Virtualization.API.Guest create parameters
+// CreateVM would send
+func (v *VMMClient) PlanCreate(ctx context.Context, config VMConfig) ([]byte, error) {
+	params, err := v.guestCreateParams(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to render create parameters: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// CreateGuest creates a new guest via SYNO.Virtualization.API.Guest create.
+// Creation is asynchronous on DSM, so the returned task is polled until it
+// finishes and the guest can be looked up.
+func (v *VMMClient) CreateGuest(ctx context.Context, config VMConfig) (*GuestCreateResult, error) {
+	params, err := v.guestCreateParams(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.call(ctx, apiGuest, "create", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VM: %w", err)
+	}
+
+	var created GuestCreateResult
+	if err := decodeData(resp, &created); err != nil {
+		return nil, err
+	}
+	created.Name = config.Name
+
+	if created.TaskID != "" {
+		guestID, err := v.waitForTask(ctx, created.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		if guestID != "" {
+			created.GuestID = guestID
+		}
+	}
+
+	if created.GuestID == "" {
+		guest, err := v.waitForGuest(ctx, config.Name)
+		if err != nil {
+			return nil, err
+		}
+		created.GuestID = guest.GuestID
+	}
+
+	return &created, nil
+}
+
+// guestCreateParams maps a VMConfig onto the Guest create parameters
+func (v *VMMClient) guestCreateParams(ctx context.Context, config VMConfig) (map[string]interface{}, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	storageName := config.Storage
+	if storageName == "" {
+		storage, err := v.defaultStorage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		storageName = storage.StorageName
+	}
+
+	vdisk := map[string]interface{}{
+		"create_type": createTypeNew,
+	}
+	switch {
+	case config.Template != "":
+		vdisk["create_type"] = createTypeImage
+		vdisk["image_name"] = config.Template
+		if config.DiskSize > 0 {
+			vdisk["vdisk_size"] = config.DiskSize * 1024
+		}
+	case config.DiskSize > 0:
+		vdisk["vdisk_size"] = config.DiskSize * 1024
+	default:
+		vdisk["vdisk_size"] = defaultVDiskSizeGB * 1024
+	}
+
+	params := map[string]interface{}{
+		"guest_name":   config.Name,
+		"storage_name": storageName,
+		"vcpu_num":     config.CPU,
+		"vram_size":    config.Memory,
+		"vdisks":       []interface{}{vdisk},
+		"autorun":      0,
+	}
+
+	if config.Autorun {
+		params["autorun"] = 1
+	}
+
+	if config.Network != "" {
+		params["vnics"] = []interface{}{
+			map[string]interface{}{
+				"create_type":  createTypeNew,
+				"network_name": config.Network,
+			},
+		}
+	}
+
+	if config.ISO != "" {
+		params["iso_images"] = []string{config.ISO}
+	}
+
+	return params, nil
+}
+
+// defaultStorage returns the first VMM storage on the NAS
+func (v *VMMClient) defaultStorage(ctx context.Context) (*vmmStorage, error) {
+	resp, err := v.call(ctx, apiStorage, "list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VMM storages: %w", err)
+	}
+
+	var data struct {
+		Storages []vmmStorage `json:"storages"`
+	}
+	if err := decodeData(resp, &data); err != nil {
+		return nil, err
+	}
+
+	if len(data.Storages) == 0 {
+		return nil, fmt.Errorf("no VMM storage found; create one in Virtual Machine Manager or pass --storage")
+	}
+
+	return &data.Storages[0], nil
+}
+
+// waitForTask polls an asynchronous task until it finishes and returns the
+// guest ID it reports, if any
+func (v *VMMClient) waitForTask(ctx context.Context, taskID string) (string, error) {
+	deadline := time.Now().Add(v.createTimeout)
+
+	for {
+		resp, err := v.call(ctx, apiTaskInfo, "get", map[string]interface{}{
+			"task_id": taskID,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get create task status: %w", err)
+		}
+
+		var task vmmTask
+		if err := decodeData(resp, &task); err != nil {
+			return "", err
+		}
+
+		if task.Finish {
+			if task.Error != nil && task.Error.Code != 0 {
+				return "", fmt.Errorf("create task failed: %w", &WebAPIError{Code: task.Error.Code, API: apiGuest, Method: "create"})
+			}
+			guestID, _ := task.TaskInfo["guest_id"].(string)
+			return guestID, nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out waiting for create task %s (%d%% done)", taskID, task.Progress)
+		}
+		if err := sleepContext(ctx, v.pollInterval); err != nil {
+			return "", err
+		}
+	}
+}
+
+// waitForGuest polls until a guest with the given name exists
+func (v *VMMClient) waitForGuest(ctx context.Context, vmName string) (*vmmGuest, error) {
+	deadline := time.Now().Add(v.createTimeout)
+
+	for {
+		guest, err := v.getGuest(ctx, vmName)
+		if err == nil && guest.GuestID != "" {
+			return guest, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for VM %s to appear: %v", vmName, err)
+		}
+		if err := sleepContext(ctx, v.pollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
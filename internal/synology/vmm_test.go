@@ -0,0 +1,271 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeCaller is an APICaller that returns canned responses per API method
+type fakeCaller struct {
+	responses map[string]string
+	calls     []fakeCall
+}
+
+type fakeCall struct {
+	api    string
+	method string
+	params map[string]interface{}
+}
+
+func (f *fakeCaller) CallAPI(ctx context.Context, api, method, version string, apiParams map[string]interface{}) (*WebAPIResponse, error) {
+	f.calls = append(f.calls, fakeCall{api: api, method: method, params: apiParams})
+
+	body, ok := f.responses[api+"/"+method]
+	if !ok {
+		body = `{"success": true, "data": {}}`
+	}
+
+	var resp WebAPIResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func TestVMMClient_ListVMs(t *testing.T) {
+	caller := &fakeCaller{responses: map[string]string{
+		apiGuest + "/list": `{"success": true, "data": {"guests": [
+			{"guest_id": "a1", "guest_name": "web", "status": "running", "vcpu_num": 2, "vram_size": 4096, "storage_name": "volume1", "autorun": 1},
+			{"guest_id": "b2", "guest_name": "db", "status": "shutdown", "vcpu_num": 4, "vram_size": 8192, "storage_name": "volume2"}
+		]}}`,
+	}}
+
+	vms, err := NewVMMClient(caller).ListVMs(context.Background())
+	if err != nil {
+		t.Fatalf("ListVMs() error = %v", err)
+	}
+
+	if len(vms) != 2 {
+		t.Fatalf("expected 2 VMs, got %d", len(vms))
+	}
+	if vms[0].Name != "web" || vms[0].CPU != 2 || vms[0].Memory != 4096 || vms[0].Storage != "volume1" {
+		t.Errorf("unexpected first VM: %+v", vms[0])
+	}
+	if vms[1].Status != StateStopped {
+		t.Errorf("expected VMM status shutdown to be normalised to stopped, got %s", vms[1].Status)
+	}
+	if vms[0].Autostart == nil || !*vms[0].Autostart || vms[1].Autostart == nil || *vms[1].Autostart {
+		t.Errorf("expected autorun to be reported as autostart, got %v and %v", vms[0].Autostart, vms[1].Autostart)
+	}
+}
+
+func TestVMMClient_UpdateVM(t *testing.T) {
+	caller := &fakeCaller{}
+	autostart := false
+
+	err := NewVMMClient(caller).UpdateVM(context.Background(), "web", VMUpdate{CPU: 4, Autostart: &autostart})
+	if err != nil {
+		t.Fatalf("UpdateVM() error = %v", err)
+	}
+
+	if len(caller.calls) != 1 || caller.calls[0].api != apiGuest || caller.calls[0].method != "set" {
+		t.Fatalf("expected a single %s set call, got %+v", apiGuest, caller.calls)
+	}
+	params := caller.calls[0].params
+	if params["guest_name"] != "web" || params["vcpu_num"] != 4 || params["autorun"] != 0 {
+		t.Errorf("unexpected params %v", params)
+	}
+	if _, ok := params["vram_size"]; ok {
+		t.Errorf("expected memory to be left alone, got %v", params["vram_size"])
+	}
+}
+
+func TestVMMClient_GuestActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		action func(*VMMClient) error
+		method string
+	}{
+		{"start", func(v *VMMClient) error { return v.StartVM(context.Background(), "web") }, "poweron"},
+		{"stop", func(v *VMMClient) error { return v.StopVM(context.Background(), "web") }, "shutdown"},
+		{"restart", func(v *VMMClient) error { return v.RestartVM(context.Background(), "web") }, "restart"},
+		{"poweroff", func(v *VMMClient) error { return v.PowerOffVM(context.Background(), "web") }, "poweroff"},
+		{"reset", func(v *VMMClient) error { return v.ResetVM(context.Background(), "web") }, "reset"},
+		{"pause", func(v *VMMClient) error { return v.PauseVM(context.Background(), "web") }, "pause"},
+		{"resume", func(v *VMMClient) error { return v.ResumeVM(context.Background(), "web") }, "resume"},
+		{"save", func(v *VMMClient) error { return v.SaveVM(context.Background(), "web") }, "save"},
+		{"restore", func(v *VMMClient) error { return v.RestoreVM(context.Background(), "web") }, "restore"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &fakeCaller{}
+			if err := tt.action(NewVMMClient(caller)); err != nil {
+				t.Fatalf("action error = %v", err)
+			}
+
+			if len(caller.calls) != 1 {
+				t.Fatalf("expected 1 API call, got %d", len(caller.calls))
+			}
+			call := caller.calls[0]
+			if call.api != apiGuestAction || call.method != tt.method {
+				t.Errorf("expected %s %s, got %s %s", apiGuestAction, tt.method, call.api, call.method)
+			}
+			if call.params["guest_name"] != "web" {
+				t.Errorf("expected guest_name web, got %v", call.params["guest_name"])
+			}
+		})
+	}
+}
+
+func TestVMMClient_Failure(t *testing.T) {
+	caller := &fakeCaller{responses: map[string]string{
+		apiGuest + "/get":           `{"success": false, "error": {"code": 401}}`,
+		apiGuestAction + "/poweron": `{"success": false, "error": {"code": 705}}`,
+	}}
+	v := NewVMMClient(caller)
+
+	// DSM reports a missing guest as a bad parameter
+	if _, err := v.GetVMStatus(context.Background(), "missing"); !errors.Is(err, ErrGuestNotFound) {
+		t.Errorf("GetVMStatus() of a missing guest error = %v, want ErrGuestNotFound", err)
+	}
+	if len(caller.calls) != 1 {
+		t.Errorf("made %d calls for a missing guest, want 1", len(caller.calls))
+	}
+
+	err := v.StartVM(context.Background(), "web")
+	if !errors.Is(err, ErrGuestRunning) {
+		t.Errorf("StartVM() of a running guest error = %v, want ErrGuestRunning", err)
+	}
+	var apiErr *WebAPIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 705 || apiErr.Method != "poweron" {
+		t.Errorf("StartVM() error = %#v, want the WebAPIError of the call", err)
+	}
+}
+
+func TestParseSynoWebAPIOutput(t *testing.T) {
+	output := "[Line 254] Exec WebAPI: api=SYNO.Virtualization.API.Guest\n" +
+		`{"data": {"guests": []}, "httpd_restart": false, "success": true}` + "\n"
+
+	resp, err := parseSynoWebAPIOutput(output)
+	if err != nil {
+		t.Fatalf("parseSynoWebAPIOutput() error = %v", err)
+	}
+	if !resp.Success {
+		t.Error("expected success response")
+	}
+
+	if _, err := parseSynoWebAPIOutput("synowebapi: command not found"); err == nil {
+		t.Error("expected error for output without JSON")
+	}
+}
+
+func TestParseBackend(t *testing.T) {
+	for _, name := range []string{"virsh", "synowebapi", "webapi", "auto"} {
+		if b, err := ParseBackend(name); err != nil || string(b) != name {
+			t.Errorf("ParseBackend(%q) = %q, %v", name, b, err)
+		}
+	}
+
+	if b, err := ParseBackend(""); err != nil || b != BackendAuto {
+		t.Errorf("ParseBackend(\"\") = %q, %v; want auto", b, err)
+	}
+
+	if _, err := ParseBackend("libvirt"); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
+
+func TestVMMClient_CreateGuest(t *testing.T) {
+	caller := &fakeCaller{responses: map[string]string{
+		apiStorage + "/list": `{"success": true, "data": {"storages": [{"storage_id": "s1", "storage_name": "vmstore"}]}}`,
+		apiGuest + "/create": `{"success": true, "data": {"task_id": "task-1"}}`,
+		apiTaskInfo + "/get": `{"success": true, "data": {"finish": true, "progress": 100, "task_info": {"guest_id": "g-123"}}}`,
+	}}
+
+	vmm := NewVMMClient(caller)
+	vmm.pollInterval = 0
+
+	result, err := vmm.CreateGuest(context.Background(), VMConfig{
+		Name:     "web",
+		CPU:      2,
+		Memory:   2048,
+		Network:  "VM Network",
+		DiskSize: 40,
+		ISO:      "ubuntu.iso",
+		Autorun:  true,
+	})
+	if err != nil {
+		t.Fatalf("CreateGuest() error = %v", err)
+	}
+
+	if result.GuestID != "g-123" || result.Name != "web" || result.TaskID != "task-1" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	var create *fakeCall
+	for i := range caller.calls {
+		if caller.calls[i].method == "create" {
+			create = &caller.calls[i]
+		}
+	}
+	if create == nil {
+		t.Fatal("expected a Guest create call")
+	}
+
+	params := create.params
+	if params["storage_name"] != "vmstore" {
+		t.Errorf("expected default storage vmstore, got %v", params["storage_name"])
+	}
+	if params["vcpu_num"] != 2 || params["vram_size"] != 2048 || params["autorun"] != 1 {
+		t.Errorf("unexpected resource params: %v", params)
+	}
+	if got := formatParam(params["vdisks"]); got != `[{"create_type":0,"vdisk_size":40960}]` {
+		t.Errorf("unexpected vdisks: %s", got)
+	}
+	if got := formatParam(params["vnics"]); got != `[{"create_type":0,"network_name":"VM Network"}]` {
+		t.Errorf("unexpected vnics: %s", got)
+	}
+	if got := formatParam(params["iso_images"]); got != `["ubuntu.iso"]` {
+		t.Errorf("unexpected iso_images: %s", got)
+	}
+}
+
+func TestVMMClient_CreateGuestWaitsForGuest(t *testing.T) {
+	caller := &fakeCaller{responses: map[string]string{
+		apiGuest + "/create": `{"success": true, "data": {}}`,
+		apiGuest + "/get":    `{"success": true, "data": {"guest_id": "g-9", "guest_name": "db"}}`,
+	}}
+
+	vmm := NewVMMClient(caller)
+	vmm.pollInterval = 0
+
+	result, err := vmm.CreateGuest(context.Background(), VMConfig{Name: "db", CPU: 1, Memory: 1024, Storage: "vmstore", Template: "debian-12"})
+	if err != nil {
+		t.Fatalf("CreateGuest() error = %v", err)
+	}
+	if result.GuestID != "g-9" {
+		t.Errorf("expected guest ID g-9, got %s", result.GuestID)
+	}
+}
+
+func TestVMMClient_CreateGuestHonoursContext(t *testing.T) {
+	caller := &fakeCaller{responses: map[string]string{
+		apiGuest + "/create": `{"success": true, "data": {"task_id": "task-1"}}`,
+		apiTaskInfo + "/get": `{"success": true, "data": {"finish": false, "progress": 10}}`,
+	}}
+
+	vmm := NewVMMClient(caller)
+	vmm.pollInterval = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := vmm.CreateGuest(ctx, VMConfig{Name: "slow", CPU: 1, Memory: 512, Storage: "vmstore"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package synology
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WaitForState polls the VM every interval until it reaches state and
+// returns the last status seen. If ctx is done first, the returned error
+// wraps ctx.Err().
+func WaitForState(ctx context.Context, m VMManager, vmName string, state VMState, interval time.Duration) (*VM, error) {
+	for {
+		vm, err := m.GetVMStatus(ctx, vmName)
+		if err != nil {
+			return nil, err
+		}
+		if vm.Status == state {
+			return vm, nil
+		}
+
+		if err := sleepContext(ctx, interval); err != nil {
+			return vm, fmt.Errorf("VM %s did not reach state %s (last state: %s): %w", vmName, state, vm.Status, err)
+		}
+	}
+}
+
+// sleepContext waits for d or until ctx is cancelled, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,68 @@
+package synology
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statusSequence is a VMManager whose VM goes through states, staying in
+// the last one
+type statusSequence struct {
+	VMManager
+	states []VMState
+	polls  int
+}
+
+func (s *statusSequence) GetVMStatus(ctx context.Context, vmName string) (*VM, error) {
+	state := s.states[len(s.states)-1]
+	if s.polls < len(s.states) {
+		state = s.states[s.polls]
+	}
+	s.polls++
+	return &VM{Name: vmName, Status: state}, nil
+}
+
+func TestWaitForState(t *testing.T) {
+	m := &statusSequence{states: []VMState{StateRunning, StateRunning, StateStopped}}
+
+	vm, err := WaitForState(context.Background(), m, "web", StateStopped, time.Millisecond)
+	if err != nil || vm.Status != StateStopped {
+		t.Fatalf("WaitForState() = %+v, %v", vm, err)
+	}
+	if m.polls != 3 {
+		t.Errorf("polled %d times, want 3", m.polls)
+	}
+}
+
+func TestWaitForStateTimeout(t *testing.T) {
+	m := &statusSequence{states: []VMState{StateRunning}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	vm, err := WaitForState(ctx, m, "web", StateStopped, time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForState() error = %v, want it to wrap DeadlineExceeded", err)
+	}
+	if vm == nil || vm.Status != StateRunning || !strings.Contains(err.Error(), "last state: running") {
+		t.Errorf("WaitForState() = %+v, %v; want the last status seen", vm, err)
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	if err := sleepContext(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("sleepContext() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := sleepContext(ctx, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("sleepContext() of a cancelled context error = %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("sleepContext() did not return when the context was cancelled")
+	}
+}
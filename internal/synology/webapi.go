@@ -1,25 +1,48 @@
 package synology
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
-	"strconv"
+	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// uploadResponseTimeout bounds how long DSM may take to answer once an
+// upload has been sent
+const uploadResponseTimeout = 5 * time.Minute
+
 // WebAPIClient handles HTTP communication with Synology Web API
 type WebAPIClient struct {
 	baseURL    string
 	httpClient *http.Client
 	sessionID  string
+	synoToken  string
+	host       string
 	username   string
 	password   string
+	twoFactor  TwoFactor
+
+	// uploadClient has no total timeout, which large uploads would exceed
+	uploadClient *http.Client
+
+	passwordSource func(ctx context.Context) (string, error)
+	sessions       *SessionCache
+	apis           APIDirectory
+
+	// mu guards sessionID, synoToken and apis, which concurrent calls
+	// share; loginMu makes concurrent calls wait for a single login
+	mu      sync.Mutex
+	loginMu sync.Mutex
 }
 
 // NewWebAPIClient creates a new Web API client
@@ -36,11 +59,18 @@ func NewWebAPIClient(host, username, password string) *WebAPIClient {
 		Timeout:   30 * time.Second,
 	}
 
+	// Uploads are bounded by their context and by how long DSM takes to
+	// answer instead
+	uploadTransport := tr.Clone()
+	uploadTransport.ResponseHeaderTimeout = uploadResponseTimeout
+
 	return &WebAPIClient{
-		baseURL:    baseURL,
-		httpClient: httpClient,
-		username:   username,
-		password:   password,
+		baseURL:      baseURL,
+		httpClient:   httpClient,
+		uploadClient: &http.Client{Transport: uploadTransport},
+		host:         host,
+		username:     username,
+		password:     password,
 	}
 }
 
@@ -51,105 +81,420 @@ type WebAPIResponse struct {
 	Error   *WebAPIError           `json:"error,omitempty"`
 }
 
-// WebAPIError represents a Web API error
-type WebAPIError struct {
-	Code int `json:"code"`
+// SetTwoFactor configures how 2-step verification is answered at login
+func (w *WebAPIClient) SetTwoFactor(tf TwoFactor) {
+	w.twoFactor = tf
 }
 
-// Login authenticates with the Synology Web API and obtains a session
-func (w *WebAPIClient) Login() error {
+// SetPasswordSource makes the client look up its password only when it
+// has to log in, for clients created without one
+func (w *WebAPIClient) SetPasswordSource(source func(ctx context.Context) (string, error)) {
+	w.passwordSource = source
+}
+
+// SetSessionCache makes the client save its session in c and start from the
+// session cached there, if it belongs to the same account. The cached
+// session is only checked by the first API call, which logs in again if
+// DSM rejects it.
+func (w *WebAPIClient) SetSessionCache(c *SessionCache) error {
+	w.sessions = c
+	s, err := c.Load()
+	if err != nil {
+		return err
+	}
+	if s != nil && s.Account == w.account() {
+		w.mu.Lock()
+		w.sessionID = s.SID
+		w.synoToken = s.SynoToken
+		w.apis = s.APIs
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// APIs returns the APIs discovered on the NAS, querying SYNO.API.Info if
+// that has not been done yet
+func (w *WebAPIClient) APIs(ctx context.Context) (APIDirectory, error) {
+	w.mu.Lock()
+	apis := w.apis
+	w.mu.Unlock()
+
+	if apis != nil {
+		return apis, nil
+	}
+	return w.discover(ctx)
+}
+
+// discover queries SYNO.API.Info for the paths and versions of the APIs
+// syno-vm uses
+func (w *WebAPIClient) discover(ctx context.Context) (APIDirectory, error) {
 	params := url.Values{}
-	params.Set("api", "SYNO.API.Auth")
-	params.Set("version", "3")
+	params.Set("api", apiInfo)
+	params.Set("version", "1")
+	params.Set("method", "query")
+	params.Set("query", "ALL")
+
+	resp, err := w.makeRequest(ctx, http.MethodGet, "/webapi/"+apiInfoPath, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Web APIs: %w", err)
+	}
+	var infoResp WebAPIResponse
+	if err := json.Unmarshal(resp, &infoResp); err != nil {
+		return nil, fmt.Errorf("failed to parse %s response: %w", apiInfo, err)
+	}
+	apis, err := parseAPIDirectory(&infoResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover Web APIs: %w", err)
+	}
+
+	w.mu.Lock()
+	w.apis = apis
+	w.mu.Unlock()
+	return apis, nil
+}
+
+// HasSession reports whether the client holds a session, possibly a cached
+// one that has not been checked yet
+func (w *WebAPIClient) HasSession() bool {
+	sid, _ := w.session()
+	return sid != ""
+}
+
+// session returns the session ID and SynoToken the client holds
+func (w *WebAPIClient) session() (string, string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sessionID, w.synoToken
+}
+
+// account names the user on this NAS
+func (w *WebAPIClient) account() string {
+	return w.username + "@" + w.host
+}
+
+// Login authenticates with the Synology Web API and obtains a session. If
+// DSM asks for a 2-step verification code, it is taken from the TwoFactor
+// configuration and the device token DSM returns is remembered, so later
+// logins from this device need no code.
+func (w *WebAPIClient) Login(ctx context.Context) error {
+	w.loginMu.Lock()
+	defer w.loginMu.Unlock()
+	return w.login(ctx)
+}
+
+// login implements Login; the caller holds loginMu
+func (w *WebAPIClient) login(ctx context.Context) error {
+	account := w.account()
+	devices := w.twoFactor.Devices
+
+	// APIs may have been installed or upgraded since the last login
+	apis, err := w.discover(ctx)
+	if err != nil {
+		return err
+	}
+	path, version, err := apis.Resolve(apiAuth, "")
+	if err != nil {
+		return err
+	}
+
+	password := w.password
+	if password == "" && w.passwordSource != nil {
+		p, err := w.passwordSource(ctx)
+		if err != nil {
+			return err
+		}
+		password = p
+	}
+
+	params := url.Values{}
+	params.Set("api", apiAuth)
+	params.Set("version", version)
 	params.Set("method", "login")
 	params.Set("account", w.username)
-	params.Set("passwd", w.password)
+	params.Set("passwd", password)
 	params.Set("session", "VMM")
 	params.Set("format", "cookie")
+	params.Set("enable_syno_token", "yes")
+	if devices != nil {
+		if token := devices.Get(account); token != "" {
+			params.Set("device_id", token)
+			params.Set("device_name", w.twoFactor.DeviceName)
+		}
+	}
 
-	resp, err := w.makeRequest("GET", "/webapi/auth.cgi", params, nil)
+	authResp, err := w.authenticate(ctx, path, params)
 	if err != nil {
-		return fmt.Errorf("login request failed: %w", err)
+		return err
 	}
 
-	var authResp WebAPIResponse
-	if err := json.Unmarshal(resp, &authResp); err != nil {
-		return fmt.Errorf("failed to parse login response: %w", err)
+	if code := authErrorCode(authResp); code == errCodeOTPRequired {
+		otp, err := w.twoFactor.code(ctx)
+		if err != nil {
+			return fmt.Errorf("2-step verification required: %w", err)
+		}
+		params.Del("device_id")
+		params.Set("otp_code", otp)
+		if devices != nil {
+			params.Set("enable_device_token", "yes")
+			params.Set("device_name", w.twoFactor.DeviceName)
+		}
+		if authResp, err = w.authenticate(ctx, path, params); err != nil {
+			return err
+		}
 	}
 
 	if !authResp.Success {
-		code := 0
-		if authResp.Error != nil {
-			code = authResp.Error.Code
+		err := responseError(apiAuth, "login", authResp)
+		if errors.Is(err, ErrOTPEnforced) {
+			return fmt.Errorf("%w; set it up for %s in DSM first", err, w.username)
 		}
-		return fmt.Errorf("login failed with error code %d", code)
+		return err
 	}
 
 	// Extract session ID from response data
+	var sid, synoToken string
 	if authResp.Data != nil {
-		if sid, ok := authResp.Data["sid"].(string); ok {
-			w.sessionID = sid
+		sid, _ = authResp.Data["sid"].(string)
+		synoToken, _ = authResp.Data["synotoken"].(string)
+		if did, ok := authResp.Data["did"].(string); ok && did != "" && devices != nil {
+			if err := devices.Set(account, did); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save device token: %v\n", err)
+			}
+		}
+	}
+
+	w.mu.Lock()
+	if sid != "" {
+		w.sessionID = sid
+	}
+	w.synoToken = synoToken
+	sid = w.sessionID
+	w.mu.Unlock()
+
+	if w.sessions != nil && sid != "" {
+		session := Session{Account: account, SID: sid, SynoToken: synoToken, APIs: apis, Created: time.Now()}
+		if err := w.sessions.Save(session); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to cache session: %v\n", err)
 		}
 	}
 
 	return nil
 }
 
+// EnsureLogin logs in unless the client already holds a session
+func (w *WebAPIClient) EnsureLogin(ctx context.Context) error {
+	w.loginMu.Lock()
+	defer w.loginMu.Unlock()
+
+	if w.HasSession() {
+		return nil
+	}
+	return w.login(ctx)
+}
+
+// relogin replaces the session stale after DSM expired it. Concurrent calls
+// that saw the same session expire share a single new login.
+func (w *WebAPIClient) relogin(ctx context.Context, stale string) error {
+	w.loginMu.Lock()
+	defer w.loginMu.Unlock()
+
+	if sid, _ := w.session(); sid != "" && sid != stale {
+		return nil
+	}
+	w.forgetSession()
+	return w.login(ctx)
+}
+
+// Refresh makes sure the client holds a session DSM accepts. A cached
+// session that is still valid is kept, so no new session or audit entry is
+// created; one DSM rejects is logged out and replaced. It reports whether
+// the session was kept.
+func (w *WebAPIClient) Refresh(ctx context.Context) (bool, error) {
+	if w.HasSession() {
+		valid, err := w.sessionValid(ctx)
+		if err != nil {
+			return false, err
+		}
+		if valid {
+			return true, nil
+		}
+		// DSM may still count the old session against the account
+		_ = w.Logout(ctx)
+	}
+	return false, w.Login(ctx)
+}
+
+// sessionValid asks DSM whether it accepts the client's session, without
+// logging in again as CallAPI would
+func (w *WebAPIClient) sessionValid(ctx context.Context) (bool, error) {
+	apis, err := w.APIs(ctx)
+	if err != nil {
+		return false, err
+	}
+	path, version, err := apis.Resolve(apiGuest, "")
+	if err != nil {
+		return false, err
+	}
+
+	sid, _ := w.session()
+	params := url.Values{}
+	params.Set("api", apiGuest)
+	params.Set("method", "list")
+	params.Set("version", version)
+	params.Set("_sid", sid)
+	resp, err := w.makeRequest(ctx, http.MethodPost, "/webapi/"+path, params)
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+
+	var apiResp WebAPIResponse
+	if err := json.Unmarshal(resp, &apiResp); err != nil {
+		return false, fmt.Errorf("failed to parse API response: %w", err)
+	}
+	if apiResp.Success {
+		return true, nil
+	}
+	if apiResp.Error != nil && sessionExpired(apiResp.Error.Code) {
+		return false, nil
+	}
+	return false, responseError(apiGuest, "list", &apiResp)
+}
+
+// authenticate sends a login request to the SYNO.API.Auth path
+func (w *WebAPIClient) authenticate(ctx context.Context, path string, params url.Values) (*WebAPIResponse, error) {
+	resp, err := w.makeRequest(ctx, http.MethodPost, "/webapi/"+path, params)
+	if err != nil {
+		return nil, fmt.Errorf("login request failed: %w", err)
+	}
+
+	var authResp WebAPIResponse
+	if err := json.Unmarshal(resp, &authResp); err != nil {
+		return nil, fmt.Errorf("failed to parse login response: %w", err)
+	}
+	return &authResp, nil
+}
+
+// authErrorCode returns the error code of a failed response, 0 otherwise
+func authErrorCode(resp *WebAPIResponse) int {
+	if resp.Success || resp.Error == nil {
+		return 0
+	}
+	return resp.Error.Code
+}
+
 // Logout terminates the current session
-func (w *WebAPIClient) Logout() error {
-	if w.sessionID == "" {
+func (w *WebAPIClient) Logout(ctx context.Context) error {
+	sid, _ := w.session()
+	if sid == "" {
 		return nil // Already logged out
 	}
 
+	apis, err := w.APIs(ctx)
+	if err != nil {
+		w.forgetSession()
+		return err
+	}
+	path, version, err := apis.Resolve(apiAuth, "")
+	if err != nil {
+		w.forgetSession()
+		return err
+	}
+
 	params := url.Values{}
-	params.Set("api", "SYNO.API.Auth")
-	params.Set("version", "3")
+	params.Set("api", apiAuth)
+	params.Set("version", version)
 	params.Set("method", "logout")
 	params.Set("session", "VMM")
-	params.Set("_sid", w.sessionID)
+	params.Set("_sid", sid)
 
-	_, err := w.makeRequest("GET", "/webapi/auth.cgi", params, nil)
-	w.sessionID = "" // Clear session regardless of result
+	_, err = w.makeRequest(ctx, http.MethodPost, "/webapi/"+path, params)
+	w.forgetSession() // Clear session regardless of result
 
 	return err
 }
 
-// CallAPI makes an authenticated API call
-func (w *WebAPIClient) CallAPI(api, method, version string, apiParams map[string]interface{}) (*WebAPIResponse, error) {
-	if w.sessionID == "" {
-		if err := w.Login(); err != nil {
-			return nil, fmt.Errorf("authentication failed: %w", err)
+// forgetSession drops the session held by the client and its cached copy
+func (w *WebAPIClient) forgetSession() {
+	w.mu.Lock()
+	w.sessionID = ""
+	w.synoToken = ""
+	w.mu.Unlock()
+
+	if w.sessions != nil {
+		if err := w.sessions.Clear(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
+
+// CallAPI makes an authenticated API call, sending its parameters as a form
+// body. The path comes from SYNO.API.Info and an empty version selects the
+// highest one DSM supports.
+func (w *WebAPIClient) CallAPI(ctx context.Context, api, method, version string, apiParams map[string]interface{}) (*WebAPIResponse, error) {
+	return w.call(ctx, api, method, version, apiParams, func(endpoint string, params url.Values) ([]byte, error) {
+		return w.makeRequest(ctx, http.MethodPost, endpoint, params)
+	})
+}
+
+// Upload is a file sent with a Web API call
+type Upload struct {
+	// Field is the form field DSM expects the file in, usually "file"
+	Field string
+	// Name is the file name sent to DSM
+	Name    string
+	Content io.Reader
+}
+
+// Upload makes an authenticated API call that sends file as a multipart
+// upload. If DSM expired the session, the upload is retried after logging
+// in again only if file.Content can seek back to its start.
+func (w *WebAPIClient) Upload(ctx context.Context, api, method, version string, apiParams map[string]interface{}, file Upload) (*WebAPIResponse, error) {
+	sent := false
+	return w.call(ctx, api, method, version, apiParams, func(endpoint string, params url.Values) ([]byte, error) {
+		if sent {
+			seeker, ok := file.Content.(io.Seeker)
+			if !ok {
+				return nil, fmt.Errorf("cannot upload %s again: %w", file.Name, ErrSessionExpired)
+			}
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("failed to rewind %s: %w", file.Name, err)
+			}
 		}
+		sent = true
+		return w.upload(ctx, endpoint, params, file)
+	})
+}
+
+// call makes an authenticated API call with send, logging in first if
+// needed and once more if DSM expired the session
+func (w *WebAPIClient) call(ctx context.Context, api, method, version string, apiParams map[string]interface{}, send func(endpoint string, params url.Values) ([]byte, error)) (*WebAPIResponse, error) {
+	if err := w.EnsureLogin(ctx); err != nil {
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+	apis, err := w.APIs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	path, version, err := apis.Resolve(api, version)
+	if err != nil {
+		return nil, err
 	}
 
 	params := url.Values{}
 	params.Set("api", api)
 	params.Set("method", method)
 	params.Set("version", version)
-	params.Set("_sid", w.sessionID)
+	sid, _ := w.session()
+	params.Set("_sid", sid)
 
 	// Add API-specific parameters
 	for key, value := range apiParams {
-		switch v := value.(type) {
-		case string:
-			params.Set(key, v)
-		case int:
-			params.Set(key, strconv.Itoa(v))
-		case bool:
-			params.Set(key, strconv.FormatBool(v))
-		default:
-			params.Set(key, fmt.Sprintf("%v", v))
-		}
+		params.Set(key, formatParam(value))
 	}
 
-	// Determine the endpoint based on the API
-	endpoint := "/webapi/entry.cgi"
-	if strings.Contains(api, "Virtualization") {
-		// VMM APIs might use a different endpoint
-		endpoint = "/webapi/entry.cgi"
-	}
+	endpoint := "/webapi/" + path
 
-	resp, err := w.makeRequest("GET", endpoint, params, nil)
+	resp, err := send(endpoint, params)
 	if err != nil {
 		return nil, fmt.Errorf("API call failed: %w", err)
 	}
@@ -160,20 +505,21 @@ func (w *WebAPIClient) CallAPI(api, method, version string, apiParams map[string
 	}
 
 	// Handle session expiration
-	if !apiResp.Success && apiResp.Error != nil && apiResp.Error.Code == 105 {
+	if !apiResp.Success && apiResp.Error != nil && sessionExpired(apiResp.Error.Code) {
 		// Session expired, try to re-login
-		w.sessionID = ""
-		if err := w.Login(); err != nil {
+		if err := w.relogin(ctx, sid); err != nil {
 			return nil, fmt.Errorf("re-authentication failed: %w", err)
 		}
 
 		// Retry the API call with new session
-		params.Set("_sid", w.sessionID)
-		resp, err = w.makeRequest("GET", endpoint, params, nil)
+		sid, _ = w.session()
+		params.Set("_sid", sid)
+		resp, err = send(endpoint, params)
 		if err != nil {
 			return nil, fmt.Errorf("API call retry failed: %w", err)
 		}
 
+		apiResp = WebAPIResponse{}
 		if err := json.Unmarshal(resp, &apiResp); err != nil {
 			return nil, fmt.Errorf("failed to parse retry response: %w", err)
 		}
@@ -182,34 +528,95 @@ func (w *WebAPIClient) CallAPI(api, method, version string, apiParams map[string
 	return &apiResp, nil
 }
 
-// makeRequest performs an HTTP request
-func (w *WebAPIClient) makeRequest(method, path string, params url.Values, body []byte) ([]byte, error) {
-	var req *http.Request
-	var err error
+// sessionExpired reports whether an error code means the session is no
+// longer valid. DSM also answers errCodeNoPermission for sessions it no
+// longer knows, so that code is retried once too.
+func sessionExpired(code int) bool {
+	return code == errCodeNoPermission || errors.Is(lookupCode("", "", code).err, ErrSessionExpired)
+}
 
+// makeRequest performs an HTTP request. GET requests carry params in the
+// query string; other methods send them as a form body, which keeps
+// passwords and session IDs out of URLs and server logs.
+func (w *WebAPIClient) makeRequest(ctx context.Context, method, path string, params url.Values) ([]byte, error) {
 	fullURL := w.baseURL + path
 
-	if method == "GET" && params != nil {
-		fullURL += "?" + params.Encode()
-		req, err = http.NewRequest(method, fullURL, nil)
-	} else {
-		var bodyReader io.Reader
-		if body != nil {
-			bodyReader = bytes.NewReader(body)
-		} else if params != nil {
-			bodyReader = strings.NewReader(params.Encode())
-			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var body io.Reader
+	if method == http.MethodGet {
+		if len(params) > 0 {
+			fullURL += "?" + params.Encode()
 		}
-		req, err = http.NewRequest(method, fullURL, bodyReader)
+	} else {
+		body = strings.NewReader(params.Encode())
 	}
 
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	return w.do(w.httpClient, req)
+}
+
+// upload POSTs params and file as multipart/form-data. The file is streamed
+// after the other fields, as DSM requires.
+func (w *WebAPIClient) upload(ctx context.Context, path string, params url.Values, file Upload) ([]byte, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeMultipart(mw, params, file))
+	}()
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.baseURL+path, pr)
+	if err != nil {
+		_ = pr.Close()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return w.do(w.uploadClient, req)
+}
+
+// writeMultipart writes params in key order followed by file
+func writeMultipart(mw *multipart.Writer, params url.Values, file Upload) error {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := mw.WriteField(key, params.Get(key)); err != nil {
+			return err
+		}
+	}
+
+	field := file.Field
+	if field == "" {
+		field = "file"
+	}
+	part, err := mw.CreateFormFile(field, file.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file.Content); err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	return mw.Close()
+}
+
+// do sends a request through client with the Web API headers and returns
+// the response body, failing on HTTP errors
+func (w *WebAPIClient) do(client *http.Client, req *http.Request) ([]byte, error) {
 	req.Header.Set("User-Agent", "syno-vm/0.1.0")
+	if _, synoToken := w.session(); synoToken != "" {
+		req.Header.Set("X-SYNO-TOKEN", synoToken)
+	}
 
-	resp, err := w.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
@@ -225,4 +632,4 @@ func (w *WebAPIClient) makeRequest(method, path string, params url.Values, body
 	}
 
 	return respBody, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,239 @@
+package synology
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// recordedRequest is what a test server saw of a request
+type recordedRequest struct {
+	method      string
+	query       url.Values
+	contentType string
+	form        url.Values
+	userAgent   string
+}
+
+// recorder is a Web API that logs in every account and records the
+// requests it receives
+type recorder struct {
+	requests []recordedRequest
+}
+
+func (f *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	f.requests = append(f.requests, recordedRequest{
+		method:      r.Method,
+		query:       r.URL.Query(),
+		contentType: r.Header.Get("Content-Type"),
+		form:        r.PostForm,
+		userAgent:   r.UserAgent(),
+	})
+
+	data := map[string]interface{}{}
+	if r.PostForm.Get("method") == "login" {
+		data["sid"] = "sid-1"
+	}
+	_ = json.NewEncoder(w).Encode(WebAPIResponse{Success: true, Data: data})
+}
+
+func TestMakeRequest(t *testing.T) {
+	ctx := context.Background()
+	api := &recorder{}
+	w := newTestWebAPIClient(t, api, TwoFactor{})
+	params := url.Values{"api": {apiGuest}, "name": {"web server"}}
+
+	if _, err := w.makeRequest(ctx, http.MethodGet, "/webapi/entry.cgi", params); err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	if _, err := w.makeRequest(ctx, http.MethodPost, "/webapi/entry.cgi", params); err != nil {
+		t.Fatalf("POST error = %v", err)
+	}
+
+	get, post := api.requests[0], api.requests[1]
+	if get.method != http.MethodGet || get.query.Get("name") != "web server" || len(get.form) != 0 {
+		t.Errorf("GET request = %+v, want params in the query string", get)
+	}
+	if post.method != http.MethodPost || len(post.query) != 0 || post.form.Get("name") != "web server" {
+		t.Errorf("POST request = %+v, want params in the body", post)
+	}
+	if post.contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("POST content type = %q", post.contentType)
+	}
+	if get.userAgent != "syno-vm/0.1.0" {
+		t.Errorf("user agent = %q", get.userAgent)
+	}
+}
+
+func TestCredentialsAreNotInURLs(t *testing.T) {
+	ctx := context.Background()
+	api := &recorder{}
+	w := newTestWebAPIClient(t, api, TwoFactor{})
+
+	if _, err := w.CallAPI(ctx, apiGuest, "list", "", map[string]interface{}{"limit": 10}); err != nil {
+		t.Fatalf("CallAPI() error = %v", err)
+	}
+	if err := w.Logout(ctx); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+
+	if len(api.requests) != 3 {
+		t.Fatalf("got %d requests, want login, list and logout", len(api.requests))
+	}
+	for _, r := range api.requests {
+		if r.method != http.MethodPost || len(r.query) != 0 {
+			t.Errorf("%s request with query %v, want everything in a POST body", r.form.Get("method"), r.query)
+		}
+	}
+	if login := api.requests[0].form; login.Get("passwd") != "s3cret" || login.Get("account") != "admin" {
+		t.Errorf("login form = %v", login)
+	}
+	if list := api.requests[1].form; list.Get("_sid") != "sid-1" || list.Get("limit") != "10" {
+		t.Errorf("list form = %v", list)
+	}
+}
+
+// uploads is a Web API that accepts multipart uploads, expiring the first
+// session if expire is set
+type uploads struct {
+	expire  bool
+	logins  int
+	fields  []string
+	content string
+}
+
+func (f *uploads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := WebAPIResponse{Success: true, Data: map[string]interface{}{}}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f.logins++
+		resp.Data["sid"] = fmt.Sprintf("sid-%d", f.logins)
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.fields = nil
+	values := map[string]string{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(part)
+		f.fields = append(f.fields, part.FormName())
+		if part.FileName() != "" {
+			f.content = part.FileName() + ": " + string(data)
+		}
+		values[part.FormName()] = string(data)
+	}
+
+	if f.expire && values["_sid"] == "sid-1" {
+		resp = WebAPIResponse{Error: &WebAPIError{Code: errCodeSessionTimeout}}
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	api := &uploads{}
+	w := newTestWebAPIClient(t, api, TwoFactor{})
+
+	file := Upload{Name: "seed.iso", Content: strings.NewReader("ISO data")}
+	resp, err := w.Upload(ctx, apiGuest, "upload", "", map[string]interface{}{"overwrite": true}, file)
+	if err != nil || !resp.Success {
+		t.Fatalf("Upload() = %+v, %v", resp, err)
+	}
+
+	want := []string{"_sid", "api", "method", "overwrite", "version", "file"}
+	if strings.Join(api.fields, ",") != strings.Join(want, ",") {
+		t.Errorf("fields = %v, want %v with the file last", api.fields, want)
+	}
+	if api.content != "seed.iso: ISO data" {
+		t.Errorf("uploaded %q", api.content)
+	}
+
+	// Uploads are not cut off by the timeout of other calls
+	if w.uploadClient.Timeout != 0 {
+		t.Errorf("upload client timeout = %v, want none", w.uploadClient.Timeout)
+	}
+}
+
+func TestUploadAfterSessionExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	// A file that can be read again is uploaded again
+	api := &uploads{expire: true}
+	w := newTestWebAPIClient(t, api, TwoFactor{})
+	file := Upload{Field: "image", Name: "disk.img", Content: bytes.NewReader([]byte("disk data"))}
+	resp, err := w.Upload(ctx, apiGuest, "upload", "", nil, file)
+	if err != nil || !resp.Success {
+		t.Fatalf("Upload() = %+v, %v", resp, err)
+	}
+	if api.logins != 2 || api.content != "disk.img: disk data" {
+		t.Errorf("logins = %d, uploaded %q; want the upload retried in full", api.logins, api.content)
+	}
+
+	// A stream cannot be
+	api = &uploads{expire: true}
+	w = newTestWebAPIClient(t, api, TwoFactor{})
+	file = Upload{Name: "disk.img", Content: io.MultiReader(strings.NewReader("disk data"))}
+	if _, err := w.Upload(ctx, apiGuest, "upload", "", nil, file); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Upload() of a stream error = %v, want ErrSessionExpired", err)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+		code    int
+	}{
+		{"HTTP error", http.StatusInternalServerError, "internal error", "HTTP error 500: internal error", 0},
+		{"invalid JSON", http.StatusOK, "<html>", "failed to parse API response", 0},
+		{"DSM error", http.StatusOK, `{"success": false, "error": {"code": 120}}`, "", 120},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.FormValue("method") == "login" {
+					_ = json.NewEncoder(w).Encode(WebAPIResponse{Success: true, Data: map[string]interface{}{"sid": "sid-1"}})
+					return
+				}
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			})
+			w := newTestWebAPIClient(t, api, TwoFactor{})
+
+			resp, err := w.CallAPI(ctx, apiGuest, "list", "", nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("CallAPI() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || resp.Success || resp.Error == nil || resp.Error.Code != tt.code {
+				t.Errorf("CallAPI() = %+v, %v; want error code %d", resp, err, tt.code)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -60,7 +61,7 @@ func testListVMs(t *testing.T) {
 		t.Fatalf("Failed to create client: %v", err)
 	}
 
-	vms, err := client.ListVMs()
+	vms, err := client.ListVMs(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to list VMs: %v", err)
 	}
@@ -90,7 +91,7 @@ func testVMLifecycle(t *testing.T) {
 
 	// Clean up any existing test VM
 	defer func() {
-		_ = client.DeleteVM(testVMName) // Best effort cleanup
+		_ = client.DeleteVM(context.Background(), testVMName) // Best effort cleanup
 	}()
 
 	t.Run("CreateVM", func(t *testing.T) {
@@ -100,14 +101,14 @@ func testVMLifecycle(t *testing.T) {
 			Memory: 1024,
 		}
 
-		err := client.CreateVM(config)
+		err := client.CreateVM(context.Background(), config)
 		if err != nil {
 			t.Fatalf("Failed to create VM: %v", err)
 		}
 	})
 
 	t.Run("GetVMStatus", func(t *testing.T) {
-		vm, err := client.GetVMStatus(testVMName)
+		vm, err := client.GetVMStatus(context.Background(), testVMName)
 		if err != nil {
 			t.Fatalf("Failed to get VM status: %v", err)
 		}
@@ -118,21 +119,21 @@ func testVMLifecycle(t *testing.T) {
 	})
 
 	t.Run("StartVM", func(t *testing.T) {
-		err := client.StartVM(testVMName)
+		err := client.StartVM(context.Background(), testVMName)
 		if err != nil {
 			t.Fatalf("Failed to start VM: %v", err)
 		}
 	})
 
 	t.Run("StopVM", func(t *testing.T) {
-		err := client.StopVM(testVMName)
+		err := client.StopVM(context.Background(), testVMName)
 		if err != nil {
 			t.Fatalf("Failed to stop VM: %v", err)
 		}
 	})
 
 	t.Run("DeleteVM", func(t *testing.T) {
-		err := client.DeleteVM(testVMName)
+		err := client.DeleteVM(context.Background(), testVMName)
 		if err != nil {
 			t.Fatalf("Failed to delete VM: %v", err)
 		}
@@ -145,7 +146,7 @@ func testTemplates(t *testing.T) {
 		t.Fatalf("Failed to create client: %v", err)
 	}
 
-	templates, err := client.ListTemplates()
+	templates, err := client.ListTemplates(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to list templates: %v", err)
 	}
@@ -191,9 +192,9 @@ func BenchmarkListVMs(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		_, err := client.ListVMs()
+		_, err := client.ListVMs(context.Background())
 		if err != nil {
 			b.Fatalf("Failed to list VMs: %v", err)
 		}
 	}
-}
\ No newline at end of file
+}
@@ -1,26 +1,63 @@
 package mock
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/scttfrdmn/syno-vm/internal/synology"
 )
 
 // MockClient is a mock implementation of the Synology client for testing
 type MockClient struct {
+	// mu serialises calls, so the mock can stand in for a backend used
+	// concurrently
+	mu sync.Mutex
+
 	VMs       []synology.VM
 	Templates []synology.Template
+	Snapshots map[string][]synology.Snapshot // Snapshots by VM name
+	Saved     map[string]bool                // VMs stopped with SaveVM
 	Connected bool
 	Fail      map[string]bool // Map of method names that should fail
+
+	// IgnoreShutdown makes StopVM leave VMs running, like a guest that
+	// ignores ACPI shutdown requests
+	IgnoreShutdown bool
+
+	// IgnorePowerOff makes PowerOffVM leave VMs running, like a hypervisor
+	// that takes its time to tear a guest down
+	IgnorePowerOff bool
+
+	// StatsCalls counts CollectStats calls
+	StatsCalls int
+
+	// Events are delivered by WatchEvents, which then returns
+	Events []synology.Event
+
+	// Autostart records which VMs start when the NAS boots
+	Autostart map[string]bool
 }
 
+// Ensure MockClient implements synology.VMManager and the optional interfaces
+var (
+	_ synology.VMManager       = (*MockClient)(nil)
+	_ synology.SnapshotManager = (*MockClient)(nil)
+	_ synology.DomainInspector = (*MockClient)(nil)
+	_ synology.StatsCollector  = (*MockClient)(nil)
+	_ synology.EventWatcher    = (*MockClient)(nil)
+	_ synology.VMUpdater       = (*MockClient)(nil)
+)
+
 // NewMockClient creates a new mock client with sample data
 func NewMockClient() *MockClient {
 	return &MockClient{
 		VMs: []synology.VM{
 			{
 				Name:      "test-vm-1",
-				Status:    "running",
+				Status:    synology.StateRunning,
 				CPU:       2,
 				Memory:    2048,
 				Storage:   "20GB",
@@ -28,7 +65,7 @@ func NewMockClient() *MockClient {
 			},
 			{
 				Name:      "test-vm-2",
-				Status:    "stopped",
+				Status:    synology.StateStopped,
 				CPU:       4,
 				Memory:    4096,
 				Storage:   "40GB",
@@ -47,13 +84,19 @@ func NewMockClient() *MockClient {
 				OS:          "Windows",
 			},
 		},
+		Snapshots: make(map[string][]synology.Snapshot),
+		Saved:     make(map[string]bool),
 		Connected: true,
 		Fail:      make(map[string]bool),
+		Autostart: make(map[string]bool),
 	}
 }
 
 // Connect simulates connecting to the Synology NAS
-func (m *MockClient) Connect() error {
+func (m *MockClient) Connect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.Fail["Connect"] {
 		return fmt.Errorf("mock connection failed")
 	}
@@ -63,6 +106,9 @@ func (m *MockClient) Connect() error {
 
 // Disconnect simulates disconnecting from the Synology NAS
 func (m *MockClient) Disconnect() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.Fail["Disconnect"] {
 		return fmt.Errorf("mock disconnect failed")
 	}
@@ -71,66 +117,180 @@ func (m *MockClient) Disconnect() error {
 }
 
 // ListVMs returns the mock VM list
-func (m *MockClient) ListVMs() ([]synology.VM, error) {
-	if m.Fail["ListVMs"] {
-		return nil, fmt.Errorf("mock ListVMs failed")
+func (m *MockClient) ListVMs(ctx context.Context) ([]synology.VM, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "ListVMs"); err != nil {
+		return nil, err
 	}
-	return m.VMs, nil
+	return append([]synology.VM(nil), m.VMs...), nil
 }
 
 // StartVM simulates starting a VM
-func (m *MockClient) StartVM(vmName string) error {
-	if m.Fail["StartVM"] {
-		return fmt.Errorf("mock StartVM failed")
+func (m *MockClient) StartVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "StartVM"); err != nil {
+		return err
 	}
 
 	for i, vm := range m.VMs {
 		if vm.Name == vmName {
-			m.VMs[i].Status = "running"
+			m.VMs[i].Status = synology.StateRunning
 			return nil
 		}
 	}
 
-	return fmt.Errorf("VM not found: %s", vmName)
+	return fmt.Errorf("%w: %s", synology.ErrGuestNotFound, vmName)
 }
 
 // StopVM simulates stopping a VM
-func (m *MockClient) StopVM(vmName string) error {
-	if m.Fail["StopVM"] {
-		return fmt.Errorf("mock StopVM failed")
+func (m *MockClient) StopVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "StopVM"); err != nil {
+		return err
 	}
 
 	for i, vm := range m.VMs {
 		if vm.Name == vmName {
-			m.VMs[i].Status = "stopped"
-			m.VMs[i].IPAddress = ""
+			if !m.IgnoreShutdown {
+				m.VMs[i].Status = synology.StateStopped
+				m.VMs[i].IPAddress = ""
+			}
 			return nil
 		}
 	}
 
-	return fmt.Errorf("VM not found: %s", vmName)
+	return fmt.Errorf("%w: %s", synology.ErrGuestNotFound, vmName)
+}
+
+// PowerOffVM simulates forcibly powering off a VM
+func (m *MockClient) PowerOffVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "PowerOffVM"); err != nil {
+		return err
+	}
+
+	for i, vm := range m.VMs {
+		if vm.Name == vmName {
+			if !m.IgnorePowerOff {
+				m.VMs[i].Status = synology.StateStopped
+				m.VMs[i].IPAddress = ""
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", synology.ErrGuestNotFound, vmName)
 }
 
 // RestartVM simulates restarting a VM
-func (m *MockClient) RestartVM(vmName string) error {
-	if m.Fail["RestartVM"] {
-		return fmt.Errorf("mock RestartVM failed")
+func (m *MockClient) RestartVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "RestartVM"); err != nil {
+		return err
 	}
 
 	for i, vm := range m.VMs {
 		if vm.Name == vmName {
-			m.VMs[i].Status = "running"
+			m.VMs[i].Status = synology.StateRunning
 			return nil
 		}
 	}
 
-	return fmt.Errorf("VM not found: %s", vmName)
+	return fmt.Errorf("%w: %s", synology.ErrGuestNotFound, vmName)
+}
+
+// ResetVM simulates hard-resetting a running VM
+func (m *MockClient) ResetVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transition(ctx, "ResetVM", vmName, synology.StateRunning, synology.StateRunning)
+}
+
+// PauseVM simulates suspending a running VM
+func (m *MockClient) PauseVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transition(ctx, "PauseVM", vmName, synology.StateRunning, synology.StatePaused)
+}
+
+// ResumeVM simulates resuming a paused VM
+func (m *MockClient) ResumeVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transition(ctx, "ResumeVM", vmName, synology.StatePaused, synology.StateRunning)
+}
+
+// SaveVM simulates saving a running VM's state and stopping it
+func (m *MockClient) SaveVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.transition(ctx, "SaveVM", vmName, synology.StateRunning, synology.StateStopped); err != nil {
+		return err
+	}
+	m.Saved[vmName] = true
+	return nil
+}
+
+// RestoreVM simulates starting a VM from its saved state
+func (m *MockClient) RestoreVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.Saved[vmName] {
+		return fmt.Errorf("VM %s has no saved state", vmName)
+	}
+	if err := m.transition(ctx, "RestoreVM", vmName, synology.StateStopped, synology.StateRunning); err != nil {
+		return err
+	}
+	delete(m.Saved, vmName)
+	return nil
+}
+
+// transition moves a VM from state from to state to
+func (m *MockClient) transition(ctx context.Context, method, vmName string, from, to synology.VMState) error {
+	if err := m.check(ctx, method); err != nil {
+		return err
+	}
+
+	for i, vm := range m.VMs {
+		if vm.Name == vmName {
+			if vm.Status != from {
+				return fmt.Errorf("VM %s is %s, not %s", vmName, vm.Status, from)
+			}
+			m.VMs[i].Status = to
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", synology.ErrGuestNotFound, vmName)
 }
 
 // GetVMStatus returns the status of a specific VM
-func (m *MockClient) GetVMStatus(vmName string) (*synology.VM, error) {
-	if m.Fail["GetVMStatus"] {
-		return nil, fmt.Errorf("mock GetVMStatus failed")
+func (m *MockClient) GetVMStatus(ctx context.Context, vmName string) (*synology.VM, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.vmStatus(ctx, vmName)
+}
+
+// vmStatus implements GetVMStatus for callers that hold mu
+func (m *MockClient) vmStatus(ctx context.Context, vmName string) (*synology.VM, error) {
+	if err := m.check(ctx, "GetVMStatus"); err != nil {
+		return nil, err
 	}
 
 	for _, vm := range m.VMs {
@@ -139,13 +299,101 @@ func (m *MockClient) GetVMStatus(vmName string) (*synology.VM, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("VM not found: %s", vmName)
+	return nil, fmt.Errorf("%w: %s", synology.ErrGuestNotFound, vmName)
+}
+
+// GetDomain returns a domain definition derived from the mock VM
+func (m *MockClient) GetDomain(ctx context.Context, vmName string) (*synology.Domain, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "GetDomain"); err != nil {
+		return nil, err
+	}
+
+	vm, err := m.vmStatus(ctx, vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	// VMs created with a disk image path keep it; the samples get a default
+	disk := "/volume1/vms/" + vm.Name + ".qcow2"
+	if strings.HasPrefix(vm.Storage, "/") {
+		disk = vm.Storage
+	}
+
+	return &synology.Domain{
+		Name:      vm.Name,
+		UUID:      "00000000-0000-0000-0000-000000000000",
+		Type:      "kvm",
+		Memory:    vm.Memory,
+		CPU:       synology.DomainCPU{VCPUs: vm.CPU},
+		Firmware:  "bios",
+		Autostart: m.Autostart[vm.Name],
+		BootOrder: []string{"hd"},
+		Disks: []synology.DomainDisk{
+			{Device: "disk", Target: "vda", Bus: "virtio", Format: "qcow2", Source: disk},
+		},
+		NICs: []synology.DomainNIC{
+			{MAC: "52:54:00:00:00:01", Type: "bridge", Source: "ovs_eth0", Model: "virtio"},
+		},
+	}, nil
+}
+
+// CollectStats returns resource usage derived from the mock VMs. Running VMs
+// get one disk and one NIC with non-zero counters.
+func (m *MockClient) CollectStats(ctx context.Context) (*synology.Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.StatsCalls++
+	if err := m.check(ctx, "CollectStats"); err != nil {
+		return nil, err
+	}
+
+	stats := &synology.Stats{
+		Host: synology.HostStats{CPUs: 4, MemoryBytes: 16 << 30, MemoryFreeBytes: 8 << 30},
+	}
+	for _, vm := range m.VMs {
+		d := synology.DomainStats{
+			Name:         vm.Name,
+			State:        vm.Status,
+			VCPUs:        vm.CPU,
+			MemoryMaxKiB: uint64(vm.Memory) * 1024,
+		}
+		if vm.Status == synology.StateRunning {
+			current := d.MemoryMaxKiB
+			d.CPUTimeNs = 1500000000
+			d.MemoryCurrentKiB = &current
+			d.Disks = []synology.DiskStats{{Device: "vda", ReadBytes: 1024, WriteBytes: 2048, ReadReqs: 10, WriteReqs: 20, Capacity: 20 << 30, Allocation: 1 << 30}}
+			d.NICs = []synology.NICStats{{Interface: "vnet0", RxBytes: 4096, TxBytes: 8192, RxPackets: 40, TxPackets: 80}}
+		}
+		stats.Domains = append(stats.Domains, d)
+	}
+	return stats, nil
+}
+
+// WatchEvents delivers the configured events and returns
+func (m *MockClient) WatchEvents(ctx context.Context, handle func(synology.Event)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "WatchEvents"); err != nil {
+		return err
+	}
+	for _, event := range m.Events {
+		handle(event)
+	}
+	return nil
 }
 
 // CreateVM simulates creating a new VM
-func (m *MockClient) CreateVM(config synology.VMConfig) error {
-	if m.Fail["CreateVM"] {
-		return fmt.Errorf("mock CreateVM failed")
+func (m *MockClient) CreateVM(ctx context.Context, config synology.VMConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "CreateVM"); err != nil {
+		return err
 	}
 
 	// Check if VM already exists
@@ -158,45 +406,85 @@ func (m *MockClient) CreateVM(config synology.VMConfig) error {
 	// Add new VM to mock list
 	newVM := synology.VM{
 		Name:    config.Name,
-		Status:  "stopped",
+		Status:  synology.StateStopped,
 		CPU:     config.CPU,
 		Memory:  config.Memory,
 		Storage: config.Storage,
 	}
 
 	m.VMs = append(m.VMs, newVM)
+	if config.Autorun {
+		m.Autostart[config.Name] = true
+	}
 	return nil
 }
 
+// UpdateVM simulates changing the definition of a VM
+func (m *MockClient) UpdateVM(ctx context.Context, vmName string, update synology.VMUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "UpdateVM"); err != nil {
+		return err
+	}
+
+	for i, vm := range m.VMs {
+		if vm.Name == vmName {
+			if update.CPU > 0 {
+				m.VMs[i].CPU = update.CPU
+			}
+			if update.Memory > 0 {
+				m.VMs[i].Memory = update.Memory
+			}
+			if update.Autostart != nil {
+				m.Autostart[vmName] = *update.Autostart
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", synology.ErrGuestNotFound, vmName)
+}
+
 // DeleteVM simulates deleting a VM
-func (m *MockClient) DeleteVM(vmName string) error {
-	if m.Fail["DeleteVM"] {
-		return fmt.Errorf("mock DeleteVM failed")
+func (m *MockClient) DeleteVM(ctx context.Context, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "DeleteVM"); err != nil {
+		return err
 	}
 
 	for i, vm := range m.VMs {
 		if vm.Name == vmName {
 			// Remove VM from slice
 			m.VMs = append(m.VMs[:i], m.VMs[i+1:]...)
+			delete(m.Autostart, vmName)
 			return nil
 		}
 	}
 
-	return fmt.Errorf("VM not found: %s", vmName)
+	return fmt.Errorf("%w: %s", synology.ErrGuestNotFound, vmName)
 }
 
 // ListTemplates returns the mock template list
-func (m *MockClient) ListTemplates() ([]synology.Template, error) {
-	if m.Fail["ListTemplates"] {
-		return nil, fmt.Errorf("mock ListTemplates failed")
+func (m *MockClient) ListTemplates(ctx context.Context) ([]synology.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "ListTemplates"); err != nil {
+		return nil, err
 	}
 	return m.Templates, nil
 }
 
 // CreateTemplate simulates creating a new template
-func (m *MockClient) CreateTemplate(templateName, vmName string) error {
-	if m.Fail["CreateTemplate"] {
-		return fmt.Errorf("mock CreateTemplate failed")
+func (m *MockClient) CreateTemplate(ctx context.Context, templateName, vmName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "CreateTemplate"); err != nil {
+		return err
 	}
 
 	// Check if VM exists
@@ -231,9 +519,12 @@ func (m *MockClient) CreateTemplate(templateName, vmName string) error {
 }
 
 // DeleteTemplate simulates deleting a template
-func (m *MockClient) DeleteTemplate(templateName string) error {
-	if m.Fail["DeleteTemplate"] {
-		return fmt.Errorf("mock DeleteTemplate failed")
+func (m *MockClient) DeleteTemplate(ctx context.Context, templateName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "DeleteTemplate"); err != nil {
+		return err
 	}
 
 	for i, template := range m.Templates {
@@ -247,12 +538,129 @@ func (m *MockClient) DeleteTemplate(templateName string) error {
 	return fmt.Errorf("template not found: %s", templateName)
 }
 
+// CreateSnapshot simulates taking a snapshot, which becomes the current one
+func (m *MockClient) CreateSnapshot(ctx context.Context, vmName string, opts synology.SnapshotOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "CreateSnapshot"); err != nil {
+		return err
+	}
+
+	vm, err := m.vmStatus(ctx, vmName)
+	if err != nil {
+		return err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = fmt.Sprintf("snapshot-%d", len(m.Snapshots[vmName])+1)
+	}
+
+	parent := ""
+	snapshots := m.Snapshots[vmName]
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			return fmt.Errorf("snapshot already exists: %s", name)
+		}
+		if snapshots[i].Current {
+			parent = snapshots[i].Name
+			snapshots[i].Current = false
+		}
+	}
+
+	m.Snapshots[vmName] = append(snapshots, synology.Snapshot{
+		Name:        name,
+		VMName:      vmName,
+		Description: opts.Description,
+		State:       string(vm.Status),
+		Parent:      parent,
+		CreatedAt:   time.Now(),
+		Current:     true,
+	})
+	return nil
+}
+
+// ListSnapshots returns the mock snapshots of a VM
+func (m *MockClient) ListSnapshots(ctx context.Context, vmName string) ([]synology.Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "ListSnapshots"); err != nil {
+		return nil, err
+	}
+	return m.Snapshots[vmName], nil
+}
+
+// RevertSnapshot simulates reverting a VM to a snapshot
+func (m *MockClient) RevertSnapshot(ctx context.Context, vmName, snapshotName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "RevertSnapshot"); err != nil {
+		return err
+	}
+
+	snapshots := m.Snapshots[vmName]
+	found := false
+	for i := range snapshots {
+		snapshots[i].Current = snapshots[i].Name == snapshotName
+		found = found || snapshots[i].Current
+	}
+	if !found {
+		return fmt.Errorf("snapshot not found: %s", snapshotName)
+	}
+	return nil
+}
+
+// DeleteSnapshot simulates deleting a snapshot, re-parenting its children
+func (m *MockClient) DeleteSnapshot(ctx context.Context, vmName, snapshotName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.check(ctx, "DeleteSnapshot"); err != nil {
+		return err
+	}
+
+	snapshots := m.Snapshots[vmName]
+	for i, s := range snapshots {
+		if s.Name == snapshotName {
+			for j := range snapshots {
+				if snapshots[j].Parent == snapshotName {
+					snapshots[j].Parent = s.Parent
+				}
+			}
+			m.Snapshots[vmName] = append(snapshots[:i], snapshots[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("snapshot not found: %s", snapshotName)
+}
+
+// check returns an error if ctx is done or method is configured to fail
+func (m *MockClient) check(ctx context.Context, method string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.Fail[method] {
+		return fmt.Errorf("mock %s failed", method)
+	}
+	return nil
+}
+
 // SetFailure configures the mock to fail specific method calls
 func (m *MockClient) SetFailure(method string, shouldFail bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.Fail[method] = shouldFail
 }
 
 // ResetFailures clears all failure configurations
 func (m *MockClient) ResetFailures() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.Fail = make(map[string]bool)
-}
\ No newline at end of file
+}